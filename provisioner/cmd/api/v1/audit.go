@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/audit"
+	"github.com/BradleyLewis08/HiVE/internal/logging"
+)
+
+const JSON_LINES_CONTENT_TYPE = "application/x-ndjson"
+
+// Entries GET /audit returns when no limit is given, or at most when a
+// larger one is; exports are not limited
+const MAX_AUDIT_LIST = 1000
+
+// recordAudit appends the outcome of an action on an environment to the
+// audit log. A failure to record is logged rather than failing the action,
+// which has already happened.
+func (s *Server) recordAudit(ctx context.Context, action string, environment address.Address, parameters map[string]string, err error) {
+	entry := audit.Entry{
+		Actor:       audit.Actor(ctx),
+		OnBehalfOf:  audit.OnBehalfOf(ctx),
+		Action:      action,
+		Environment: environment,
+		Parameters:  parameters,
+		Outcome:     audit.OUTCOME_SUCCESS,
+		RequestID:   logging.RequestID(ctx),
+		JobID:       logging.JobID(ctx),
+	}
+	if err != nil {
+		entry.Outcome = audit.OUTCOME_FAILURE
+		entry.Error = err.Error()
+	}
+	if _, err := s.audit.Append(ctx, entry); err != nil {
+		slog.ErrorContext(ctx, "Failed to record audit entry", "action", action, "environment", environment, "error", err)
+	}
+}
+
+/* Lists audit entries, oldest first. Query parameters: course, assignment,
+*  netID, actor, onBehalfOf, action, outcome, job, since and until (RFC 3339)
+*  and limit, which keeps only the most recent entries, at most
+*  MAX_AUDIT_LIST.
+*/
+func (s *Server) listAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilter(r)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.Limit == 0 || filter.Limit > MAX_AUDIT_LIST {
+		filter.Limit = MAX_AUDIT_LIST
+	}
+	entries, err := s.audit.Query(r.Context(), filter)
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to query audit log")
+		return
+	}
+	writeJSON(w, http.StatusOK, api.AuditList{Entries: entries})
+}
+
+// exportAudit writes the entries matching the same filters as listAudit as
+// JSON lines, one entry per line. The export itself is audited, with the
+// filters as its parameters, after the entries it returns.
+func (s *Server) exportAudit(w http.ResponseWriter, r *http.Request) {
+	filter, err := auditFilter(r)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	entries, err := s.audit.Query(r.Context(), filter)
+	s.recordAudit(r.Context(), audit.ACTION_EXPORT, filter.Environment, exportParameters(r), err)
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to query audit log")
+		return
+	}
+
+	w.Header().Set("Content-Type", JSON_LINES_CONTENT_TYPE)
+	w.Header().Set("Content-Disposition", `attachment; filename="audit.jsonl"`)
+	encoder := json.NewEncoder(w)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			slog.WarnContext(r.Context(), "Audit export interrupted", "error", err)
+			return
+		}
+	}
+}
+
+// exportParameters returns the query parameters of an export, by name.
+func exportParameters(r *http.Request) map[string]string {
+	query := r.URL.Query()
+	if len(query) == 0 {
+		return nil
+	}
+	parameters := make(map[string]string, len(query))
+	for name := range query {
+		parameters[name] = query.Get(name)
+	}
+	return parameters
+}
+
+func auditFilter(r *http.Request) (audit.Filter, error) {
+	query := r.URL.Query()
+	filter := audit.Filter{
+		Environment: address.Address{
+			CourseName:     sanitizeFilter(query.Get("course")),
+			AssignmentName: sanitizeFilter(query.Get("assignment")),
+			NetID:          sanitizeFilter(query.Get("netID")),
+		},
+		Actor:      query.Get("actor"),
+		OnBehalfOf: query.Get("onBehalfOf"),
+		Action:     query.Get("action"),
+		Outcome:    query.Get("outcome"),
+		JobID:      query.Get("job"),
+	}
+
+	var err error
+	if since := query.Get("since"); since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			return filter, fmt.Errorf("Invalid since %q, must be RFC 3339", since)
+		}
+	}
+	if until := query.Get("until"); until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, until); err != nil {
+			return filter, fmt.Errorf("Invalid until %q, must be RFC 3339", until)
+		}
+	}
+	if limit := query.Get("limit"); limit != "" {
+		if filter.Limit, err = strconv.Atoi(limit); err != nil || filter.Limit < 0 {
+			return filter, fmt.Errorf("Invalid limit %q", limit)
+		}
+	}
+	return filter, nil
+}
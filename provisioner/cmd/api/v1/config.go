@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/audit"
+	"github.com/BradleyLewis08/HiVE/internal/docker"
+	"github.com/BradleyLewis08/HiVE/internal/gateway"
+	"github.com/BradleyLewis08/HiVE/internal/ingress"
+	k8sclient "github.com/BradleyLewis08/HiVE/internal/kubernetes"
+	k8sProvisioner "github.com/BradleyLewis08/HiVE/internal/provisioner"
+	"github.com/BradleyLewis08/HiVE/internal/proxymanager"
+	"github.com/BradleyLewis08/HiVE/internal/quota"
+	"github.com/BradleyLewis08/HiVE/internal/routing"
+	"github.com/BradleyLewis08/HiVE/internal/storage"
+	"github.com/BradleyLewis08/HiVE/internal/templates"
+	"github.com/BradleyLewis08/HiVE/internal/webhooks"
+)
+
+// Audit log file kept before the audit log moved to storage, imported by
+// importAuditLog when AUDIT_LOG is not set
+const DEFAULT_AUDIT_LOG = "audit.jsonl"
+
+// Suffix an imported audit log file is renamed with, so that it is only
+// imported once
+const IMPORTED_AUDIT_LOG_SUFFIX = ".imported"
+
+// serverFromEnvironment builds the Server described by the environment
+// variables documented in the README.
+func serverFromEnvironment(ctx context.Context) (*Server, error) {
+	options := Options{
+		PublicBaseURL: os.Getenv("PUBLIC_BASE_URL"),
+		APIToken: os.Getenv("API_TOKEN"),
+	}
+	if timeout := os.Getenv("READY_TIMEOUT"); timeout != "" {
+		duration, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid READY_TIMEOUT %q: %w", timeout, err)
+		}
+		options.ReadyTimeout = duration
+	}
+	for name, setting := range map[string]*time.Duration{
+		"DRIFT_INTERVAL": &options.DriftInterval,
+		"DRIFT_GRACE_PERIOD": &options.DriftGracePeriod,
+		"GC_INTERVAL": &options.GCInterval,
+		"GC_GRACE_PERIOD": &options.GCGracePeriod,
+	} {
+		if value := os.Getenv(name); value != "" {
+			duration, err := time.ParseDuration(value)
+			if err != nil || duration <= 0 {
+				return nil, fmt.Errorf("invalid %s %q", name, value)
+			}
+			*setting = duration
+		}
+	}
+	options.GCDryRun = os.Getenv("GC_DRY_RUN") == "true"
+
+	deps, err := storageFromEnvironment(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deps.Webhooks, err = webhooksFromEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	if os.Getenv("ENVIRONMENT_BACKEND") == k8sProvisioner.BACKEND_DOCKER {
+		return newDockerServer(ctx, deps, options)
+	}
+
+	clientConfig, err := kubernetesConfigFromEnvironment()
+	if err != nil {
+		return nil, err
+	}
+
+	client, clientInitErr := k8sclient.GetKubernetesClient(clientConfig)
+	if clientInitErr != nil {
+		return nil, clientInitErr
+	}
+
+	router, err := newRouter(os.Getenv("ROUTER_BACKEND"), client)
+	if err != nil {
+		return nil, err
+	}
+
+	if os.Getenv("ROUTER_BACKEND") == routing.BACKEND_GATEWAY && os.Getenv("GATEWAY_MATCH_HOST") == "true" {
+		options.HostDomain = os.Getenv("GATEWAY_HOSTNAME")
+	}
+
+	deps.K8sClient = client
+	deps.Environments = k8sProvisioner.NewProvisioner(client)
+	deps.Router = router
+	return NewServer(deps, options), nil
+}
+
+// newDockerServer runs environments as local containers behind an
+// in-process proxy, for development without a cluster.
+func newDockerServer(ctx context.Context, deps Dependencies, options Options) (*Server, error) {
+	backend, err := docker.NewBackend(ctx, os.Getenv("DOCKER_NETWORK"))
+	if err != nil {
+		return nil, err
+	}
+
+	proxyAddress := os.Getenv("DOCKER_PROXY_ADDRESS")
+	if proxyAddress == "" {
+		proxyAddress = docker.DEFAULT_PROXY_ADDRESS
+	}
+
+	if options.PublicBaseURL == "" {
+		options.PublicBaseURL = "http://localhost" + proxyAddress[strings.LastIndex(proxyAddress, ":"):]
+	}
+
+	deps.Environments = backend
+	deps.Router = docker.NewProxyRouter(backend, proxyAddress)
+	return NewServer(deps, options), nil
+}
+
+// storageFromEnvironment opens the configured storage, and the audit log,
+// quotas and templates it holds.
+func storageFromEnvironment(ctx context.Context) (Dependencies, error) {
+	store, err := storage.Open(ctx, storage.Config{
+		Backend: os.Getenv("STORAGE_BACKEND"),
+		Path: os.Getenv("STORAGE_PATH"),
+		URL: os.Getenv("DATABASE_URL"),
+	})
+	if err != nil {
+		return Dependencies{}, err
+	}
+	deps := Dependencies{Storage: store}
+
+	deps.Audit = audit.Open(store)
+	if err = importAuditLog(ctx, deps.Audit); err == nil {
+		if deps.Quotas, err = quota.Open(ctx, store); err == nil {
+			deps.Templates, err = templates.Open(ctx, store)
+		}
+	}
+	if err != nil {
+		store.Close()
+		return Dependencies{}, err
+	}
+	return deps, nil
+}
+
+// importAuditLog appends the entries of the audit log file at AUDIT_LOG,
+// or DEFAULT_AUDIT_LOG, to the log in storage, then renames the file so
+// that they are not imported again. A missing file is not an error.
+func importAuditLog(ctx context.Context, log *audit.Log) error {
+	path := os.Getenv("AUDIT_LOG")
+	if path == "" {
+		path = DEFAULT_AUDIT_LOG
+	}
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	defer file.Close()
+
+	imported, err := log.Import(ctx, file)
+	if err != nil {
+		return fmt.Errorf("failed to import audit log %s after %d entries: %w", path, imported, err)
+	}
+	if err := os.Rename(path, path+IMPORTED_AUDIT_LOG_SUFFIX); err != nil {
+		return fmt.Errorf("failed to mark audit log %s as imported: %w", path, err)
+	}
+	slog.InfoContext(ctx, "Imported audit log into storage", "path", path, "entries", imported)
+	return nil
+}
+
+// webhooksFromEnvironment reads the webhook settings. Webhooks are off
+// when WEBHOOK_URL is not set.
+func webhooksFromEnvironment() (*webhooks.Dispatcher, error) {
+	url := os.Getenv("WEBHOOK_URL")
+	if url == "" {
+		return nil, nil
+	}
+	config := webhooks.Config{
+		URL: url,
+		Secret: os.Getenv("WEBHOOK_SECRET"),
+		Directory: os.Getenv("WEBHOOK_QUEUE"),
+	}
+	if types := os.Getenv("WEBHOOK_EVENTS"); types != "" {
+		for _, eventType := range strings.Split(types, ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" {
+				config.Events = append(config.Events, eventType)
+			}
+		}
+	}
+	if attempts := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); attempts != "" {
+		count, err := strconv.Atoi(attempts)
+		if err != nil || count < 1 {
+			return nil, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS %q", attempts)
+		}
+		config.MaxAttempts = count
+	}
+	return webhooks.NewDispatcher(config)
+}
+
+// newRouter selects the routing backend. The Ingress backend is used when
+// none is configured.
+func newRouter(backend string, client *k8sclient.Client) (routing.Router, error) {
+	switch backend {
+	case "", routing.BACKEND_INGRESS:
+		return ingress.NewIngressManager(client), nil
+	case routing.BACKEND_NGINX:
+		options := deployments.NginxOptions{Image: os.Getenv("ROUTER_IMAGE")}
+		if replicas := os.Getenv("ROUTER_REPLICAS"); replicas != "" {
+			count, err := strconv.ParseInt(replicas, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ROUTER_REPLICAS %q: %w", replicas, err)
+			}
+			options.Replicas = int32(count)
+		}
+		if delay := os.Getenv("ROUTER_ROLLOUT_DELAY"); delay != "" {
+			duration, err := time.ParseDuration(delay)
+			if err != nil || duration <= 0 {
+				return nil, fmt.Errorf("invalid ROUTER_ROLLOUT_DELAY %q", delay)
+			}
+			options.RolloutDelay = duration
+		}
+		return proxymanager.NewProxyManager(client, options), nil
+	case routing.BACKEND_GATEWAY:
+		return gateway.NewHTTPRouteManager(client, gateway.Config{
+			GatewayName:      os.Getenv("GATEWAY_NAME"),
+			GatewayNamespace: os.Getenv("GATEWAY_NAMESPACE"),
+			Scope:            os.Getenv("GATEWAY_ROUTE_SCOPE"),
+			Hostname:         os.Getenv("GATEWAY_HOSTNAME"),
+			MatchHost:        os.Getenv("GATEWAY_MATCH_HOST") == "true",
+			Timeout:          os.Getenv("GATEWAY_TIMEOUT"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown router backend %q", backend)
+	}
+}
+
+// kubernetesConfigFromEnvironment reads the cluster connection settings.
+// KUBECONFIG itself is read by client-go.
+func kubernetesConfigFromEnvironment() (k8sclient.ClientConfig, error) {
+	config := k8sclient.ClientConfig{Context: os.Getenv("KUBE_CONTEXT")}
+	if qps := os.Getenv("KUBE_QPS"); qps != "" {
+		value, err := strconv.ParseFloat(qps, 32)
+		if err != nil {
+			return config, fmt.Errorf("invalid KUBE_QPS %q: %w", qps, err)
+		}
+		config.QPS = float32(value)
+	}
+	if burst := os.Getenv("KUBE_BURST"); burst != "" {
+		value, err := strconv.Atoi(burst)
+		if err != nil {
+			return config, fmt.Errorf("invalid KUBE_BURST %q: %w", burst, err)
+		}
+		config.Burst = value
+	}
+
+	timeouts := k8sclient.DEFAULT_TIMEOUTS
+	for name, timeout := range map[string]*time.Duration{
+		"KUBE_TIMEOUT": &timeouts.Request,
+		"KUBE_LOAD_BALANCER_TIMEOUT": &timeouts.LoadBalancer,
+	} {
+		if value := os.Getenv(name); value != "" {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return config, fmt.Errorf("invalid %s %q: %w", name, value, err)
+			}
+			*timeout = duration
+		}
+	}
+	config.Timeouts = &timeouts
+	return config, nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/naming"
+	"github.com/BradleyLewis08/HiVE/internal/quota"
+	"github.com/go-chi/chi/v5"
+)
+
+func (s *Server) getCourseQuota(w http.ResponseWriter, r *http.Request) {
+	courseName, err := naming.Sanitize(chi.URLParam(r, "course"))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "Invalid course: "+err.Error())
+		return
+	}
+	s.writeCourseQuota(r.Context(), w, courseName)
+}
+
+func (s *Server) setCourseQuota(w http.ResponseWriter, r *http.Request) {
+	var quotaReq api.CourseQuota
+
+	if err := json.NewDecoder(r.Body).Decode(&quotaReq); err != nil {
+		writeProblem(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	if err := quota.Validate(quotaReq.MaxEnvironments); err != nil {
+		writeProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	courseName, err := naming.Sanitize(chi.URLParam(r, "course"))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "Invalid course: "+err.Error())
+		return
+	}
+	if err := s.quotas.Set(r.Context(), courseName, quotaReq.MaxEnvironments); err != nil {
+		writeError(r.Context(), w, err, "Failed to set quota")
+		return
+	}
+
+	s.writeCourseQuota(r.Context(), w, courseName)
+}
+
+func (s *Server) writeCourseQuota(ctx context.Context, w http.ResponseWriter, courseName string) {
+	environments, err := s.courseEnvironments(ctx, courseName)
+
+	if err != nil {
+		writeError(ctx, w, err, "Failed to list environments")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, api.CourseQuota{
+		CourseName: courseName,
+		MaxEnvironments: s.quotas.Get(courseName),
+		Environments: len(environments),
+	})
+}
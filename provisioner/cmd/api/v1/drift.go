@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/audit"
+	"github.com/BradleyLewis08/HiVE/internal/drift"
+	"github.com/BradleyLewis08/HiVE/internal/events"
+	"github.com/BradleyLewis08/HiVE/internal/metrics"
+	k8sProvisioner "github.com/BradleyLewis08/HiVE/internal/provisioner"
+	"github.com/BradleyLewis08/HiVE/internal/routing"
+	"github.com/BradleyLewis08/HiVE/internal/storage"
+)
+
+// Time between drift checks when nothing changes. Watched objects trigger a
+// check as soon as they change, so this only catches drift the watches
+// cannot see, such as on routers that are not watched.
+const DEFAULT_DRIFT_INTERVAL = 5 * time.Minute
+
+// How long drift must last before it is repaired, so that an environment a
+// request is still creating, changing or deleting is left to the request
+const DEFAULT_DRIFT_GRACE_PERIOD = time.Minute
+
+// How long a check waits after a watched change, so that a burst of
+// changes is checked once
+const DRIFT_DEBOUNCE = 2 * time.Second
+
+// driftState is the live state gathered by the watches, and the drift
+// carried from one check to the next.
+type driftState struct {
+	mu sync.Mutex
+	// Nil until the backend's watch has synced
+	inventory *k8sProvisioner.Inventory
+	// Nil until the router's watch has synced
+	routes []address.Address
+	// Drift left by the last check, by key
+	outstanding map[string]drift.Drift
+	report api.DriftReport
+	// Signalled when a watch sees a change
+	changed chan struct{}
+}
+
+func newDriftState() *driftState {
+	return &driftState{
+		outstanding: make(map[string]drift.Drift),
+		report:      api.DriftReport{Drift: []drift.Drift{}, Repaired: []drift.Drift{}},
+		changed:     make(chan struct{}, 1),
+	}
+}
+
+func (d *driftState) signal() {
+	select {
+	case d.changed <- struct{}{}:
+	default:
+	}
+}
+
+// detectDrift watches the backend's environments and the router's routes,
+// where they can be watched, and checks them against the desired
+// environments whenever they change and every drift interval, until ctx is
+// done.
+func (s *Server) detectDrift(ctx context.Context) {
+	if watcher, ok := s.environments.(k8sProvisioner.InventoryWatcher); ok {
+		go func() {
+			err := watcher.WatchInventory(ctx, func(inventory k8sProvisioner.Inventory) {
+				s.drift.mu.Lock()
+				s.drift.inventory = &inventory
+				s.drift.mu.Unlock()
+				s.drift.signal()
+			})
+			if err != nil && ctx.Err() == nil {
+				slog.Error("Environment drift watch stopped", "error", err)
+			}
+		}()
+	}
+	if observer, ok := s.router.(routing.Observer); ok {
+		go func() {
+			err := observer.WatchRoutes(ctx, func(routes []address.Address) {
+				s.drift.mu.Lock()
+				s.drift.routes = routes
+				s.drift.mu.Unlock()
+				s.drift.signal()
+			})
+			if err != nil && ctx.Err() == nil {
+				slog.Error("Route drift watch stopped", "error", err)
+			}
+		}()
+	}
+
+	go func() {
+		next := time.NewTimer(s.driftInterval)
+		defer next.Stop()
+		var debounce <-chan time.Time
+		// Backends that are not watched are checked straight away
+		s.drift.signal()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.drift.changed:
+				if debounce == nil {
+					debounce = time.After(DRIFT_DEBOUNCE)
+				}
+				continue
+			case <-debounce:
+				debounce = nil
+			case <-next.C:
+			}
+			next.Reset(s.checkDrift(ctx))
+		}
+	}()
+}
+
+// checkDrift detects drift and repairs what it can. Drift is only repaired
+// once it has lasted the grace period; drift the reconciler cannot repair,
+// and repairs that fail, are published as events. It returns how long to
+// wait before the next check.
+func (s *Server) checkDrift(ctx context.Context) time.Duration {
+	ctx = audit.WithActor(ctx, RECONCILER_ACTOR)
+	now := time.Now().UTC()
+	wait := s.driftInterval
+
+	desired, inventory, routes, err := s.driftInputs(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to check drift", "error", err)
+		s.drift.mu.Lock()
+		s.drift.report.Error = err.Error()
+		s.drift.mu.Unlock()
+		return wait
+	}
+	if inventory == nil {
+		// The watch has not synced yet, and signals when it has
+		return wait
+	}
+
+	found := drift.Detect(desired, *inventory, routes)
+	outstanding := make(map[string]drift.Drift, len(found))
+	repaired := []drift.Drift{}
+	restored := make(map[address.Address]error)
+	var job *storage.Job
+	var failures []error
+
+	for _, d := range found {
+		previous, seen := s.drift.outstanding[d.Key()]
+		d.Since = now
+		if seen {
+			d.Since = previous.Since
+			d.Error = previous.Error
+		} else {
+			metrics.DriftDetected.WithLabelValues(d.Kind).Inc()
+			slog.WarnContext(ctx, "Detected drift", "environment", d.Environment, "kind", d.Kind, "detail", d.Detail)
+		}
+
+		if !d.Repairable {
+			if !seen {
+				s.publishEvent(events.EVENT_DRIFT, d.Environment, d.Kind, d.Detail)
+			}
+			outstanding[d.Key()] = d
+			continue
+		}
+		if remaining := d.Since.Add(s.driftGracePeriod).Sub(now); remaining > 0 {
+			wait = min(wait, remaining)
+			outstanding[d.Key()] = d
+			continue
+		}
+
+		if job == nil {
+			var started storage.Job
+			ctx, started = s.startJob(ctx, nil, storage.JOB_KIND_RECONCILE, "")
+			job = &started
+		}
+		err := s.repairDrift(ctx, d, desired[d.Environment], restored)
+		if err != nil {
+			metrics.DriftRepairs.WithLabelValues(d.Kind, metrics.OUTCOME_FAILED).Inc()
+			slog.ErrorContext(ctx, "Failed to repair drift", "environment", d.Environment, "kind", d.Kind, "error", err)
+			if d.Error == "" {
+				s.publishEvent(events.EVENT_DRIFT, d.Environment, d.Kind, err.Error())
+			}
+			d.Error = err.Error()
+			outstanding[d.Key()] = d
+			failures = append(failures, err)
+			continue
+		}
+		metrics.DriftRepairs.WithLabelValues(d.Kind, metrics.OUTCOME_REPAIRED).Inc()
+		slog.InfoContext(ctx, "Repaired drift", "environment", d.Environment, "kind", d.Kind)
+		d.Error = ""
+		repaired = append(repaired, d)
+	}
+	if job != nil {
+		s.finishJob(ctx, *job, errors.Join(failures...))
+	}
+
+	report := api.DriftReport{CheckedAt: &now, Drift: []drift.Drift{}, Repaired: repaired}
+	metrics.DriftUnrepaired.Reset()
+	for _, d := range found {
+		if remaining, ok := outstanding[d.Key()]; ok {
+			report.Drift = append(report.Drift, remaining)
+			if !remaining.Repairable || remaining.Error != "" {
+				metrics.DriftUnrepaired.WithLabelValues(remaining.Kind).Inc()
+			}
+		}
+	}
+	metrics.DriftLastCheck.Set(float64(now.Unix()))
+
+	s.drift.mu.Lock()
+	s.drift.outstanding = outstanding
+	s.drift.report = report
+	s.drift.mu.Unlock()
+	return wait
+}
+
+// driftInputs reads the desired environments from storage and the live
+// state from the watches, or from the backend and router when they are not
+// watched. The inventory is nil while a watch has not synced, and routes
+// are nil when they cannot be checked.
+func (s *Server) driftInputs(ctx context.Context) (map[address.Address]deployments.EnvironmentOptions, *k8sProvisioner.Inventory, []address.Address, error) {
+	records, err := s.storage.ListEnvironments(ctx)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to list desired environments: %w", err)
+	}
+	desired := make(map[address.Address]deployments.EnvironmentOptions, len(records))
+	for _, record := range records {
+		desired[record.Address] = record.Options
+	}
+
+	s.drift.mu.Lock()
+	inventory, routes := s.drift.inventory, s.drift.routes
+	s.drift.mu.Unlock()
+
+	if _, watched := s.environments.(k8sProvisioner.InventoryWatcher); !watched {
+		live, err := s.environments.ListEnvironmentOptions(ctx, k8sProvisioner.ENVIRONMENT_LABEL_SELECTOR)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to list environments: %w", err)
+		}
+		// Only environments with all of their objects are listed
+		inventory = &k8sProvisioner.Inventory{Deployments: live, Services: make(map[address.Address]bool, len(live))}
+		for environment := range live {
+			inventory.Services[environment] = true
+		}
+	}
+	if _, watched := s.router.(routing.Observer); !watched {
+		if routes, err = s.router.ListRoutes(ctx); err != nil {
+			slog.WarnContext(ctx, "Failed to list routes, skipping route drift", "error", err)
+			routes = nil
+		}
+	}
+	return desired, inventory, routes, nil
+}
+
+// repairDrift undoes a single piece of drift. An environment missing both
+// of its objects is restored once, with the outcome kept in restored.
+func (s *Server) repairDrift(ctx context.Context, d drift.Drift, options deployments.EnvironmentOptions, restored map[address.Address]error) error {
+	environment := d.Environment
+	var err error
+	switch d.Kind {
+	case drift.KIND_MISSING_DEPLOYMENT, drift.KIND_MISSING_SERVICE:
+		var done bool
+		if err, done = restored[environment]; done {
+			return err
+		}
+		if restorer, ok := s.environments.(k8sProvisioner.InventoryWatcher); ok {
+			err = restorer.RestoreEnvironment(ctx, environment, options)
+		} else {
+			_, err = s.environments.ProvisionStudentEnvironment(ctx, environment.AssignmentName, environment.CourseName, environment.NetID, options)
+		}
+		restored[environment] = err
+		if err == nil {
+			s.publishEvent(events.EVENT_CREATED, environment, "", "")
+		}
+	case drift.KIND_OPTIONS:
+		err = s.environments.UpdateEnvironment(ctx, environment, options)
+	case drift.KIND_MISSING_ROUTE:
+		if err = s.router.AddRoute(ctx, environment); err == nil {
+			s.publishEvent(events.EVENT_ROUTE_ADDED, environment, "", "")
+		}
+	case drift.KIND_STALE_ROUTE:
+		if err = s.router.RemoveRoute(ctx, environment); err == nil {
+			s.publishEvent(events.EVENT_ROUTE_DELETED, environment, "", "")
+		}
+	default:
+		return fmt.Errorf("%s drift cannot be repaired", d.Kind)
+	}
+
+	parameters := map[string]string{"kind": d.Kind}
+	if d.Kind == drift.KIND_MISSING_DEPLOYMENT || d.Kind == drift.KIND_MISSING_SERVICE || d.Kind == drift.KIND_OPTIONS {
+		for key, value := range optionParameters(options) {
+			parameters[key] = value
+		}
+	}
+	s.recordAudit(ctx, audit.ACTION_REPAIR, environment, parameters, err)
+	return err
+}
+
+/* Reports the drift left by the last check: drift that cannot be repaired,
+*  repairs that failed, and drift still within its grace period. Drift
+*  repaired by that check is listed separately.
+*/
+func (s *Server) getDrift(w http.ResponseWriter, r *http.Request) {
+	s.drift.mu.Lock()
+	report := s.drift.report
+	s.drift.mu.Unlock()
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,557 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/audit"
+	"github.com/BradleyLewis08/HiVE/internal/events"
+	"github.com/BradleyLewis08/HiVE/internal/logging"
+	"github.com/BradleyLewis08/HiVE/internal/metrics"
+	"github.com/BradleyLewis08/HiVE/internal/naming"
+	k8sProvisioner "github.com/BradleyLewis08/HiVE/internal/provisioner"
+	"github.com/BradleyLewis08/HiVE/internal/storage"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/util/exec"
+)
+
+/* Creates an envvironment for this particular assignment and course, 
+*  for each student in the request
+*/
+func (s *Server) createEnvironment(w http.ResponseWriter, r *http.Request) {
+	var envReq api.EnvironmentProvisionRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&envReq); err != nil {
+		writeProblem(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	if err := validateProvisionRequest(envReq); err != nil {
+		writeProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	options, err := s.resolveOptions(envReq.Image, envReq.Template, envReq.ResourceProfile)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if envReq.DryRun {
+		s.renderEnvironments(r.Context(), w, envReq, options)
+		return
+	}
+
+	ctx, job := s.startJob(r.Context(), w, storage.JOB_KIND_ENVIRONMENTS, envReq.CourseName)
+	slog.InfoContext(ctx, "Creating environments", "course", envReq.CourseName, "assignment", envReq.AssignmentName, "count", len(envReq.NetIDs))
+
+	environments, err := s.provisionEnvironments(ctx, envReq.AssignmentName, envReq.CourseName, options, envReq.NetIDs)
+	s.finishJob(ctx, job, err)
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to create environments")
+		return
+	}
+	response := api.EnvironmentList{Environments: environments}
+
+	slog.InfoContext(ctx, "Created environments", "count", len(environments))
+
+	status := http.StatusCreated
+	if r.URL.Query().Get("wait") == "true" {
+		status = s.waitForEnvironments(ctx, response.Environments)
+	}
+
+	writeJSON(w, status, response)
+}
+
+// validateProvisionRequest rejects a request with a blank course, assignment
+// or netID, or with a name that has nothing left once sanitized.
+func validateProvisionRequest(envReq api.EnvironmentProvisionRequest) error {
+	if strings.TrimSpace(envReq.CourseName) == "" {
+		return fmt.Errorf("A courseName is required")
+	}
+	if strings.TrimSpace(envReq.AssignmentName) == "" {
+		return fmt.Errorf("An assignmentName is required")
+	}
+	for _, netID := range envReq.NetIDs {
+		if strings.TrimSpace(netID) == "" {
+			return fmt.Errorf("Every netID must be non-empty")
+		}
+		if _, err := address.Parse(envReq.AssignmentName, envReq.CourseName, netID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitForEnvironments waits up to the ready timeout for every environment
+// to become ready, recording each one's status. The response code is 201
+// once all are ready, 502 if any failed and 504 if any is still pending.
+func (s *Server) waitForEnvironments(ctx context.Context, environments []api.Environment) int {
+	ctx, cancel := context.WithTimeout(ctx, s.readyTimeout)
+	defer cancel()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := range environments {
+		wg.Add(1)
+		go func(environment *api.Environment) {
+			defer wg.Done()
+			err := s.environments.WaitForReady(ctx, environment.Address)
+
+			var failure *k8sProvisioner.FailureError
+			switch {
+			case err == nil:
+				metrics.ObservePhase(metrics.PHASE_READY, start)
+				s.publishEvent(events.EVENT_READY, environment.Address, "", "")
+				environment.Status = k8sProvisioner.STATUS_READY
+			case errors.As(err, &failure):
+				metrics.ProvisionsFailed.WithLabelValues(failure.Reason).Inc()
+				s.publishEvent(events.EVENT_FAILED, environment.Address, failure.Reason, failure.Message)
+				environment.Status = k8sProvisioner.STATUS_FAILED
+				environment.Failure = &failure.Failure
+			default:
+				if errors.Is(err, context.DeadlineExceeded) {
+					metrics.ProvisionsFailed.WithLabelValues(metrics.REASON_TIMEOUT).Inc()
+				}
+				slog.WarnContext(ctx, "Environment not ready", "environment", environment.Address, "error", err)
+				environment.Status = k8sProvisioner.STATUS_PENDING
+			}
+		}(&environments[i])
+	}
+	wg.Wait()
+
+	status := http.StatusCreated
+	for _, environment := range environments {
+		if environment.Status == k8sProvisioner.STATUS_FAILED {
+			return http.StatusBadGateway
+		}
+		if environment.Status == k8sProvisioner.STATUS_PENDING {
+			status = http.StatusGatewayTimeout
+		}
+	}
+	return status
+}
+
+// resolveOptions returns the settings to provision with. The image and
+// resource profile are taken from the named template when not given.
+func (s *Server) resolveOptions(image string, templateName string, resourceProfile string) (deployments.EnvironmentOptions, error) {
+	options := deployments.EnvironmentOptions{Image: image, ResourceProfile: resourceProfile}
+	if templateName != "" {
+		template, ok := s.templates.Get(templateName)
+		if !ok {
+			return options, fmt.Errorf("Template %s not found", templateName)
+		}
+		if options.Image == "" {
+			options.Image = template.Image
+		}
+		if options.ResourceProfile == "" {
+			options.ResourceProfile = template.ResourceProfile
+		}
+	}
+	if options.Image == "" {
+		return options, fmt.Errorf("An image or template is required")
+	}
+	if err := options.Validate(); err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+// provisionEnvironments creates and routes an environment for each netID,
+// after checking the course quota.
+func (s *Server) provisionEnvironments(ctx context.Context, assignmentName string, courseName string, options deployments.EnvironmentOptions, netIDs []string) ([]api.Environment, error) {
+	sanitizedCourse, err := naming.Sanitize(courseName)
+	if err != nil {
+		return nil, k8sProvisioner.WithKind(k8sProvisioner.ERROR_INVALID, fmt.Errorf("invalid course: %w", err))
+	}
+	existing, err := s.courseEnvironments(ctx, sanitizedCourse)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list environments: %w", err)
+	}
+
+	err = s.quotas.Check(sanitizedCourse, len(existing), len(netIDs))
+	if err != nil {
+		return nil, err
+	}
+
+	environments := []api.Environment{}
+
+	// Provision environment for each student (NetID)
+	for _, netID := range netIDs {
+		environment, err := s.provisionEnvironment(ctx, assignmentName, courseName, netID, options)
+		if err != nil {
+			return nil, err
+		}
+		environments = append(environments, environment)
+	}
+	return environments, nil
+}
+
+// provisionEnvironment records a single environment as desired, creates it
+// and exposes it through the active router. An environment that could not
+// be created is no longer desired, unless it already was.
+func (s *Server) provisionEnvironment(ctx context.Context, assignmentName string, courseName string, netID string, options deployments.EnvironmentOptions) (api.Environment, error) {
+	requested := address.New(assignmentName, courseName, netID)
+	_, existed, err := s.storage.GetEnvironment(ctx, requested)
+	if err != nil {
+		return api.Environment{}, fmt.Errorf("failed to read desired environment %s: %w", requested, err)
+	}
+	if err := s.storeEnvironment(ctx, requested, options); err != nil {
+		return api.Environment{}, err
+	}
+
+	environment, err := s.environments.ProvisionStudentEnvironment(
+		ctx,
+		assignmentName,
+		courseName,
+		netID,
+		options,
+	)
+	if err != nil {
+		metrics.ProvisionsFailed.WithLabelValues(k8sProvisioner.ErrorKind(err)).Inc()
+		s.recordAudit(ctx, audit.ACTION_CREATE, requested, optionParameters(options), err)
+		if !existed {
+			if err := s.storage.DeleteEnvironment(ctx, requested); err != nil {
+				slog.ErrorContext(ctx, "Failed to forget environment that was not created", "environment", requested, "error", err)
+			}
+		}
+		return api.Environment{}, fmt.Errorf("failed to create environment for %s: %w", netID, err)
+	}
+
+	s.publishEvent(events.EVENT_CREATED, environment, "", "")
+
+	// Expose environment through the active router
+	start := time.Now()
+	err = s.router.AddRoute(ctx, environment)
+
+	if err != nil {
+		metrics.ProvisionsFailed.WithLabelValues(k8sProvisioner.ErrorKind(err)).Inc()
+		err = fmt.Errorf("failed to add route for %s: %w", environment, err)
+		s.recordAudit(ctx, audit.ACTION_CREATE, environment, optionParameters(options), err)
+		return api.Environment{}, err
+	}
+	metrics.ObservePhase(metrics.PHASE_ROUTE, start)
+	metrics.ProvisionsSucceeded.Inc()
+	s.publishEvent(events.EVENT_ROUTE_ADDED, environment, "", "")
+	s.recordAudit(ctx, audit.ACTION_CREATE, environment, optionParameters(options), nil)
+
+	return s.environmentResponse(environment), nil
+}
+
+func (s* Server) deleteEnvironment(w http.ResponseWriter, r* http.Request) {
+	var envDeleteReq api.EnvironmentDeleteRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&envDeleteReq); err != nil {
+		writeProblem(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	environment := address.New(envDeleteReq.AssignmentName, envDeleteReq.CourseName, envDeleteReq.NetID)
+	s.removeEnvironment(r.Context(), w, environment)
+}
+
+func (s *Server) deleteEnvironmentByAddress(w http.ResponseWriter, r *http.Request) {
+	s.removeEnvironment(r.Context(), w, addressFromURL(r))
+}
+
+func (s *Server) removeEnvironment(ctx context.Context, w http.ResponseWriter, environment address.Address) {
+	if err := s.teardownEnvironment(ctx, environment); err != nil {
+		writeError(ctx, w, err, "Failed to delete environment")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// teardownEnvironment stops desiring the environment, then removes its
+// route and the environment itself. The environment is deleted even when
+// its route could not be removed; anything left behind is no longer
+// desired, and is deleted by the garbage collector.
+func (s *Server) teardownEnvironment(ctx context.Context, environment address.Address) error {
+	err := s.storage.DeleteEnvironment(ctx, environment)
+	if err != nil {
+		err = fmt.Errorf("failed to forget desired environment: %w", err)
+		s.recordAudit(ctx, audit.ACTION_DELETE, environment, nil, err)
+		return err
+	}
+
+	routeErr := s.router.RemoveRoute(ctx, environment)
+	if routeErr != nil {
+		routeErr = fmt.Errorf("failed to remove route: %w", routeErr)
+	} else {
+		s.publishEvent(events.EVENT_ROUTE_DELETED, environment, "", "")
+	}
+
+	deleteErr := s.environments.DeleteEnvironment(ctx, environment)
+	if deleteErr == nil {
+		s.publishEvent(events.EVENT_DELETED, environment, "", "")
+	}
+
+	// A route without an environment is still worth removing, but NotFound
+	// is only reported when there was nothing to delete
+	if routeErr != nil && k8sProvisioner.ErrorKind(deleteErr) == k8sProvisioner.ERROR_NOT_FOUND {
+		deleteErr = nil
+	}
+	err = errors.Join(routeErr, deleteErr)
+	s.recordAudit(ctx, audit.ACTION_DELETE, environment, nil, err)
+	if err != nil {
+		return err
+	}
+
+	slog.InfoContext(ctx, "Deleted environment", "environment", environment)
+	return nil
+}
+
+// updateEnvironment changes the image and resource profile of an
+// environment.
+func (s *Server) updateEnvironment(ctx context.Context, environment address.Address, options deployments.EnvironmentOptions) error {
+	err := s.environments.UpdateEnvironment(ctx, environment, options)
+	if err == nil {
+		err = s.storeEnvironment(ctx, environment, options)
+	}
+	s.recordAudit(ctx, audit.ACTION_UPDATE, environment, optionParameters(options), err)
+	return err
+}
+
+// storeEnvironment records the options an environment should run with,
+// along with the job that set them.
+func (s *Server) storeEnvironment(ctx context.Context, environment address.Address, options deployments.EnvironmentOptions) error {
+	record, ok, err := s.storage.GetEnvironment(ctx, environment)
+	if err != nil {
+		return fmt.Errorf("failed to read desired environment %s: %w", environment, err)
+	}
+	now := time.Now().UTC()
+	if !ok {
+		record = storage.Environment{Address: environment, CreatedAt: now}
+	}
+	record.Options = options
+	record.JobID = logging.JobID(ctx)
+	record.UpdatedAt = now
+	if err := s.storage.PutEnvironment(ctx, record); err != nil {
+		return fmt.Errorf("failed to record desired environment %s: %w", environment, err)
+	}
+	return nil
+}
+
+// optionParameters describes the settings an environment was given, for
+// the audit log.
+func optionParameters(options deployments.EnvironmentOptions) map[string]string {
+	parameters := map[string]string{"image": options.Image}
+	if options.ResourceProfile != "" {
+		parameters["resourceProfile"] = options.ResourceProfile
+	}
+	return parameters
+}
+
+// listEnvironments lists provisioned environments, optionally filtered by
+// the course, assignment and netID query parameters.
+func (s *Server) listEnvironments(w http.ResponseWriter, r *http.Request) {
+	environments, err := s.environments.ListEnvironments(r.Context())
+
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to list environments")
+		return
+	}
+
+	query := r.URL.Query()
+	filter := address.Address{
+		CourseName: sanitizeFilter(query.Get("course")),
+		AssignmentName: sanitizeFilter(query.Get("assignment")),
+		NetID: sanitizeFilter(query.Get("netID")),
+	}
+
+	response := api.EnvironmentList{Environments: []api.Environment{}}
+	for _, environment := range environments {
+		if matchesFilter(environment, filter) {
+			response.Environments = append(response.Environments, s.environmentResponse(environment))
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) getEnvironment(w http.ResponseWriter, r *http.Request) {
+	environment := addressFromURL(r)
+	status, err := s.environments.EnvironmentStatus(r.Context(), environment)
+
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to get environment")
+		return
+	}
+
+	response := s.environmentResponse(environment)
+	response.Status = status.Phase
+	response.Failure = status.Failure
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) resetEnvironment(w http.ResponseWriter, r *http.Request) {
+	environment := addressFromURL(r)
+	err := s.environments.ResetEnvironment(r.Context(), environment)
+	s.recordAudit(r.Context(), audit.ACTION_RESET, environment, nil, err)
+
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to reset environment")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+/* Scales an environment down to no pods, keeping its Deployment, Service
+*  and route so that it can be resumed. Only the Kubernetes backend can
+*  hibernate environments.
+*/
+func (s *Server) hibernateEnvironment(w http.ResponseWriter, r *http.Request) {
+	hibernator, ok := s.environments.(k8sProvisioner.Hibernator)
+	if !ok {
+		writeProblem(w, http.StatusNotImplemented, "Hibernation is not available for this backend")
+		return
+	}
+	environment := addressFromURL(r)
+	err := hibernator.HibernateEnvironment(r.Context(), environment)
+	s.recordAudit(r.Context(), audit.ACTION_HIBERNATE, environment, nil, err)
+
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to hibernate environment")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// resumeEnvironment starts a hibernated environment's pod again.
+func (s *Server) resumeEnvironment(w http.ResponseWriter, r *http.Request) {
+	hibernator, ok := s.environments.(k8sProvisioner.Hibernator)
+	if !ok {
+		writeProblem(w, http.StatusNotImplemented, "Hibernation is not available for this backend")
+		return
+	}
+	environment := addressFromURL(r)
+	err := hibernator.ResumeEnvironment(r.Context(), environment)
+	s.recordAudit(r.Context(), audit.ACTION_RESUME, environment, nil, err)
+
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to resume environment")
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// environmentLogs streams the code-server logs of an environment. The
+// follow and tail query parameters behave like kubectl logs.
+func (s *Server) environmentLogs(w http.ResponseWriter, r *http.Request) {
+	options := &apiv1.PodLogOptions{Follow: r.URL.Query().Get("follow") == "true"}
+	if tail := r.URL.Query().Get("tail"); tail != "" {
+		lines, err := strconv.ParseInt(tail, 10, 64)
+		if err != nil {
+			writeProblem(w, http.StatusBadRequest, "Invalid tail")
+			return
+		}
+		options.TailLines = &lines
+	}
+
+	logs, err := s.environments.StreamLogs(r.Context(), addressFromURL(r), options)
+
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to get environment logs")
+		return
+	}
+	defer logs.Close()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	flusher, _ := w.(http.Flusher)
+	buffer := make([]byte, 4096)
+	for {
+		n, err := logs.Read(buffer)
+		if n > 0 {
+			w.Write(buffer[:n])
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				slog.WarnContext(r.Context(), "Error streaming logs", "error", err)
+			}
+			return
+		}
+	}
+}
+
+func (s *Server) execEnvironment(w http.ResponseWriter, r *http.Request) {
+	var execReq api.ExecRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&execReq); err != nil || len(execReq.Command) == 0 {
+		writeProblem(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	environment := addressFromURL(r)
+	var stdout, stderr bytes.Buffer
+	err := s.environments.Exec(r.Context(), environment, execReq.Command, &stdout, &stderr)
+
+	// A command that ran and exited non-zero still ran
+	var exitErr exec.ExitError
+	var recorded error
+	if !errors.As(err, &exitErr) {
+		recorded = err
+	}
+	s.recordAudit(r.Context(), audit.ACTION_EXEC, environment, map[string]string{"command": strings.Join(execReq.Command, " ")}, recorded)
+
+	response := api.ExecResponse{}
+	if errors.As(err, &exitErr) {
+		response.ExitCode = exitErr.ExitStatus()
+	} else if err != nil {
+		writeError(r.Context(), w, err, "Failed to exec in environment")
+		return
+	}
+
+	response.Stdout = stdout.String()
+	response.Stderr = stderr.String()
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) courseEnvironments(ctx context.Context, courseName string) ([]address.Address, error) {
+	environments, err := s.environments.ListEnvironments(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var matching []address.Address
+	for _, environment := range environments {
+		if environment.CourseName == courseName {
+			matching = append(matching, environment)
+		}
+	}
+	return matching, nil
+}
+
+// sanitizeFilter sanitizes a filter value the way environments are labeled.
+// A value with nothing to sanitize is kept as it is, so it matches nothing.
+func sanitizeFilter(value string) string {
+	sanitized, err := naming.Sanitize(value)
+	if err != nil {
+		return value
+	}
+	return sanitized
+}
+
+func matchesFilter(environment address.Address, filter address.Address) bool {
+	return (filter.CourseName == "" || filter.CourseName == environment.CourseName) &&
+		(filter.AssignmentName == "" || filter.AssignmentName == environment.AssignmentName) &&
+		(filter.NetID == "" || filter.NetID == environment.NetID)
+}
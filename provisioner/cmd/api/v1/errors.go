@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	k8sProvisioner "github.com/BradleyLewis08/HiVE/internal/provisioner"
+)
+
+var ERROR_STATUS = map[string]int{
+	k8sProvisioner.ERROR_NOT_FOUND:      http.StatusNotFound,
+	k8sProvisioner.ERROR_CONFLICT:       http.StatusConflict,
+	k8sProvisioner.ERROR_INVALID:        http.StatusBadRequest,
+	k8sProvisioner.ERROR_QUOTA_EXCEEDED: http.StatusForbidden,
+	k8sProvisioner.ERROR_UNAVAILABLE:    http.StatusServiceUnavailable,
+	k8sProvisioner.ERROR_INTERNAL:       http.StatusInternalServerError,
+}
+
+// writeError answers with a problem document for err, with the status code
+// of its kind. The error itself is only shown to the caller when it is the
+// caller's to fix; otherwise it is logged and message stands alone.
+func writeError(ctx context.Context, w http.ResponseWriter, err error, message string) {
+	kind := k8sProvisioner.ErrorKind(err)
+	status := ERROR_STATUS[kind]
+
+	detail := message
+	if status < http.StatusInternalServerError {
+		detail = message + ": " + err.Error()
+	} else {
+		slog.ErrorContext(ctx, message, "error", err)
+	}
+
+	writeProblemDocument(w, api.Problem{
+		Type:   api.PROBLEM_TYPE_PREFIX + kind,
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	})
+}
+
+// writeProblem answers with a problem document that carries no more
+// meaning than its status code.
+func writeProblem(w http.ResponseWriter, status int, detail string) {
+	writeProblemDocument(w, api.Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+	})
+}
+
+func writeProblemDocument(w http.ResponseWriter, problem api.Problem) {
+	w.Header().Set("Content-Type", api.PROBLEM_CONTENT_TYPE)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(problem.Status)
+	json.NewEncoder(w).Encode(problem)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/events"
+	"github.com/gorilla/websocket"
+)
+
+// How often idle event streams are kept alive, so that proxies do not close
+// them
+const EVENT_HEARTBEAT_INTERVAL = 15 * time.Second
+
+// How long a WebSocket write, including a ping, may block
+const WEBSOCKET_WRITE_TIMEOUT = 10 * time.Second
+
+var upgrader = websocket.Upgrader{}
+
+// watchEvents publishes the backend's own view of its environments until
+// ctx is done. Backends that cannot be watched only have the events the API
+// publishes as it makes changes.
+func (s *Server) watchEvents(ctx context.Context) {
+	watcher, ok := s.environments.(events.Watcher)
+	if !ok {
+		return
+	}
+	go func() {
+		if err := watcher.WatchEvents(ctx, s.events); err != nil && ctx.Err() == nil {
+			slog.Error("Environment event watch stopped", "error", err)
+		}
+	}()
+}
+
+// publishEvent publishes an event about a change the API has made. Events
+// the backend's watch will report are only published here for backends that
+// cannot be watched.
+func (s *Server) publishEvent(eventType string, environment address.Address, reason string, message string) {
+	switch eventType {
+	case events.EVENT_ROUTE_ADDED, events.EVENT_ROUTE_DELETED, events.EVENT_DRIFT:
+	default:
+		if _, watched := s.environments.(events.Watcher); watched {
+			return
+		}
+	}
+	s.events.Publish(events.Event{Type: eventType, Environment: environment, Reason: reason, Message: message})
+}
+
+/* Streams environment events as Server-Sent Events. Query parameters:
+*  course, assignment, netID and type (repeatable, or comma separated).
+*  A client reconnecting with Last-Event-ID, or the after parameter, first
+*  receives the events it missed.
+*/
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	filter, after, err := eventFilter(r)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeProblem(w, http.StatusInternalServerError, "Streaming is not supported")
+		return
+	}
+
+	subscription := s.events.Subscribe(filter, after)
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// Stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(EVENT_HEARTBEAT_INTERVAL)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case event, ok := <-subscription.Events():
+			if !ok {
+				// Too far behind; the client reconnects with Last-Event-ID
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+		}
+		flusher.Flush()
+	}
+}
+
+// websocketEvents streams the same events as streamEvents over a
+// WebSocket, one JSON event per text message.
+func (s *Server) websocketEvents(w http.ResponseWriter, r *http.Request) {
+	filter, after, err := eventFilter(r)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// The upgrader has already answered the request
+		return
+	}
+	defer conn.Close()
+
+	subscription := s.events.Subscribe(filter, after)
+	defer subscription.Close()
+
+	// Clients send nothing, but reading processes pings and notices a close
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	heartbeat := time.NewTicker(EVENT_HEARTBEAT_INTERVAL)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WEBSOCKET_WRITE_TIMEOUT)); err != nil {
+				return
+			}
+		case event, ok := <-subscription.Events():
+			if !ok {
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "subscriber fell behind"),
+					time.Now().Add(WEBSOCKET_WRITE_TIMEOUT))
+				return
+			}
+			conn.SetWriteDeadline(time.Now().Add(WEBSOCKET_WRITE_TIMEOUT))
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func eventFilter(r *http.Request) (events.Filter, int64, error) {
+	query := r.URL.Query()
+	filter := events.Filter{
+		Environment: address.Address{
+			CourseName:     sanitizeFilter(query.Get("course")),
+			AssignmentName: sanitizeFilter(query.Get("assignment")),
+			NetID:          sanitizeFilter(query.Get("netID")),
+		},
+	}
+	for _, value := range query["type"] {
+		for _, eventType := range strings.Split(value, ",") {
+			if eventType = strings.TrimSpace(eventType); eventType != "" {
+				if filter.Types == nil {
+					filter.Types = make(map[string]bool)
+				}
+				filter.Types[eventType] = true
+			}
+		}
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = query.Get("after")
+	}
+	var after int64
+	if lastID != "" {
+		var err error
+		if after, err = strconv.ParseInt(lastID, 10, 64); err != nil {
+			return filter, 0, fmt.Errorf("Invalid last event ID %q", lastID)
+		}
+	}
+	return filter, after, nil
+}
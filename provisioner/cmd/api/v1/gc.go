@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/audit"
+	"github.com/BradleyLewis08/HiVE/internal/events"
+	"github.com/BradleyLewis08/HiVE/internal/gc"
+	"github.com/BradleyLewis08/HiVE/internal/metrics"
+	k8sProvisioner "github.com/BradleyLewis08/HiVE/internal/provisioner"
+	"github.com/BradleyLewis08/HiVE/internal/storage"
+)
+
+// Recorded as the actor of deletions made by the garbage collector
+const GC_ACTOR = "garbage-collector"
+
+// Time between garbage collection sweeps
+const DEFAULT_GC_INTERVAL = 10 * time.Minute
+
+// How long an object must stay orphaned before it is deleted. Orphans
+// include environments running without being desired, so this leaves time
+// to notice one deleted from storage by mistake and adopt it again.
+const DEFAULT_GC_GRACE_PERIOD = 24 * time.Hour
+
+// gcState holds when each orphan was first found. It is kept in memory, so
+// the grace period starts over when the provisioner restarts.
+type gcState struct {
+	// Held for a whole sweep, so that sweeps do not overlap
+	mu        sync.Mutex
+	firstSeen map[string]time.Time
+}
+
+func newGCState() *gcState {
+	return &gcState{firstSeen: make(map[string]time.Time)}
+}
+
+// collectGarbage sweeps every garbage collection interval until ctx is
+// done, starting straight away so that the grace period of existing
+// orphans starts with the provisioner.
+func (s *Server) collectGarbage(ctx context.Context) {
+	ctx = audit.WithActor(ctx, GC_ACTOR)
+	go func() {
+		ticker := time.NewTicker(s.gcInterval)
+		defer ticker.Stop()
+		for {
+			if _, err := s.sweepGarbage(ctx, s.gcDryRun); err != nil {
+				slog.ErrorContext(ctx, "Failed to collect garbage", "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// sweepGarbage finds objects whose environment is not desired and deletes
+// those that have been orphaned for the grace period. A dry run only
+// reports them, though it still starts their grace period.
+func (s *Server) sweepGarbage(ctx context.Context, dryRun bool) (api.GCReport, error) {
+	s.gc.mu.Lock()
+	defer s.gc.mu.Unlock()
+
+	report, err := s.findGarbage(ctx)
+	if err != nil {
+		return api.GCReport{}, err
+	}
+	report.DryRun = dryRun
+
+	firstSeen := make(map[string]time.Time, len(report.Orphans))
+	remaining := []gc.Orphan{}
+	var job *storage.Job
+	var failures []error
+	for _, orphan := range report.Orphans {
+		firstSeen[orphan.Key()] = orphan.FirstSeen
+		if _, seen := s.gc.firstSeen[orphan.Key()]; !seen {
+			slog.WarnContext(ctx, "Found orphaned object", "kind", orphan.Kind, "name", orphan.Name, "environment", orphan.Environment, "deleteAfter", orphan.DeleteAfter)
+		}
+		if dryRun || report.SweptAt.Before(orphan.DeleteAfter) {
+			remaining = append(remaining, orphan)
+			continue
+		}
+
+		if job == nil {
+			var started storage.Job
+			ctx, started = s.startJob(ctx, nil, storage.JOB_KIND_GC, "")
+			job = &started
+		}
+		if err := s.deleteOrphan(ctx, orphan.Object); err != nil {
+			metrics.GCDeletions.WithLabelValues(orphan.Kind, metrics.OUTCOME_FAILED).Inc()
+			slog.ErrorContext(ctx, "Failed to delete orphaned object", "kind", orphan.Kind, "name", orphan.Name, "error", err)
+			orphan.Error = err.Error()
+			remaining = append(remaining, orphan)
+			failures = append(failures, err)
+			continue
+		}
+		metrics.GCDeletions.WithLabelValues(orphan.Kind, metrics.OUTCOME_DELETED).Inc()
+		slog.InfoContext(ctx, "Deleted orphaned object", "kind", orphan.Kind, "name", orphan.Name, "environment", orphan.Environment)
+		delete(firstSeen, orphan.Key())
+		report.Deleted = append(report.Deleted, orphan)
+	}
+	if job != nil {
+		s.finishJob(ctx, *job, errors.Join(failures...))
+	}
+	report.Orphans = remaining
+
+	s.gc.firstSeen = firstSeen
+	metrics.GCOrphans.Reset()
+	for _, orphan := range remaining {
+		metrics.GCOrphans.WithLabelValues(orphan.Kind).Inc()
+	}
+	slog.InfoContext(ctx, "Collected garbage", "orphans", len(remaining), "deleted", len(report.Deleted), "dryRun", dryRun)
+	return report, nil
+}
+
+// findGarbage lists the orphaned objects, and when each was first found
+// and will be deleted, without changing anything.
+func (s *Server) findGarbage(ctx context.Context) (api.GCReport, error) {
+	now := time.Now().UTC()
+	records, err := s.storage.ListEnvironments(ctx)
+	if err != nil {
+		return api.GCReport{}, fmt.Errorf("failed to list desired environments: %w", err)
+	}
+	desired := make(map[address.Address]bool, len(records))
+	for _, record := range records {
+		desired[record.Address] = true
+	}
+
+	objects, err := s.environmentObjects(ctx)
+	if err != nil {
+		return api.GCReport{}, err
+	}
+
+	report := api.GCReport{SweptAt: now, DryRun: true, Orphans: gc.Find(desired, objects), Deleted: []gc.Orphan{}}
+	for i := range report.Orphans {
+		orphan := &report.Orphans[i]
+		orphan.FirstSeen = now
+		if seen, ok := s.gc.firstSeen[orphan.Key()]; ok {
+			orphan.FirstSeen = seen
+		}
+		orphan.DeleteAfter = orphan.FirstSeen.Add(s.gcGracePeriod)
+	}
+	return report, nil
+}
+
+// environmentObjects lists the objects of every environment, whole
+// environments on backends that cannot list their objects, and the routes
+// on the active router.
+func (s *Server) environmentObjects(ctx context.Context) ([]k8sProvisioner.Object, error) {
+	var objects []k8sProvisioner.Object
+	if collector, ok := s.environments.(k8sProvisioner.ObjectCollector); ok {
+		var err error
+		if objects, err = collector.ListEnvironmentObjects(ctx); err != nil {
+			return nil, fmt.Errorf("failed to list environment objects: %w", err)
+		}
+	} else {
+		environments, err := s.environments.ListEnvironments(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list environments: %w", err)
+		}
+		for _, environment := range environments {
+			objects = append(objects, k8sProvisioner.Object{Kind: gc.KIND_ENVIRONMENT, Name: environment.String(), Environment: environment})
+		}
+	}
+
+	routes, err := s.router.ListRoutes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list routes: %w", err)
+	}
+	for _, environment := range routes {
+		objects = append(objects, k8sProvisioner.Object{Kind: gc.KIND_ROUTE, Name: environment.Path(), Environment: environment})
+	}
+	return objects, nil
+}
+
+func (s *Server) deleteOrphan(ctx context.Context, object k8sProvisioner.Object) error {
+	var err error
+	switch object.Kind {
+	case gc.KIND_ROUTE:
+		if err = s.router.RemoveRoute(ctx, object.Environment); err == nil {
+			s.publishEvent(events.EVENT_ROUTE_DELETED, object.Environment, "", "")
+		}
+	case gc.KIND_ENVIRONMENT:
+		if err = s.environments.DeleteEnvironment(ctx, object.Environment); err == nil {
+			s.publishEvent(events.EVENT_DELETED, object.Environment, "", "")
+		}
+	default:
+		collector, ok := s.environments.(k8sProvisioner.ObjectCollector)
+		if !ok {
+			return fmt.Errorf("cannot delete %s %s on this backend", object.Kind, object.Name)
+		}
+		err = collector.DeleteObject(ctx, object)
+	}
+	s.recordAudit(ctx, audit.ACTION_DELETE, object.Environment, map[string]string{"kind": object.Kind, "name": object.Name}, err)
+	return err
+}
+
+/* Reports the objects the garbage collector would delete, and when, without
+*  deleting anything.
+*/
+func (s *Server) getGarbage(w http.ResponseWriter, r *http.Request) {
+	s.gc.mu.Lock()
+	report, err := s.findGarbage(r.Context())
+	s.gc.mu.Unlock()
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to find orphaned objects")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+/* Sweeps straight away, deleting orphans whose grace period has passed.
+*  With dryRun=true, or GC_DRY_RUN set, they are only reported.
+*/
+func (s *Server) sweepGarbageNow(w http.ResponseWriter, r *http.Request) {
+	dryRun := s.gcDryRun || r.URL.Query().Get("dryRun") == "true"
+	report, err := s.sweepGarbage(r.Context(), dryRun)
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to collect garbage")
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/audit"
+	"github.com/BradleyLewis08/HiVE/internal/logging"
+	"github.com/BradleyLewis08/HiVE/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// startJob starts a job of the given kind on behalf of the request, and
+// records it as running. The job ID is returned to the caller in the
+// X-Hive-Job-ID header when w is set.
+func (s *Server) startJob(ctx context.Context, w http.ResponseWriter, kind string, courseName string) (context.Context, storage.Job) {
+	ctx, id := logging.WithJob(ctx)
+	if w != nil {
+		w.Header().Set(JOB_ID_HEADER, id)
+	}
+
+	job := storage.Job{
+		ID:         id,
+		Kind:       kind,
+		Actor:      audit.Actor(ctx),
+		RequestID:  logging.RequestID(ctx),
+		CourseName: courseName,
+		Status:     storage.JOB_RUNNING,
+		StartedAt:  time.Now().UTC(),
+	}
+	// The job's changes are recorded in the audit log either way
+	if err := s.storage.PutJob(ctx, job); err != nil {
+		slog.ErrorContext(ctx, "Failed to record job", "error", err)
+	}
+	return ctx, job
+}
+
+// finishJob records the outcome of a job.
+func (s *Server) finishJob(ctx context.Context, job storage.Job, err error) {
+	finished := time.Now().UTC()
+	job.FinishedAt = &finished
+	job.Status = storage.JOB_SUCCEEDED
+	if err != nil {
+		job.Status = storage.JOB_FAILED
+		job.Error = err.Error()
+	}
+	if err := s.storage.PutJob(ctx, job); err != nil {
+		slog.ErrorContext(ctx, "Failed to record job", "error", err)
+	}
+}
+
+/* Lists jobs, most recently started first. Query parameters: kind, status,
+*  course and limit.
+*/
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			writeProblem(w, http.StatusBadRequest, fmt.Sprintf("Invalid limit %q", value))
+			return
+		}
+	}
+
+	jobs, err := s.storage.ListJobs(r.Context())
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to list jobs")
+		return
+	}
+
+	response := api.JobList{Jobs: []storage.Job{}}
+	courseName := sanitizeFilter(query.Get("course"))
+	for _, job := range jobs {
+		if (query.Get("kind") == "" || job.Kind == query.Get("kind")) &&
+			(query.Get("status") == "" || job.Status == query.Get("status")) &&
+			(courseName == "" || sanitizeFilter(job.CourseName) == courseName) {
+			response.Jobs = append(response.Jobs, job)
+		}
+		if limit > 0 && len(response.Jobs) == limit {
+			break
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	job, ok, err := s.storage.GetJob(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to get job")
+		return
+	}
+	if !ok {
+		writeProblem(w, http.StatusNotFound, "Job not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
@@ -1,152 +1,83 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
+	"os"
+	"time"
 
-	"github.com/BradleyLewis08/HiVE/internal/ingress"
-	k8sclient "github.com/BradleyLewis08/HiVE/internal/kubernetes"
-	k8sProvisioner "github.com/BradleyLewis08/HiVE/internal/provisioner"
-	utils "github.com/BradleyLewis08/HiVE/internal/utils"
-	"github.com/go-chi/chi/v5"
+	"github.com/BradleyLewis08/HiVE/internal/logging"
+	"github.com/BradleyLewis08/HiVE/internal/tracing"
 	"github.com/joho/godotenv"
 )
 
-type Server struct {
-	k8sProvisioner *k8sProvisioner.Provisioner
-	ingressManager *ingress.IngressManager
-}
-
-func NewServer() (*Server, error) {
-	client, clientInitErr := k8sclient.GetKubernetesClient()
-	provisioner := k8sProvisioner.NewProvisioner(client)
-	ingressManager := ingress.NewIngressManager(client)
-	if clientInitErr != nil {
-		return nil, clientInitErr
-	}
-
-	return &Server{k8sProvisioner: provisioner, ingressManager: ingressManager}, nil
-}
+// How long buffered spans are given to flush on exit
+const TRACING_SHUTDOWN_TIMEOUT = 5 * time.Second
 
 func main() {
 	err := godotenv.Load()
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		fatal("Error loading .env file", err)
 	}
-	server, err := NewServer()
 
+	logger, err := logging.New(os.Stderr, os.Getenv("LOG_FORMAT"), os.Getenv("LOG_LEVEL"))
 	if err != nil {
-		log.Fatalf("Error initializing server: %v", err)
+		fatal("Error configuring logging", err)
 	}
+	// Also routes the standard log package, used by dependencies
+	slog.SetDefault(logger)
 
-	server.ingressManager.ProvisionIngressController()
-
-	r := chi.NewRouter()
+	// Startup calls are bounded by the client's per-request timeouts
+	ctx := context.Background()
 
-	// Define routes
-
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("Hello World"))
+	shutdownTracing, err := tracing.Setup(ctx, tracing.Config{
+		Exporter: os.Getenv("TRACING_EXPORTER"),
+		File: os.Getenv("TRACING_FILE"),
 	})
-
-	r.Post("/environment", func(w http.ResponseWriter, r *http.Request) {
-		server.createEnvironment(w, r) 
-	})
-
-	r.Post("/environment/delete", func(w http.ResponseWriter, r *http.Request) {
-		server.deleteEnvironment(w, r)
-	})
-
-	log.Println("Starting server on :8000")
-
-	err = http.ListenAndServe(":8000", r)
-
 	if err != nil {
-		log.Fatalf("Error starting server: %v", err)
+		fatal("Error configuring tracing", err)
 	}
-}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), TRACING_SHUTDOWN_TIMEOUT)
+		defer cancel()
+		shutdownTracing(ctx)
+	}()
 
+	server, err := serverFromEnvironment(ctx)
 
-type EnvironmentProvisionRequest struct {
-	CourseName string `json:"courseName"`
-	AssignmentName string `json:"assignmentName"`
-	NetIDs   []string `json:"netIDs"`
-	Image   string   `json:"image"`
-}
-
-/* Creates an envvironment for this particular assignment and course, 
-*  for each student in the request
-*/
-func (s *Server) createEnvironment(w http.ResponseWriter, r *http.Request) {
-	var envReq EnvironmentProvisionRequest
-
-	if err := json.NewDecoder(r.Body).Decode(&envReq); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
-	}
-
-	courseName := utils.LowerCaseAndStrip(envReq.CourseName)
-	assignmentName := utils.LowerCaseAndStrip(envReq.AssignmentName)
-
-	// Provision environment for each student (NetID)
-	for _, netID := range envReq.NetIDs {
-		err := s.k8sProvisioner.ProvisionStudentEnvironment(
-			assignmentName,
-			courseName,
-			envReq.Image,
-			netID,
-		)
-		if err != nil {
-			http.Error(w, "Failed to create environment", http.StatusInternalServerError)
-			return
-		}
-
-		// Add route to ingress controller
-		err = s.ingressManager.AddRouteToIngress(
-			assignmentName,
-			courseName,
-			netID,
-		)
-
-		if err != nil {
-			http.Error(w, "Failed to add route to ingress controller", http.StatusInternalServerError)
-			return
-		}
+	if err != nil {
+		fatal("Error initializing server", err)
 	}
+	defer server.storage.Close()
 
-	fmt.Printf("Created environments for all netIDs\n")
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-}
+	err = server.router.Provision(ctx)
 
-type EnvironmentDeleteRequest struct {
-	AssignmentName string `json:"assignmentName"`
-	CourseName string `json:"courseName"`
-	NetID  string `json:"netIDs"`
-}
+	if err != nil {
+		fatal("Error provisioning router", err)
+	}
 
-func (s* Server) deleteEnvironment(w http.ResponseWriter, r* http.Request) {
-	var envDeleteReq EnvironmentDeleteRequest
+	err = server.restoreState(ctx)
 
-	if err := json.NewDecoder(r.Body).Decode(&envDeleteReq); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
-		return
+	if err != nil {
+		fatal("Error restoring state", err)
 	}
 
-	courseName := utils.LowerCaseAndStrip(envDeleteReq.CourseName)
-	assignmentName := utils.LowerCaseAndStrip(envDeleteReq.AssignmentName)
+	server.deliverWebhooks(ctx)
+	server.watchEvents(ctx)
+	server.detectDrift(ctx)
+	server.collectGarbage(ctx)
 
-	err := s.k8sProvisioner.DeleteEnvironment(assignmentName, courseName, envDeleteReq.NetID)
+	slog.Info("Starting server", "address", ":8000")
+
+	err = http.ListenAndServe(":8000", server.Handler())
 
 	if err != nil {
-		http.Error(w, "Failed to delete environment", http.StatusInternalServerError)
-		return
+		fatal("Error starting server", err)
 	}
-
-	fmt.Println("Deleted environments for netID: ", envDeleteReq.NetID)
-	w.WriteHeader(http.StatusNoContent)
 }
 
+func fatal(message string, err error) {
+	slog.Error(message, "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/course"
+	"github.com/BradleyLewis08/HiVE/internal/naming"
+	"github.com/BradleyLewis08/HiVE/internal/storage"
+	"github.com/go-chi/chi/v5"
+	"sigs.k8s.io/yaml"
+)
+
+const MAX_MANIFEST_SIZE = 1 << 20
+
+/* Plans the changes that bring a course in line with its manifest, sent as
+*  YAML or JSON. The plan is returned as a preview unless apply=true.
+*  Environments of the course that the manifest no longer calls for are only
+*  deleted when prune=true.
+*
+*  Assignment schedules are evaluated at the time of the request, so
+*  re-applying the same manifest opens and closes assignments over the term.
+*/
+func (s *Server) applyManifest(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MAX_MANIFEST_SIZE))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	var manifest course.Manifest
+	if err := yaml.UnmarshalStrict(body, &manifest); err != nil {
+		writeProblem(w, http.StatusBadRequest, fmt.Sprintf("Invalid manifest: %v", err))
+		return
+	}
+	if err := manifest.Validate(); err != nil {
+		writeProblem(w, http.StatusBadRequest, fmt.Sprintf("Invalid manifest: %v", err))
+		return
+	}
+	if manifest.RosterFile != nil {
+		writeProblem(w, http.StatusBadRequest, "Invalid manifest: rosterFile must be read into roster before it is sent")
+		return
+	}
+
+	desired, requested, err := s.desiredEnvironments(&manifest, time.Now())
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Validate has already rejected a course with nothing to sanitize
+	courseName, _ := naming.Sanitize(manifest.Course)
+	live, err := s.environments.ListEnvironmentOptions(r.Context(), address.CourseSelector(courseName))
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to list environments")
+		return
+	}
+
+	prune := r.URL.Query().Get("prune") == "true"
+	response := api.ManifestApplyResponse{
+		Plan: course.Diff(courseName, desired, course.Desired(live), prune),
+	}
+
+	created := response.Count(course.ACTION_CREATE)
+	deleted := response.Count(course.ACTION_DELETE)
+	err = s.quotas.Check(courseName, len(live)-deleted, created)
+	if err != nil {
+		writeError(r.Context(), w, err, "Manifest exceeds the course quota")
+		return
+	}
+
+	if r.URL.Query().Get("apply") != "true" {
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	ctx, job := s.startJob(r.Context(), w, storage.JOB_KIND_MANIFEST, courseName)
+	slog.InfoContext(ctx, "Applying manifest", "course", courseName, "changes", len(response.Changes))
+
+	// Kept so that the course's schedules survive a restart
+	if err := s.storage.PutManifest(ctx, courseName, manifest); err != nil {
+		err = fmt.Errorf("failed to record manifest: %w", err)
+		s.finishJob(ctx, job, err)
+		writeError(ctx, w, err, "Failed to apply manifest")
+		return
+	}
+
+	// Delete first so that replacements fit in the course quota
+	for _, action := range []string{course.ACTION_DELETE, course.ACTION_UPDATE, course.ACTION_CREATE} {
+		for _, change := range response.Changes {
+			if change.Action != action {
+				continue
+			}
+			if err := s.applyChange(ctx, change, requested[change.Address]); err != nil {
+				s.finishJob(ctx, job, err)
+				writeError(ctx, w, err, fmt.Sprintf("Failed to %s %s", change.Action, change.Address))
+				return
+			}
+		}
+	}
+	s.finishJob(ctx, job, nil)
+
+	response.Applied = true
+	writeJSON(w, http.StatusOK, response)
+}
+
+// desiredEnvironments expands the manifest into the environments it calls
+// for at now, keyed by canonical address, along with the names as written in
+// the manifest.
+func (s *Server) desiredEnvironments(manifest *course.Manifest, now time.Time) (course.Desired, map[address.Address]address.Address, error) {
+	desired := make(course.Desired)
+	requested := make(map[address.Address]address.Address)
+
+	for _, assignment := range manifest.Assignments {
+		if !assignment.Open(now) {
+			continue
+		}
+		options, err := s.resolveOptions(assignment.Image, assignment.Template, assignment.ResourceProfile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("assignment %s: %v", assignment.Name, err)
+		}
+		if options.ResourceProfile == "" {
+			options.ResourceProfile = manifest.ResourceProfile
+		}
+
+		for _, netID := range manifest.Roster {
+			environment, err := address.Parse(assignment.Name, manifest.Course, netID)
+			if err != nil {
+				return nil, nil, fmt.Errorf("assignment %s: %v", assignment.Name, err)
+			}
+			desired[environment] = options
+			requested[environment] = address.Address{
+				CourseName:     manifest.Course,
+				AssignmentName: assignment.Name,
+				NetID:          netID,
+			}
+		}
+	}
+	return desired, requested, nil
+}
+
+// getManifest returns the manifest last applied to a course.
+func (s *Server) getManifest(w http.ResponseWriter, r *http.Request) {
+	courseName, err := naming.Sanitize(chi.URLParam(r, "course"))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "Invalid course: "+err.Error())
+		return
+	}
+	manifest, ok, err := s.storage.GetManifest(r.Context(), courseName)
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to get manifest")
+		return
+	}
+	if !ok {
+		writeProblem(w, http.StatusNotFound, "No manifest has been applied to "+courseName)
+		return
+	}
+	writeJSON(w, http.StatusOK, manifest)
+}
+
+func (s *Server) applyChange(ctx context.Context, change course.Change, requested address.Address) error {
+	switch change.Action {
+	case course.ACTION_CREATE:
+		_, err := s.provisionEnvironment(ctx, requested.AssignmentName, requested.CourseName, requested.NetID, change.Options)
+		return err
+	case course.ACTION_UPDATE:
+		return s.updateEnvironment(ctx, change.Address, change.Options)
+	case course.ACTION_DELETE:
+		return s.teardownEnvironment(ctx, change.Address)
+	}
+	return fmt.Errorf("unknown action %q", change.Action)
+}
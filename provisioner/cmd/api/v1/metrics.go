@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/metrics"
+	k8sProvisioner "github.com/BradleyLewis08/HiVE/internal/provisioner"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// How long a scrape may spend reading the fleet from the backend and router
+const FLEET_SCRAPE_TIMEOUT = 10 * time.Second
+
+// Environment states as exported, from the backend's statuses
+var FLEET_STATE = map[string]string{
+	k8sProvisioner.STATUS_READY:      "running",
+	k8sProvisioner.STATUS_PENDING:    "pending",
+	k8sProvisioner.STATUS_HIBERNATED: "hibernated",
+	k8sProvisioner.STATUS_FAILED:     "failed",
+}
+
+var (
+	environmentsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.NAMESPACE, "", "environments"),
+		"Environments by course, assignment and state.",
+		[]string{"course", "assignment", "state"}, nil,
+	)
+	ingressRoutesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.NAMESPACE, "", "ingress_routes"),
+		"Routes configured on the active router.",
+		nil, nil,
+	)
+)
+
+// fleetCollector reads the environments and routes at scrape time, so the
+// gauges always agree with the cluster rather than with this process.
+type fleetCollector struct {
+	server *Server
+}
+
+func (c *fleetCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- environmentsDesc
+	ch <- ingressRoutesDesc
+}
+
+func (c *fleetCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), FLEET_SCRAPE_TIMEOUT)
+	defer cancel()
+
+	statuses, err := c.server.environments.EnvironmentStatuses(ctx, k8sProvisioner.ENVIRONMENT_LABEL_SELECTOR)
+	if err != nil {
+		slog.Error("Failed to collect environment statuses", "error", err)
+		ch <- prometheus.NewInvalidMetric(environmentsDesc, err)
+	} else {
+		type key struct{ course, assignment, state string }
+		counts := make(map[key]int)
+		for environment, status := range statuses {
+			counts[key{environment.CourseName, environment.AssignmentName, FLEET_STATE[status.Phase]}]++
+		}
+		for k, count := range counts {
+			ch <- prometheus.MustNewConstMetric(environmentsDesc, prometheus.GaugeValue, float64(count), k.course, k.assignment, k.state)
+		}
+	}
+
+	routes, err := c.server.router.ListRoutes(ctx)
+	if err != nil {
+		slog.Error("Failed to collect routes", "error", err)
+		ch <- prometheus.NewInvalidMetric(ingressRoutesDesc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(ingressRoutesDesc, prometheus.GaugeValue, float64(len(routes)))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/audit"
+	"github.com/BradleyLewis08/HiVE/internal/course"
+	k8sProvisioner "github.com/BradleyLewis08/HiVE/internal/provisioner"
+	"github.com/BradleyLewis08/HiVE/internal/storage"
+)
+
+// Recorded as the actor of changes the provisioner makes on its own
+const RECONCILER_ACTOR = "reconciler"
+
+// restoreState brings the cluster back in line before the server takes
+// traffic. Legacy environments are migrated first, since the routes and
+// environments are then found by the labels they lacked.
+func (s *Server) restoreState(ctx context.Context) error {
+	if err := s.migrateLegacyEnvironments(ctx); err != nil {
+		return err
+	}
+	// Rebuild the route table from the cluster, so environments created
+	// before a restart stay reachable
+	if _, err := s.reconcileRoutes(ctx); err != nil {
+		return fmt.Errorf("failed to reconcile routes: %w", err)
+	}
+	// Storage holds the environments that should exist; create any that
+	// went missing while the provisioner was down
+	if _, err := s.reconcileEnvironments(ctx); err != nil {
+		return fmt.Errorf("failed to reconcile environments: %w", err)
+	}
+	return nil
+}
+
+// migrateLegacyEnvironments renames the environments created before objects
+// were named after their address, on backends that may hold them.
+func (s *Server) migrateLegacyEnvironments(ctx context.Context) error {
+	migrator, ok := s.environments.(k8sProvisioner.LegacyMigrator)
+	if !ok {
+		return nil
+	}
+	migrated, err := migrator.MigrateLegacyEnvironments(ctx)
+	if len(migrated) > 0 {
+		slog.InfoContext(ctx, "Migrated legacy environments", "environments", len(migrated))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate legacy environments: %w", err)
+	}
+	return nil
+}
+
+// reconcileEnvironments brings the backend in line with the desired
+// environments in storage: missing environments are created, and those
+// running with other options are updated. Environments that are running but
+// not desired are left alone and listed as retained in the plan.
+//
+// When storage holds no environments at all, as on the first start after
+// it was introduced, the running environments are adopted as desired
+// instead. Only failures to read either side are returned; failed changes
+// are logged and recorded in the reconcile job.
+func (s *Server) reconcileEnvironments(ctx context.Context) (course.Plan, error) {
+	ctx = audit.WithActor(ctx, RECONCILER_ACTOR)
+
+	records, err := s.storage.ListEnvironments(ctx)
+	if err != nil {
+		return course.Plan{}, fmt.Errorf("failed to list desired environments: %w", err)
+	}
+	live, err := s.environments.ListEnvironmentOptions(ctx, k8sProvisioner.ENVIRONMENT_LABEL_SELECTOR)
+	if err != nil {
+		return course.Plan{}, fmt.Errorf("failed to list environments: %w", err)
+	}
+
+	if len(records) == 0 && len(live) > 0 {
+		return s.adoptEnvironments(ctx, live)
+	}
+
+	desired := make(course.Desired, len(records))
+	for _, record := range records {
+		desired[record.Address] = record.Options
+	}
+	plan := course.Diff("", desired, course.Desired(live), false)
+
+	for _, environment := range plan.Retained {
+		slog.WarnContext(ctx, "Environment is running but not desired", "environment", environment)
+	}
+	if len(plan.Changes) == 0 {
+		slog.InfoContext(ctx, "Reconciled environments", "desired", len(desired), "unchanged", plan.Unchanged)
+		return plan, nil
+	}
+
+	ctx, job := s.startJob(ctx, nil, storage.JOB_KIND_RECONCILE, "")
+	var failures []error
+	for _, change := range plan.Changes {
+		if err := s.applyChange(ctx, change, change.Address); err != nil {
+			slog.ErrorContext(ctx, "Failed to reconcile environment", "environment", change.Address, "action", change.Action, "error", err)
+			failures = append(failures, err)
+		}
+	}
+	s.finishJob(ctx, job, errors.Join(failures...))
+
+	slog.InfoContext(ctx, "Reconciled environments",
+		"desired", len(desired),
+		"created", plan.Count(course.ACTION_CREATE),
+		"updated", plan.Count(course.ACTION_UPDATE),
+		"failed", len(failures),
+	)
+	return plan, nil
+}
+
+// adoptEnvironments records every running environment as desired, with the
+// options it runs with.
+func (s *Server) adoptEnvironments(ctx context.Context, live course.Desired) (course.Plan, error) {
+	ctx, job := s.startJob(ctx, nil, storage.JOB_KIND_RECONCILE, "")
+	now := time.Now().UTC()
+	for environment, options := range live {
+		err := s.storage.PutEnvironment(ctx, storage.Environment{
+			Address:   environment,
+			Options:   options,
+			JobID:     job.ID,
+			CreatedAt: now,
+			UpdatedAt: now,
+		})
+		if err != nil {
+			err = fmt.Errorf("failed to adopt environment %s: %w", environment, err)
+			s.finishJob(ctx, job, err)
+			return course.Plan{}, err
+		}
+	}
+	s.finishJob(ctx, job, nil)
+
+	slog.InfoContext(ctx, "Adopted running environments as desired", "environments", len(live))
+	return course.Plan{Changes: []course.Change{}, Retained: []address.Address{}, Unchanged: len(live)}, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/render"
+	"github.com/BradleyLewis08/HiVE/internal/routing"
+)
+
+/* Responds with the objects a provisioning request would write, without
+*  creating them. Routing objects shared between environments are rendered
+*  with the routes already in place, and every object goes through a
+*  server-side dry run so admission errors are reported up front. On the
+*  Docker backend the objects are rendered but not validated. Like the
+*  provisioner itself, no PersistentVolumeClaims or NetworkPolicies are
+*  produced.
+*/
+func (s *Server) renderEnvironments(ctx context.Context, w http.ResponseWriter, envReq api.EnvironmentProvisionRequest, options deployments.EnvironmentOptions) {
+	request := render.Request{
+		CourseName: envReq.CourseName,
+		AssignmentName: envReq.AssignmentName,
+		NetIDs: envReq.NetIDs,
+		Options: options,
+	}
+
+	renderer, _ := s.router.(routing.Renderer)
+	var routes []address.Address
+	if renderer != nil {
+		existing, err := s.router.ListRoutes(ctx)
+		if err != nil {
+			writeError(ctx, w, err, "Failed to list routes")
+			return
+		}
+		routes = mergeRoutes(existing, request.Addresses())
+	}
+
+	objects, err := render.Environments(request, renderer, routes)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response := api.RenderResponse{Objects: objects}
+	if s.k8sClient == nil {
+		// Nothing to dry-run against on the Docker backend
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+	for i, obj := range objects {
+		admitted, err := s.k8sClient.DryRunApply(ctx, obj)
+		if err != nil {
+			response.Errors = append(response.Errors, fmt.Sprintf("%s %s: %v", obj.GetKind(), obj.GetName(), err))
+			continue
+		}
+		response.Objects[i] = render.Clean(admitted)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func mergeRoutes(existing []address.Address, added []address.Address) []address.Address {
+	seen := make(map[address.Address]bool, len(existing)+len(added))
+	var routes []address.Address
+	for _, environment := range append(existing, added...) {
+		if !seen[environment] {
+			seen[environment] = true
+			routes = append(routes, environment)
+		}
+	}
+	address.Sort(routes)
+	return routes
+}
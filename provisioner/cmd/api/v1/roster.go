@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/naming"
+	"github.com/BradleyLewis08/HiVE/internal/roster"
+	"github.com/BradleyLewis08/HiVE/internal/storage"
+	"github.com/go-chi/chi/v5"
+)
+
+// Roster files are small; anything larger is almost certainly the wrong file
+const MAX_ROSTER_SIZE = 10 << 20
+
+/* Diffs an uploaded roster against the environments provisioned for an
+*  assignment. The plan is returned as a preview unless apply=true, in which
+*  case missing students are provisioned and dropped students deleted.
+*
+*  The roster is the request body, or the "file" field of a multipart form.
+*  Query parameters: assignment (required), format (csv, canvas or
+*  blackboard), netIDColumn, nameColumn, image or template, resourceProfile,
+*  apply.
+*/
+func (s *Server) importRoster(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	courseName, err := naming.Sanitize(chi.URLParam(r, "course"))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "Invalid course: "+err.Error())
+		return
+	}
+	if query.Get("assignment") == "" {
+		writeProblem(w, http.StatusBadRequest, "An assignment is required")
+		return
+	}
+	assignmentName, err := naming.Sanitize(query.Get("assignment"))
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, "Invalid assignment: "+err.Error())
+		return
+	}
+
+	file, err := rosterFile(w, r)
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer file.Close()
+
+	students, err := roster.Parse(file, query.Get("format"), roster.Mapping{
+		NetID: query.Get("netIDColumn"),
+		Name:  query.Get("nameColumn"),
+	})
+	if err != nil {
+		writeProblem(w, http.StatusBadRequest, fmt.Sprintf("Invalid roster: %v", err))
+		return
+	}
+
+	existing, err := s.courseEnvironments(r.Context(), courseName)
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to list environments")
+		return
+	}
+	var provisioned []string
+	for _, environment := range existing {
+		if environment.AssignmentName == assignmentName {
+			provisioned = append(provisioned, environment.NetID)
+		}
+	}
+
+	response := api.RosterImportResponse{
+		Plan: roster.Diff(courseName, assignmentName, students, provisioned),
+	}
+	if query.Get("apply") != "true" {
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	var options deployments.EnvironmentOptions
+	if len(response.Add) > 0 {
+		options, err = s.resolveOptions(query.Get("image"), query.Get("template"), query.Get("resourceProfile"))
+		if err != nil {
+			writeProblem(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	ctx, job := s.startJob(r.Context(), w, storage.JOB_KIND_ROSTER, courseName)
+	slog.InfoContext(ctx, "Importing roster", "course", courseName, "assignment", assignmentName, "add", len(response.Add), "remove", len(response.Remove))
+
+	// Remove first so that students replacing dropped ones fit in the quota
+	for _, netID := range response.Remove {
+		err := s.teardownEnvironment(ctx, address.New(assignmentName, courseName, netID))
+		if err != nil {
+			s.finishJob(ctx, job, err)
+			writeError(ctx, w, err, fmt.Sprintf("Failed to remove %s", netID))
+			return
+		}
+	}
+
+	if len(response.Add) > 0 {
+		response.Environments, err = s.provisionEnvironments(ctx, assignmentName, courseName, options, response.Add)
+		if err != nil {
+			s.finishJob(ctx, job, err)
+			writeError(ctx, w, err, "Failed to create environments")
+			return
+		}
+	}
+	s.finishJob(ctx, job, nil)
+
+	response.Applied = true
+	writeJSON(w, http.StatusOK, response)
+}
+
+func rosterFile(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_ROSTER_SIZE)
+
+	if err := r.ParseMultipartForm(MAX_ROSTER_SIZE); err == nil {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, fmt.Errorf("A roster file is required")
+		}
+		return file, nil
+	} else if !errors.Is(err, http.ErrNotMultipart) {
+		return nil, err
+	}
+	return r.Body, nil
+}
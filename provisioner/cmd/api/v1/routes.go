@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/events"
+	"github.com/BradleyLewis08/HiVE/internal/routing"
+)
+
+func (s *Server) listRoutes(w http.ResponseWriter, r *http.Request) {
+	routes, err := s.router.ListRoutes(r.Context())
+
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to list routes")
+		return
+	}
+
+	response := api.EnvironmentList{Environments: []api.Environment{}}
+	for _, environment := range routes {
+		response.Environments = append(response.Environments, s.environmentResponse(environment))
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) reconcileRoutes(ctx context.Context) (*api.RouteSyncResponse, error) {
+	environments, err := s.environments.ListEnvironments(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	added, removed, err := routing.Reconcile(ctx, s.router, environments)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, environment := range added {
+		s.publishEvent(events.EVENT_ROUTE_ADDED, environment, "", "")
+	}
+	for _, environment := range removed {
+		s.publishEvent(events.EVENT_ROUTE_DELETED, environment, "", "")
+	}
+	slog.InfoContext(ctx, "Reconciled routes", "routes", len(environments), "added", len(added), "removed", len(removed))
+	return &api.RouteSyncResponse{Added: added, Removed: removed}, nil
+}
+
+func (s *Server) syncRoutes(w http.ResponseWriter, r *http.Request) {
+	result, err := s.reconcileRoutes(r.Context())
+
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to sync routes")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) routerStatus(w http.ResponseWriter, r *http.Request) {
+	reporter, ok := s.router.(routing.StatusReporter)
+
+	if !ok {
+		writeProblem(w, http.StatusNotImplemented, "Router status is not available for this backend")
+		return
+	}
+
+	status, err := reporter.Status(r.Context())
+
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to get router status")
+		return
+	}
+
+	if !status.Ready {
+		writeJSON(w, http.StatusServiceUnavailable, status)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
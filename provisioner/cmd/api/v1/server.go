@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/audit"
+	"github.com/BradleyLewis08/HiVE/internal/events"
+	k8sclient "github.com/BradleyLewis08/HiVE/internal/kubernetes"
+	"github.com/BradleyLewis08/HiVE/internal/logging"
+	"github.com/BradleyLewis08/HiVE/internal/metrics"
+	k8sProvisioner "github.com/BradleyLewis08/HiVE/internal/provisioner"
+	"github.com/BradleyLewis08/HiVE/internal/quota"
+	"github.com/BradleyLewis08/HiVE/internal/routing"
+	"github.com/BradleyLewis08/HiVE/internal/storage"
+	"github.com/BradleyLewis08/HiVE/internal/templates"
+	"github.com/BradleyLewis08/HiVE/internal/tracing"
+	"github.com/BradleyLewis08/HiVE/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Server struct {
+	// Unset when environments run on the local Docker backend
+	k8sClient *k8sclient.Client
+	environments k8sProvisioner.Backend
+	router routing.Router
+	// Source of truth for the environments that should exist, and for jobs
+	// and course manifests
+	storage storage.Store
+	quotas *quota.Store
+	templates *templates.Store
+	// Public URL the router is reachable at, e.g. https://hive.example.edu
+	publicBaseURL string
+	// Domain environments are served under when routing by host
+	hostDomain string
+	// Bearer token required on API requests, if set
+	apiToken string
+	// How long wait=true requests wait for environments to become ready
+	readyTimeout time.Duration
+	// Served on /metrics
+	metrics *prometheus.Registry
+	audit *audit.Log
+	// Streamed on /events
+	events *events.Broker
+	// Unset when no webhook is configured
+	webhooks *webhooks.Dispatcher
+	// Served on /drift
+	drift *driftState
+	driftInterval time.Duration
+	driftGracePeriod time.Duration
+	gc *gcState
+	gcInterval time.Duration
+	gcGracePeriod time.Duration
+	// Only report orphans found by the background sweeps
+	gcDryRun bool
+}
+
+// Dependencies are the collaborators a Server is built from, so that they
+// can be swapped for fakes. Storage, Quotas, Templates and Audit default to
+// empty in-memory stores.
+type Dependencies struct {
+	// Used for server-side dry runs; nil when environments do not run on
+	// Kubernetes
+	K8sClient *k8sclient.Client
+	Environments k8sProvisioner.Backend
+	Router routing.Router
+	Storage storage.Store
+	Quotas *quota.Store
+	Templates *templates.Store
+	Audit *audit.Log
+	// Nil when no webhook is configured
+	Webhooks *webhooks.Dispatcher
+}
+
+type Options struct {
+	PublicBaseURL string
+	HostDomain string
+	APIToken string
+	// Defaults to DEFAULT_READY_TIMEOUT
+	ReadyTimeout time.Duration
+	// Default to DEFAULT_DRIFT_INTERVAL and DEFAULT_DRIFT_GRACE_PERIOD
+	DriftInterval time.Duration
+	DriftGracePeriod time.Duration
+	// Default to DEFAULT_GC_INTERVAL and DEFAULT_GC_GRACE_PERIOD
+	GCInterval time.Duration
+	GCGracePeriod time.Duration
+	GCDryRun bool
+}
+
+const DEFAULT_READY_TIMEOUT = 5 * time.Minute
+
+const (
+	REQUEST_ID_HEADER = "X-Request-ID"
+	// Identifies the job started by a request that changes many environments
+	JOB_ID_HEADER = "X-Hive-Job-ID"
+	// Set by the user-service to the user acting through it. The API token
+	// does not say who that is, so it is recorded as unverified, and it is
+	// refused when the API is open.
+	ACTOR_HEADER = "X-Hive-Actor"
+	// Actor of requests authenticated with the API token
+	DEFAULT_ACTOR = "api"
+	// Actor of requests when no API token is configured
+	ANONYMOUS_ACTOR = "anonymous"
+)
+
+func NewServer(deps Dependencies, options Options) *Server {
+	if deps.Storage == nil {
+		deps.Storage = storage.NewMemory()
+	}
+	if deps.Quotas == nil {
+		deps.Quotas = quota.NewStore()
+	}
+	if deps.Templates == nil {
+		deps.Templates = templates.NewStore()
+	}
+	if deps.Audit == nil {
+		deps.Audit = audit.NewLog()
+	}
+	if options.ReadyTimeout == 0 {
+		options.ReadyTimeout = DEFAULT_READY_TIMEOUT
+	}
+	if options.DriftInterval == 0 {
+		options.DriftInterval = DEFAULT_DRIFT_INTERVAL
+	}
+	if options.DriftGracePeriod == 0 {
+		options.DriftGracePeriod = DEFAULT_DRIFT_GRACE_PERIOD
+	}
+	if options.GCInterval == 0 {
+		options.GCInterval = DEFAULT_GC_INTERVAL
+	}
+	if options.GCGracePeriod == 0 {
+		options.GCGracePeriod = DEFAULT_GC_GRACE_PERIOD
+	}
+	server := &Server{
+		k8sClient: deps.K8sClient,
+		environments: deps.Environments,
+		router: deps.Router,
+		storage: deps.Storage,
+		quotas: deps.Quotas,
+		templates: deps.Templates,
+		audit: deps.Audit,
+		webhooks: deps.Webhooks,
+		publicBaseURL: options.PublicBaseURL,
+		hostDomain: options.HostDomain,
+		apiToken: options.APIToken,
+		readyTimeout: options.ReadyTimeout,
+		driftInterval: options.DriftInterval,
+		driftGracePeriod: options.DriftGracePeriod,
+		gcInterval: options.GCInterval,
+		gcGracePeriod: options.GCGracePeriod,
+		gcDryRun: options.GCDryRun,
+		metrics: metrics.NewRegistry(),
+		events: events.NewBroker(),
+		drift: newDriftState(),
+		gc: newGCState(),
+	}
+	server.metrics.MustRegister(&fleetCollector{server: server})
+	return server
+}
+
+func (s *Server) Handler() http.Handler {
+	r := chi.NewRouter()
+	r.Use(s.requestContext)
+	r.Use(routeSpan)
+
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello World"))
+	})
+
+	// Scraped by Prometheus, which is not given the API token
+	r.Handle("/metrics", metrics.Handler(s.metrics))
+
+	r.Group(func(r chi.Router) {
+		r.Use(s.authenticate)
+
+		// Used by the user-service
+		r.Post("/environment", s.createEnvironment)
+		r.Post("/environment/delete", s.deleteEnvironment)
+
+		r.Route("/environments", func(r chi.Router) {
+			r.Get("/", s.listEnvironments)
+			r.Post("/", s.createEnvironment)
+			r.Route("/{course}/{assignment}/{netID}", func(r chi.Router) {
+				r.Get("/", s.getEnvironment)
+				r.Delete("/", s.deleteEnvironmentByAddress)
+				r.Post("/reset", s.resetEnvironment)
+				r.Post("/hibernate", s.hibernateEnvironment)
+				r.Post("/resume", s.resumeEnvironment)
+				r.Get("/logs", s.environmentLogs)
+				r.Post("/exec", s.execEnvironment)
+			})
+		})
+
+		r.Get("/courses/{course}/quota", s.getCourseQuota)
+		r.Put("/courses/{course}/quota", s.setCourseQuota)
+		r.Post("/courses/{course}/roster", s.importRoster)
+		r.Get("/courses/{course}/manifest", s.getManifest)
+		r.Post("/manifests", s.applyManifest)
+
+		r.Get("/jobs", s.listJobs)
+		r.Get("/jobs/{id}", s.getJob)
+
+		r.Get("/templates", s.listTemplates)
+		r.Get("/templates/{name}", s.getTemplate)
+		r.Put("/templates/{name}", s.applyTemplate)
+		r.Delete("/templates/{name}", s.deleteTemplate)
+
+		r.Get("/routes", s.listRoutes)
+		r.Post("/routes/sync", s.syncRoutes)
+		r.Get("/router/status", s.routerStatus)
+		r.Get("/drift", s.getDrift)
+		r.Get("/gc", s.getGarbage)
+		r.Post("/gc/sweep", s.sweepGarbageNow)
+
+		r.Get("/events", s.streamEvents)
+		r.Get("/events/ws", s.websocketEvents)
+
+		r.Get("/audit", s.listAudit)
+		r.Get("/audit/export", s.exportAudit)
+
+		r.Get("/webhooks/dead-letters", s.listDeadLetters)
+		r.Post("/webhooks/dead-letters/replay", s.replayDeadLetters)
+		r.Post("/webhooks/dead-letters/{id}/replay", s.replayDeadLetter)
+	})
+
+	return tracing.Handler(r)
+}
+
+// routeSpan names the request's span after the route it matched, such as
+// "GET /environments/{course}/{assignment}/{netID}", once it is known.
+func routeSpan(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+
+		pattern := chi.RouteContext(r.Context()).RoutePattern()
+		if pattern == "" {
+			return
+		}
+		span := trace.SpanFromContext(r.Context())
+		span.SetName(r.Method + " " + pattern)
+		span.SetAttributes(semconv.HTTPRoute(pattern))
+	})
+}
+
+// requestContext gives each request an ID, taken from X-Request-ID when the
+// caller sets one, and the actor its credential identifies, then logs the
+// request once it has been served. The user named by X-Hive-Actor is kept
+// apart from the actor, since the caller may name anyone.
+func (s *Server) requestContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(REQUEST_ID_HEADER)
+		if requestID == "" {
+			requestID = logging.NewID()
+		}
+		w.Header().Set(REQUEST_ID_HEADER, requestID)
+
+		// Routes outside the authenticated group make no changes, so every
+		// request that is audited carries the API token when one is set
+		actor := DEFAULT_ACTOR
+		if s.apiToken == "" {
+			actor = ANONYMOUS_ACTOR
+		}
+		onBehalfOf := r.Header.Get(ACTOR_HEADER)
+
+		ctx := logging.WithRequestID(r.Context(), requestID)
+		ctx = audit.WithActor(ctx, actor)
+		ctx = audit.WithOnBehalfOf(ctx, onBehalfOf)
+		trace.SpanFromContext(ctx).SetAttributes(
+			attribute.String("hive.request_id", requestID),
+			attribute.String("hive.actor", actor),
+			attribute.String("hive.on_behalf_of", onBehalfOf),
+		)
+
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		if onBehalfOf != "" && s.apiToken == "" {
+			writeProblem(ww, http.StatusBadRequest, ACTOR_HEADER+" is only accepted when API_TOKEN is set")
+		} else {
+			next.ServeHTTP(ww, r.WithContext(ctx))
+		}
+
+		slog.InfoContext(ctx, "Served request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", ww.Status(),
+			"duration", time.Since(start),
+			"actor", actor,
+			"onBehalfOf", onBehalfOf,
+		)
+	})
+}
+
+// authenticate requires the configured API token as a bearer token. The
+// API is left open when no token is configured.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.apiToken != "" && r.Header.Get("Authorization") != "Bearer "+s.apiToken {
+			writeProblem(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+// addressFromURL reads the environment address from the request path
+func addressFromURL(r *http.Request) address.Address {
+	return address.New(chi.URLParam(r, "assignment"), chi.URLParam(r, "course"), chi.URLParam(r, "netID"))
+}
+
+// environmentResponse attaches the canonical public URL of an environment
+func (s *Server) environmentResponse(environment address.Address) api.Environment {
+	var url string
+	if s.hostDomain != "" {
+		scheme := "https"
+		if strings.HasPrefix(s.publicBaseURL, "http://") {
+			scheme = "http"
+		}
+		url = environment.HostURL(scheme, s.hostDomain)
+	} else {
+		url = environment.PathURL(s.publicBaseURL)
+	}
+	return api.Environment{Address: environment, URL: url}
+}
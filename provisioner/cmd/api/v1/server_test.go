@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/audit"
+	"github.com/BradleyLewis08/HiVE/internal/ingress"
+	"github.com/BradleyLewis08/HiVE/internal/kubernetes/k8stest"
+	k8sProvisioner "github.com/BradleyLewis08/HiVE/internal/provisioner"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const TEST_API_TOKEN = "secret"
+
+// newTestServer builds a Server on fake clientsets holding objects,
+// provisioning environments on Kubernetes and routing them through an
+// Ingress.
+func newTestServer(t *testing.T, options Options, objects ...runtime.Object) (*Server, k8stest.Fakes) {
+	client, fakes := k8stest.NewClient(objects...)
+	router := ingress.NewIngressManager(client)
+	if err := router.Provision(context.Background()); err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+	options.PublicBaseURL = "https://hive.example.edu"
+	server := NewServer(Dependencies{
+		K8sClient:    client,
+		Environments: k8sProvisioner.NewProvisioner(client),
+		Router:       router,
+	}, options)
+	return server, fakes
+}
+
+// serve sends a request with an optional JSON body to the server's handler
+func serve(server *Server, method string, path string, body interface{}, header http.Header) *httptest.ResponseRecorder {
+	var payload bytes.Buffer
+	switch body := body.(type) {
+	case nil:
+	case string:
+		payload.WriteString(body)
+	default:
+		json.NewEncoder(&payload).Encode(body)
+	}
+	request := httptest.NewRequest(method, path, &payload)
+	for key, values := range header {
+		request.Header[key] = values
+	}
+	recorder := httptest.NewRecorder()
+	server.Handler().ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestEnvironmentLifecycle(t *testing.T) {
+	ctx := context.Background()
+	server, _ := newTestServer(t, Options{})
+	environment := address.New("hw1", "CPSC 323", "alice")
+
+	created := serve(server, http.MethodPost, "/environments", api.EnvironmentProvisionRequest{
+		CourseName:     "CPSC 323",
+		AssignmentName: "hw1",
+		NetIDs:         []string{"alice"},
+		Image:          "code-server",
+	}, nil)
+	if created.Code != http.StatusCreated {
+		t.Fatalf("POST /environments = %d: %s", created.Code, created.Body)
+	}
+	var list api.EnvironmentList
+	json.NewDecoder(created.Body).Decode(&list)
+	want := api.Environment{Address: environment, URL: environment.PathURL("https://hive.example.edu")}
+	if !reflect.DeepEqual(list.Environments, []api.Environment{want}) {
+		t.Fatalf("POST /environments = %+v, want %+v", list.Environments, want)
+	}
+
+	if routes, err := server.router.ListRoutes(ctx); err != nil || !reflect.DeepEqual(routes, []address.Address{environment}) {
+		t.Fatalf("routes after create = %v, %v, want [%v]", routes, err, environment)
+	}
+	if _, ok, _ := server.storage.GetEnvironment(ctx, environment); !ok {
+		t.Fatal("created environment was not recorded as desired")
+	}
+
+	listed := serve(server, http.MethodGet, "/environments?course=CPSC+323", nil, nil)
+	list = api.EnvironmentList{}
+	json.NewDecoder(listed.Body).Decode(&list)
+	if listed.Code != http.StatusOK || !reflect.DeepEqual(list.Environments, []api.Environment{want}) {
+		t.Fatalf("GET /environments = %d %+v, want %+v", listed.Code, list.Environments, want)
+	}
+
+	path := "/environments/" + environment.CourseName + "/" + environment.AssignmentName + "/" + environment.NetID
+	got := serve(server, http.MethodGet, path, nil, nil)
+	var status api.Environment
+	json.NewDecoder(got.Body).Decode(&status)
+	if got.Code != http.StatusOK || status.Status != k8sProvisioner.STATUS_PENDING {
+		t.Fatalf("GET %s = %d %+v, want a pending environment", path, got.Code, status)
+	}
+
+	if deleted := serve(server, http.MethodDelete, path, nil, nil); deleted.Code != http.StatusNoContent {
+		t.Fatalf("DELETE %s = %d: %s", path, deleted.Code, deleted.Body)
+	}
+	if routes, err := server.router.ListRoutes(ctx); err != nil || len(routes) != 0 {
+		t.Fatalf("routes after delete = %v, %v, want none", routes, err)
+	}
+	if _, ok, _ := server.storage.GetEnvironment(ctx, environment); ok {
+		t.Fatal("deleted environment is still desired")
+	}
+	expectProblem(t, serve(server, http.MethodGet, path, nil, nil), http.StatusNotFound, api.PROBLEM_TYPE_PREFIX+k8sProvisioner.ERROR_NOT_FOUND)
+}
+
+// TestProblemResponses checks that errors are answered with RFC 7807
+// problem documents whose type names the kind of error.
+func TestProblemResponses(t *testing.T) {
+	provisionRequest := api.EnvironmentProvisionRequest{CourseName: "cpsc323", AssignmentName: "hw1", NetIDs: []string{"alice"}, Image: "code-server"}
+	environmentPath := "/environments/cpsc323/hw1/alice"
+
+	tests := []struct {
+		name    string
+		options Options
+		// Runs against the server before the request
+		setup  func(t *testing.T, server *Server, fakes k8stest.Fakes)
+		method string
+		path   string
+		body   interface{}
+		status int
+		// Empty for problems that carry no meaning beyond their status
+		kind string
+	}{
+		{
+			name:    "missing token",
+			options: Options{APIToken: TEST_API_TOKEN},
+			method:  http.MethodGet,
+			path:    "/environments",
+			status:  http.StatusUnauthorized,
+		},
+		{
+			name:   "malformed request",
+			method: http.MethodPost,
+			path:   "/environments",
+			body:   "{",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "missing image",
+			method: http.MethodPost,
+			path:   "/environments",
+			body:   api.EnvironmentProvisionRequest{CourseName: "cpsc323", AssignmentName: "hw1", NetIDs: []string{"alice"}},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "blank course",
+			method: http.MethodPost,
+			path:   "/environments",
+			body:   api.EnvironmentProvisionRequest{CourseName: "  ", AssignmentName: "hw1", NetIDs: []string{"alice"}, Image: "code-server"},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "netID with nothing to sanitize",
+			method: http.MethodPost,
+			path:   "/environments",
+			body:   api.EnvironmentProvisionRequest{CourseName: "cpsc323", AssignmentName: "hw1", NetIDs: []string{"alice", "!!!"}, Image: "code-server", DryRun: true},
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "missing environment",
+			method: http.MethodDelete,
+			path:   environmentPath,
+			status: http.StatusNotFound,
+			kind:   k8sProvisioner.ERROR_NOT_FOUND,
+		},
+		{
+			name: "existing environment",
+			setup: func(t *testing.T, server *Server, fakes k8stest.Fakes) {
+				if response := serve(server, http.MethodPost, "/environments", provisionRequest, nil); response.Code != http.StatusCreated {
+					t.Fatalf("POST /environments = %d: %s", response.Code, response.Body)
+				}
+			},
+			method: http.MethodPost,
+			path:   "/environments",
+			body:   provisionRequest,
+			status: http.StatusConflict,
+			kind:   k8sProvisioner.ERROR_CONFLICT,
+		},
+		{
+			name: "quota exceeded",
+			setup: func(t *testing.T, server *Server, fakes k8stest.Fakes) {
+				server.quotas.Set(context.Background(), "cpsc323", 1)
+			},
+			method: http.MethodPost,
+			path:   "/environments",
+			body:   api.EnvironmentProvisionRequest{CourseName: "cpsc323", AssignmentName: "hw1", NetIDs: []string{"alice", "bob"}, Image: "code-server"},
+			status: http.StatusForbidden,
+			kind:   k8sProvisioner.ERROR_QUOTA_EXCEEDED,
+		},
+		{
+			name: "internal error",
+			setup: func(t *testing.T, server *Server, fakes k8stest.Fakes) {
+				fakes.Clientset.PrependReactor("list", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+					return true, nil, errors.New("internal detail")
+				})
+			},
+			method: http.MethodGet,
+			path:   "/environments",
+			status: http.StatusInternalServerError,
+			kind:   k8sProvisioner.ERROR_INTERNAL,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			server, fakes := newTestServer(t, tc.options)
+			if tc.setup != nil {
+				tc.setup(t, server, fakes)
+			}
+			problemType := "about:blank"
+			if tc.kind != "" {
+				problemType = api.PROBLEM_TYPE_PREFIX + tc.kind
+			}
+			problem := expectProblem(t, serve(server, tc.method, tc.path, tc.body, nil), tc.status, problemType)
+			// Errors that are not the caller's to fix are only logged
+			if tc.status >= http.StatusInternalServerError && strings.Contains(problem.Detail, "internal detail") {
+				t.Fatalf("problem detail %q exposes the underlying error", problem.Detail)
+			}
+		})
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	server, _ := newTestServer(t, Options{APIToken: TEST_API_TOKEN})
+
+	authorized := http.Header{"Authorization": {"Bearer " + TEST_API_TOKEN}}
+	if response := serve(server, http.MethodGet, "/environments", nil, authorized); response.Code != http.StatusOK {
+		t.Fatalf("GET /environments with the token = %d: %s", response.Code, response.Body)
+	}
+	wrong := http.Header{"Authorization": {"Bearer wrong"}}
+	expectProblem(t, serve(server, http.MethodGet, "/environments", nil, wrong), http.StatusUnauthorized, "about:blank")
+
+	// Prometheus scrapes without the token
+	response := serve(server, http.MethodGet, "/metrics", nil, nil)
+	if response.Code != http.StatusOK || !strings.Contains(response.Body.String(), "hive_ingress_routes") {
+		t.Fatalf("GET /metrics without the token = %d: %s", response.Code, response.Body)
+	}
+}
+
+// expectProblem checks that response is a problem document with the given
+// status and type, and returns it.
+func expectProblem(t *testing.T, response *httptest.ResponseRecorder, status int, problemType string) api.Problem {
+	t.Helper()
+	if response.Code != status {
+		t.Fatalf("status = %d, want %d: %s", response.Code, status, response.Body)
+	}
+	if contentType := response.Header().Get("Content-Type"); contentType != api.PROBLEM_CONTENT_TYPE {
+		t.Fatalf("Content-Type = %q, want %q", contentType, api.PROBLEM_CONTENT_TYPE)
+	}
+	var problem api.Problem
+	if err := json.NewDecoder(response.Body).Decode(&problem); err != nil {
+		t.Fatalf("problem document does not decode: %v", err)
+	}
+	if problem.Type != problemType || problem.Status != status || problem.Title != http.StatusText(status) {
+		t.Fatalf("problem = %+v, want type %s and status %d", problem, problemType, status)
+	}
+	return problem
+}
+
+// TestActor checks that the audited actor comes from the credential, and
+// that the user named by X-Hive-Actor is only recorded alongside it.
+func TestActor(t *testing.T) {
+	request := api.EnvironmentProvisionRequest{CourseName: "cpsc323", AssignmentName: "hw1", NetIDs: []string{"alice"}, Image: "code-server"}
+
+	open, _ := newTestServer(t, Options{})
+	named := http.Header{ACTOR_HEADER: {"mallory"}}
+	expectProblem(t, serve(open, http.MethodPost, "/environments", request, named), http.StatusBadRequest, "about:blank")
+	if response := serve(open, http.MethodPost, "/environments", request, nil); response.Code != http.StatusCreated {
+		t.Fatalf("POST /environments = %d: %s", response.Code, response.Body)
+	}
+	expectActor(t, open, ANONYMOUS_ACTOR, "")
+
+	authenticated, _ := newTestServer(t, Options{APIToken: TEST_API_TOKEN})
+	header := http.Header{"Authorization": {"Bearer " + TEST_API_TOKEN}, ACTOR_HEADER: {"professor"}}
+	if response := serve(authenticated, http.MethodPost, "/environments", request, header); response.Code != http.StatusCreated {
+		t.Fatalf("POST /environments = %d: %s", response.Code, response.Body)
+	}
+	expectActor(t, authenticated, DEFAULT_ACTOR, "professor")
+}
+
+func expectActor(t *testing.T, server *Server, actor string, onBehalfOf string) {
+	t.Helper()
+	entries, err := server.audit.Query(context.Background(), audit.Filter{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Actor != actor || entries[0].OnBehalfOf != onBehalfOf {
+		t.Fatalf("audit entries = %+v, want one by %q on behalf of %q", entries, actor, onBehalfOf)
+	}
+}
+
+// TestAuditedActions checks that hibernating, resuming and exporting are
+// audited along with creating.
+func TestAuditedActions(t *testing.T) {
+	ctx := context.Background()
+	request := api.EnvironmentProvisionRequest{CourseName: "cpsc323", AssignmentName: "hw1", NetIDs: []string{"alice"}, Image: "code-server"}
+	environment := address.New("hw1", "cpsc323", "alice")
+	environmentPath := "/environments/cpsc323/hw1/alice"
+
+	server, fakes := newTestServer(t, Options{})
+	if response := serve(server, http.MethodPost, "/environments", request, nil); response.Code != http.StatusCreated {
+		t.Fatalf("POST /environments = %d: %s", response.Code, response.Body)
+	}
+	deployments := fakes.Clientset.AppsV1().Deployments(address.NAMESPACE)
+	for _, step := range []struct {
+		action   string
+		replicas int32
+	}{
+		{"hibernate", 0},
+		{"resume", 1},
+	} {
+		if response := serve(server, http.MethodPost, environmentPath+"/"+step.action, nil, nil); response.Code != http.StatusAccepted {
+			t.Fatalf("POST %s/%s = %d: %s", environmentPath, step.action, response.Code, response.Body)
+		}
+		deployment, err := deployments.Get(ctx, environment.DeploymentName(), metav1.GetOptions{})
+		if err != nil || *deployment.Spec.Replicas != step.replicas {
+			t.Fatalf("Deployment after %s = %v, %v, want %d replicas", step.action, deployment, err, step.replicas)
+		}
+	}
+	expectProblem(t, serve(server, http.MethodPost, "/environments/cpsc323/hw1/bob/hibernate", nil, nil), http.StatusNotFound, api.PROBLEM_TYPE_PREFIX+k8sProvisioner.ERROR_NOT_FOUND)
+	if response := serve(server, http.MethodGet, "/audit/export?course=cpsc323", nil, nil); response.Code != http.StatusOK || strings.Count(response.Body.String(), "\n") != 4 {
+		t.Fatalf("GET /audit/export = %d: %s", response.Code, response.Body)
+	}
+
+	entries, err := server.audit.Query(ctx, audit.Filter{})
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+	want := []struct {
+		action  string
+		outcome string
+		netID   string
+	}{
+		{audit.ACTION_CREATE, audit.OUTCOME_SUCCESS, "alice"},
+		{audit.ACTION_HIBERNATE, audit.OUTCOME_SUCCESS, "alice"},
+		{audit.ACTION_RESUME, audit.OUTCOME_SUCCESS, "alice"},
+		{audit.ACTION_HIBERNATE, audit.OUTCOME_FAILURE, "bob"},
+		{audit.ACTION_EXPORT, audit.OUTCOME_SUCCESS, ""},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("audit entries = %+v, want %d", entries, len(want))
+	}
+	for i, entry := range entries {
+		if entry.Action != want[i].action || entry.Outcome != want[i].outcome || entry.Environment.NetID != want[i].netID {
+			t.Fatalf("audit entry %d = %+v, want %s by %s with outcome %s", i, entry, want[i].action, want[i].netID, want[i].outcome)
+		}
+	}
+	export := entries[len(entries)-1]
+	if export.Environment.CourseName != "cpsc323" || !reflect.DeepEqual(export.Parameters, map[string]string{"course": "cpsc323"}) {
+		t.Fatalf("export entry = %+v, want it filtered to cpsc323", export)
+	}
+}
+
+// TestLegacyEnvironmentSurvivesStartup checks that an environment created
+// before objects were named after their address, whose Service has no
+// labels, keeps its route across startup and is migrated and adopted.
+func TestLegacyEnvironmentSurvivesStartup(t *testing.T) {
+	ctx := context.Background()
+	environment := address.New("hw1", "cpsc-323", "alice")
+	legacyLabels := map[string]string{"app": "hive-course", "course": "cpsc-323", "assignment": "hw1", "student": "alice"}
+	legacyDeployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "hive-environment-hw1-cpsc-323-alice", Namespace: address.NAMESPACE, Labels: legacyLabels},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: legacyLabels},
+			Template: apiv1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: legacyLabels},
+				Spec:       apiv1.PodSpec{Containers: []apiv1.Container{{Name: "code-server", Image: "code-server:v1"}}},
+			},
+		},
+	}
+	legacyService := &apiv1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "hw1-cpsc-323-alice-lb", Namespace: address.NAMESPACE},
+		Spec:       apiv1.ServiceSpec{Selector: legacyLabels},
+	}
+
+	server, fakes := newTestServer(t, Options{}, legacyDeployment, legacyService)
+	if err := server.router.AddRoute(ctx, environment); err != nil {
+		t.Fatalf("AddRoute: %v", err)
+	}
+	if err := server.restoreState(ctx); err != nil {
+		t.Fatalf("restoreState: %v", err)
+	}
+
+	if routes, err := server.router.ListRoutes(ctx); err != nil || !reflect.DeepEqual(routes, []address.Address{environment}) {
+		t.Fatalf("routes after startup = %v, %v, want [%v]", routes, err, environment)
+	}
+	deployments := fakes.Clientset.AppsV1().Deployments(address.NAMESPACE)
+	services := fakes.Clientset.CoreV1().Services(address.NAMESPACE)
+	if _, err := deployments.Get(ctx, environment.DeploymentName(), metav1.GetOptions{}); err != nil {
+		t.Fatalf("canonical Deployment: %v", err)
+	}
+	if service, err := services.Get(ctx, environment.ServiceName(), metav1.GetOptions{}); err != nil || service.Labels[address.COURSE_LABEL] != "cpsc-323" {
+		t.Fatalf("canonical Service = %v, %v, want it labelled", service, err)
+	}
+	if _, err := deployments.Get(ctx, legacyDeployment.Name, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("legacy Deployment was not deleted: %v", err)
+	}
+	if _, err := services.Get(ctx, legacyService.Name, metav1.GetOptions{}); !apierrors.IsNotFound(err) {
+		t.Fatalf("legacy Service was not deleted: %v", err)
+	}
+	if record, ok, err := server.storage.GetEnvironment(ctx, environment); err != nil || !ok || record.Options.Image != "code-server:v1" {
+		t.Fatalf("adopted environment = %+v, %v, %v, want it desired with its image", record, ok, err)
+	}
+
+	// Starting again finds nothing left to migrate
+	if err := server.restoreState(ctx); err != nil {
+		t.Fatalf("restoreState again: %v", err)
+	}
+	if routes, _ := server.router.ListRoutes(ctx); !reflect.DeepEqual(routes, []address.Address{environment}) {
+		t.Fatalf("routes after a second startup = %v, want [%v]", routes, environment)
+	}
+
+	// A Deployment whose Service is missing keeps its route until drift
+	// repair restores the Service
+	if err := services.Delete(ctx, environment.ServiceName(), metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.reconcileRoutes(ctx); err != nil {
+		t.Fatalf("reconcileRoutes: %v", err)
+	}
+	if routes, _ := server.router.ListRoutes(ctx); !reflect.DeepEqual(routes, []address.Address{environment}) {
+		t.Fatalf("routes without a Service = %v, want [%v]", routes, environment)
+	}
+}
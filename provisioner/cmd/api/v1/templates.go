@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/BradleyLewis08/HiVE/internal/templates"
+	"github.com/go-chi/chi/v5"
+)
+
+func (s *Server) listTemplates(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.templates.List())
+}
+
+func (s *Server) getTemplate(w http.ResponseWriter, r *http.Request) {
+	template, ok := s.templates.Get(chi.URLParam(r, "name"))
+
+	if !ok {
+		writeProblem(w, http.StatusNotFound, "Template not found")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, template)
+}
+
+func (s *Server) applyTemplate(w http.ResponseWriter, r *http.Request) {
+	var template templates.Template
+
+	if err := json.NewDecoder(r.Body).Decode(&template); err != nil {
+		writeProblem(w, http.StatusBadRequest, "Invalid request")
+		return
+	}
+
+	template.Name = chi.URLParam(r, "name")
+	if err := template.Validate(); err != nil {
+		writeProblem(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := s.templates.Apply(r.Context(), template); err != nil {
+		writeError(r.Context(), w, err, "Failed to save template")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, template)
+}
+
+func (s *Server) deleteTemplate(w http.ResponseWriter, r *http.Request) {
+	deleted, err := s.templates.Delete(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to delete template")
+		return
+	}
+	if !deleted {
+		writeProblem(w, http.StatusNotFound, "Template not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/webhooks"
+	"github.com/go-chi/chi/v5"
+)
+
+// deliverWebhooks delivers events to the configured webhook, if any, until
+// ctx is done.
+func (s *Server) deliverWebhooks(ctx context.Context) {
+	if s.webhooks == nil {
+		return
+	}
+	go s.webhooks.Run(ctx, s.events, func(environment address.Address) string {
+		return s.environmentResponse(environment).URL
+	})
+}
+
+/* Lists the webhook deliveries that were given up on after their last
+*  attempt, oldest first.
+*/
+func (s *Server) listDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if s.webhooks == nil {
+		writeJSON(w, http.StatusOK, api.WebhookDeliveryList{Deliveries: []webhooks.Delivery{}})
+		return
+	}
+	writeJSON(w, http.StatusOK, api.WebhookDeliveryList{Deliveries: s.webhooks.DeadLetters()})
+}
+
+// replayDeadLetter queues a dead letter for delivery again, with a fresh
+// set of attempts.
+func (s *Server) replayDeadLetter(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if s.webhooks == nil {
+		writeProblem(w, http.StatusNotFound, "No webhook is configured")
+		return
+	}
+	delivery, ok, err := s.webhooks.Replay(id)
+	if err != nil {
+		writeError(r.Context(), w, err, "Failed to replay webhook delivery")
+		return
+	}
+	if !ok {
+		writeProblem(w, http.StatusNotFound, "No dead-lettered delivery "+id)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, delivery)
+}
+
+// replayDeadLetters queues every dead letter for delivery again.
+func (s *Server) replayDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if s.webhooks == nil {
+		writeProblem(w, http.StatusNotFound, "No webhook is configured")
+		return
+	}
+	replayed := []webhooks.Delivery{}
+	for _, dead := range s.webhooks.DeadLetters() {
+		delivery, ok, err := s.webhooks.Replay(dead.ID)
+		if err != nil {
+			writeError(r.Context(), w, err, "Failed to replay webhook delivery "+dead.ID)
+			return
+		}
+		if ok {
+			replayed = append(replayed, delivery)
+		}
+	}
+	writeJSON(w, http.StatusAccepted, api.WebhookDeliveryList{Deliveries: replayed})
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/course"
+	"github.com/BradleyLewis08/HiVE/internal/roster"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+func newApplyCommand() *cobra.Command {
+	var file string
+	var prune bool
+	var planOnly bool
+	var assumeYes bool
+	cmd := &cobra.Command{
+		Use:   "apply -f <course.yaml>",
+		Short: "Converge a course on its manifest",
+		Long: `Compares a course manifest against the environments running for the
+course and shows the environments that would be created, updated and deleted.
+The plan is applied after confirmation, or straight away with --yes.
+
+Environments that are no longer in the manifest are only deleted with
+--prune; otherwise they are listed as retained.`,
+		Example: `  hivectl apply -f course.yaml --plan
+  hivectl apply -f course.yaml
+  hivectl apply -f course.yaml --prune --yes`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			manifest, err := loadManifest(file)
+			if err != nil {
+				return err
+			}
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			plan, err := client.ApplyManifest(manifest, false, prune)
+			if err != nil {
+				return err
+			}
+			if planOnly || len(plan.Changes) == 0 {
+				return printResult(plan, manifestPlanTable(plan))
+			}
+
+			if !assumeYes {
+				if err := writeResult(cmd.ErrOrStderr(), OUTPUT_TABLE, plan, manifestPlanTable(plan)); err != nil {
+					return err
+				}
+				question := fmt.Sprintf("Create %d, update %d and delete %d environments?",
+					plan.Count(course.ACTION_CREATE), plan.Count(course.ACTION_UPDATE), plan.Count(course.ACTION_DELETE))
+				if !confirm(cmd.InOrStdin(), cmd.ErrOrStderr(), question) {
+					return fmt.Errorf("apply cancelled")
+				}
+			}
+
+			applied, err := client.ApplyManifest(manifest, true, prune)
+			if err != nil {
+				return err
+			}
+			return printResult(applied, manifestPlanTable(applied))
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&file, "filename", "f", "course.yaml", "course manifest")
+	flags.BoolVar(&prune, "prune", false, "delete environments that are not in the manifest")
+	flags.BoolVar(&planOnly, "plan", false, "only show the plan")
+	flags.BoolVarP(&assumeYes, "yes", "y", false, "apply the plan without asking")
+	cmd.MarkFlagFilename("filename", "yaml", "yml", "json")
+	return cmd
+}
+
+// loadManifest reads a course manifest, merging the students of its roster
+// file, resolved relative to the manifest, into the roster.
+func loadManifest(file string) (*course.Manifest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var manifest course.Manifest
+	if err := yaml.UnmarshalStrict(data, &manifest); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", file, err)
+	}
+	if err := manifest.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+
+	if manifest.RosterFile != nil {
+		path := manifest.RosterFile.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(file), path)
+		}
+		rosterFile, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer rosterFile.Close()
+
+		students, err := roster.Parse(rosterFile, manifest.RosterFile.Format, roster.Mapping{NetID: manifest.RosterFile.NetIDColumn})
+		if err != nil {
+			return nil, fmt.Errorf("reading roster %s: %w", path, err)
+		}
+		for _, student := range students {
+			manifest.Roster = append(manifest.Roster, student.NetID)
+		}
+		manifest.RosterFile = nil
+	}
+	return &manifest, nil
+}
+
+func manifestPlanTable(plan *api.ManifestApplyResponse) func() *table {
+	return func() *table {
+		t := &table{headers: []string{"ACTION", "ASSIGNMENT", "NETID", "IMAGE", "PROFILE"}}
+		for _, change := range plan.Changes {
+			action := change.Action
+			if plan.Applied {
+				action += "d"
+			}
+			image, profile := change.Options.Image, change.Options.ResourceProfile
+			if change.Previous != nil {
+				if change.Previous.Image != image {
+					image = change.Previous.Image + " -> " + image
+				}
+				if change.Previous.ResourceProfile != profile {
+					profile = change.Previous.ResourceProfile + " -> " + profile
+				}
+			}
+			if profile == "" {
+				profile = "-"
+			}
+			t.add(action, change.AssignmentName, change.NetID, image, profile)
+		}
+		for _, environment := range plan.Retained {
+			t.add("retain", environment.AssignmentName, environment.NetID, "-", "-")
+		}
+		if plan.Unchanged > 0 {
+			t.add("unchanged", "", fmt.Sprintf("(%d environments)", plan.Unchanged), "", "")
+		}
+		return t
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Config is read from a YAML file such as:
+//
+//	server: https://provisioner.hive.example.edu
+//	token: <API token>
+type Config struct {
+	Server string `json:"server"`
+	Token  string `json:"token"`
+}
+
+func defaultConfigPath() string {
+	if path := os.Getenv("HIVECTL_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return filepath.Join(".hivectl", "config.yaml")
+	}
+	return filepath.Join(dir, "hivectl", "config.yaml")
+}
+
+// loadConfig reads the config file. A missing default config file is not an
+// error, so hivectl can be used with flags alone.
+func loadConfig(path string) (*Config, error) {
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath()
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := yaml.UnmarshalStrict(data, &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/spf13/cobra"
+)
+
+func newCourseCommand() *cobra.Command {
+	course := &cobra.Command{
+		Use:   "course",
+		Short: "Manage course settings",
+	}
+	course.AddCommand(newCourseQuotaCommand())
+	return course
+}
+
+func newCourseQuotaCommand() *cobra.Command {
+	var limit int
+	cmd := &cobra.Command{
+		Use:   "quota <course>",
+		Short: "Show or set the maximum number of environments in a course",
+		Example: `  hivectl course quota cpsc-323
+  hivectl course quota cpsc-323 --set 120
+  hivectl course quota cpsc-323 --set 0   # remove the limit`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			var quota *api.CourseQuota
+			if cmd.Flags().Changed("set") {
+				quota, err = client.SetCourseQuota(args[0], limit)
+			} else {
+				quota, err = client.GetCourseQuota(args[0])
+			}
+			if err != nil {
+				return err
+			}
+			return printResult(quota, func() *table {
+				t := &table{headers: []string{"COURSE", "ENVIRONMENTS", "LIMIT"}}
+				max := "unlimited"
+				if quota.MaxEnvironments > 0 {
+					max = fmt.Sprint(quota.MaxEnvironments)
+				}
+				t.add(quota.CourseName, quota.Environments, max)
+				return t
+			})
+		},
+	}
+	cmd.Flags().IntVar(&limit, "set", 0, "set the limit, 0 for unlimited")
+	return cmd
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/spf13/cobra"
+)
+
+func newEnvCommand() *cobra.Command {
+	env := &cobra.Command{
+		Use:     "env",
+		Aliases: []string{"environment", "environments"},
+		Short:   "Manage student environments",
+	}
+	env.AddCommand(
+		newEnvCreateCommand(),
+		newEnvListCommand(),
+		newEnvGetCommand(),
+		newEnvDeleteCommand(),
+		newEnvResetCommand(),
+		newEnvHibernateCommand(),
+		newEnvResumeCommand(),
+		newEnvLogsCommand(),
+		newEnvExecCommand(),
+	)
+	return env
+}
+
+// parseEnvironment reads an environment argument of the form
+// <course>/<assignment>/<netID>.
+func parseEnvironment(argument string) (address.Address, error) {
+	segments := strings.Split(argument, "/")
+	if len(segments) != 3 {
+		return address.Address{}, fmt.Errorf("environment %q must be of the form <course>/<assignment>/<netID>", argument)
+	}
+	return address.New(segments[1], segments[0], segments[2]), nil
+}
+
+// completeEnvironments suggests existing environments for shell completion.
+func completeEnvironments(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	client, err := newClient()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	list, err := client.ListEnvironments(address.Address{})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var names []string
+	for _, environment := range list.Environments {
+		if strings.HasPrefix(environment.String(), toComplete) {
+			names = append(names, environment.String())
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func environmentTable(environments []api.Environment) func() *table {
+	return func() *table {
+		t := &table{headers: []string{"COURSE", "ASSIGNMENT", "NETID", "STATUS", "URL"}}
+		for _, environment := range environments {
+			status := environment.Status
+			if status == "" {
+				status = "-"
+			}
+			if environment.Failure != nil {
+				status += " (" + environment.Failure.Reason + ")"
+			}
+			t.add(environment.CourseName, environment.AssignmentName, environment.NetID, status, environment.URL)
+		}
+		return t
+	}
+}
+
+func newEnvCreateCommand() *cobra.Command {
+	var request api.EnvironmentProvisionRequest
+	var wait bool
+	cmd := &cobra.Command{
+		Use:     "create",
+		Short:   "Provision environments for one or more students",
+		Example: `  hivectl env create --course "CPSC 323" --assignment pset1 --template cpsc323 --netid abc12 --netid def34`,
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if request.Image == "" && request.Template == "" {
+				return fmt.Errorf("one of --image or --template is required")
+			}
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			list, err := client.CreateEnvironments(request, wait)
+			if err != nil {
+				// A failed wait still reports each environment's status
+				if len(list.Environments) > 0 {
+					printResult(list, environmentTable(list.Environments))
+				}
+				return err
+			}
+			return printResult(list, environmentTable(list.Environments))
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&request.CourseName, "course", "", "course name")
+	flags.StringVar(&request.AssignmentName, "assignment", "", "assignment name")
+	flags.StringSliceVar(&request.NetIDs, "netid", nil, "student netID (repeatable or comma separated)")
+	flags.StringVar(&request.Image, "image", "", "environment image")
+	flags.StringVar(&request.Template, "template", "", "template to take the image from")
+	flags.StringVar(&request.ResourceProfile, "resource-profile", "", "resource profile: "+strings.Join(deployments.ResourceProfileNames(), ", "))
+	flags.BoolVar(&wait, "wait", false, "wait until the environments are ready, reporting why any failed")
+	cmd.MarkFlagRequired("course")
+	cmd.MarkFlagRequired("assignment")
+	cmd.MarkFlagRequired("netid")
+	return cmd
+}
+
+func newEnvListCommand() *cobra.Command {
+	var filter address.Address
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List environments",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			list, err := client.ListEnvironments(filter)
+			if err != nil {
+				return err
+			}
+			return printResult(list, environmentTable(list.Environments))
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&filter.CourseName, "course", "", "only list environments in this course")
+	flags.StringVar(&filter.AssignmentName, "assignment", "", "only list environments for this assignment")
+	flags.StringVar(&filter.NetID, "netid", "", "only list environments of this student")
+	return cmd
+}
+
+func newEnvGetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:               "get <course>/<assignment>/<netID>",
+		Short:             "Show an environment and its status",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeEnvironments,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			environment, err := parseEnvironment(args[0])
+			if err != nil {
+				return err
+			}
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			response, err := client.GetEnvironment(environment)
+			if err != nil {
+				return err
+			}
+			return printResult(response, environmentTable([]api.Environment{*response}))
+		},
+	}
+}
+
+func newEnvDeleteCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:               "delete <course>/<assignment>/<netID>...",
+		Aliases:           []string{"rm"},
+		Short:             "Delete environments and their routes",
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: completeEnvironments,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			for _, argument := range args {
+				environment, err := parseEnvironment(argument)
+				if err != nil {
+					return err
+				}
+				if err := client.DeleteEnvironment(environment); err != nil {
+					return fmt.Errorf("deleting %s: %w", environment, err)
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "deleted %s\n", environment)
+			}
+			return nil
+		},
+	}
+}
+
+func newEnvResetCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:               "reset <course>/<assignment>/<netID>",
+		Short:             "Restart an environment with a fresh workspace",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeEnvironments,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			environment, err := parseEnvironment(args[0])
+			if err != nil {
+				return err
+			}
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			if err := client.ResetEnvironment(environment); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "reset %s\n", environment)
+			return nil
+		},
+	}
+}
+
+func newEnvHibernateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:               "hibernate <course>/<assignment>/<netID>",
+		Short:             "Stop an environment's pod, keeping the environment",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeEnvironments,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			environment, err := parseEnvironment(args[0])
+			if err != nil {
+				return err
+			}
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			if err := client.HibernateEnvironment(environment); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "hibernated %s\n", environment)
+			return nil
+		},
+	}
+}
+
+func newEnvResumeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:               "resume <course>/<assignment>/<netID>",
+		Short:             "Start a hibernated environment again",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeEnvironments,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			environment, err := parseEnvironment(args[0])
+			if err != nil {
+				return err
+			}
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			if err := client.ResumeEnvironment(environment); err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "resumed %s\n", environment)
+			return nil
+		},
+	}
+}
+
+func newEnvLogsCommand() *cobra.Command {
+	var follow bool
+	var tail int
+	cmd := &cobra.Command{
+		Use:               "logs <course>/<assignment>/<netID>",
+		Short:             "Print the logs of an environment",
+		Args:              cobra.ExactArgs(1),
+		ValidArgsFunction: completeEnvironments,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			environment, err := parseEnvironment(args[0])
+			if err != nil {
+				return err
+			}
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			return client.StreamLogs(environment, follow, tail, cmd.OutOrStdout())
+		},
+	}
+	cmd.Flags().BoolVarP(&follow, "follow", "f", false, "stream new log lines")
+	cmd.Flags().IntVar(&tail, "tail", -1, "number of recent lines to show, -1 for all")
+	return cmd
+}
+
+func newEnvExecCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:               "exec <course>/<assignment>/<netID> -- <command> [args...]",
+		Short:             "Run a command in an environment",
+		Args:              cobra.MinimumNArgs(2),
+		ValidArgsFunction: completeEnvironments,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			environment, err := parseEnvironment(args[0])
+			if err != nil {
+				return err
+			}
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			response, err := client.Exec(environment, args[1:])
+			if err != nil {
+				return err
+			}
+			if options.output != OUTPUT_TABLE {
+				return printResult(response, nil)
+			}
+			fmt.Fprint(cmd.OutOrStdout(), response.Stdout)
+			fmt.Fprint(cmd.ErrOrStderr(), response.Stderr)
+			if response.ExitCode != 0 {
+				os.Exit(response.ExitCode)
+			}
+			return nil
+		},
+	}
+}
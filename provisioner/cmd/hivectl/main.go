@@ -0,0 +1,81 @@
+// hivectl is the administrator command-line interface to the HiVE
+// provisioner HTTP API.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/spf13/cobra"
+)
+
+type globalOptions struct {
+	configPath string
+	server     string
+	token      string
+	output     string
+}
+
+var options globalOptions
+
+func newRootCommand() *cobra.Command {
+	root := &cobra.Command{
+		Use:           "hivectl",
+		Short:         "Manage HiVE environments through the provisioner API",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+	}
+
+	flags := root.PersistentFlags()
+	flags.StringVar(&options.configPath, "config", "", "config file (default "+defaultConfigPath()+")")
+	flags.StringVar(&options.server, "server", "", "provisioner URL, overriding the config file")
+	flags.StringVar(&options.token, "token", "", "API token, overriding the config file")
+	flags.StringVarP(&options.output, "output", "o", OUTPUT_TABLE, "output format: table, json or yaml")
+	root.RegisterFlagCompletionFunc("output", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{OUTPUT_TABLE, OUTPUT_JSON, OUTPUT_YAML}, cobra.ShellCompDirectiveNoFileComp
+	})
+
+	root.AddCommand(
+		newEnvCommand(),
+		newCourseCommand(),
+		newRouteCommand(),
+		newTemplateCommand(),
+		newRosterCommand(),
+		newApplyCommand(),
+		newRenderCommand(),
+	)
+	return root
+}
+
+// newClient builds an API client from the config file, with flags and
+// environment variables taking precedence.
+func newClient() (*api.Client, error) {
+	config, err := loadConfig(options.configPath)
+	if err != nil {
+		return nil, err
+	}
+	if server := os.Getenv("HIVECTL_SERVER"); server != "" {
+		config.Server = server
+	}
+	if token := os.Getenv("HIVECTL_TOKEN"); token != "" {
+		config.Token = token
+	}
+	if options.server != "" {
+		config.Server = options.server
+	}
+	if options.token != "" {
+		config.Token = options.token
+	}
+	if config.Server == "" {
+		return nil, fmt.Errorf("no provisioner server configured; set server in %s or pass --server", defaultConfigPath())
+	}
+	return api.NewClient(config.Server, config.Token), nil
+}
+
+func main() {
+	if err := newRootCommand().Execute(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		os.Exit(1)
+	}
+}
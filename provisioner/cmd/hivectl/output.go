@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	OUTPUT_TABLE = "table"
+	OUTPUT_JSON  = "json"
+	OUTPUT_YAML  = "yaml"
+)
+
+// table is the tabular rendering of a response, used for the default output.
+type table struct {
+	headers []string
+	rows    [][]string
+}
+
+func (t *table) add(columns ...interface{}) {
+	row := make([]string, len(columns))
+	for i, column := range columns {
+		row[i] = fmt.Sprint(column)
+	}
+	t.rows = append(t.rows, row)
+}
+
+// printResult writes value in the selected output format. The table is only
+// built for table output.
+func printResult(value interface{}, buildTable func() *table) error {
+	return writeResult(os.Stdout, options.output, value, buildTable)
+}
+
+func writeResult(out io.Writer, format string, value interface{}, buildTable func() *table) error {
+	switch format {
+	case OUTPUT_JSON:
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case OUTPUT_YAML:
+		data, err := yaml.Marshal(value)
+		if err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+	case OUTPUT_TABLE, "":
+		t := buildTable()
+		writer := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.Join(t.headers, "\t"))
+		for _, row := range t.rows {
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		return writer.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/gateway"
+	"github.com/BradleyLewis08/HiVE/internal/ingress"
+	"github.com/BradleyLewis08/HiVE/internal/proxymanager"
+	"github.com/BradleyLewis08/HiVE/internal/render"
+	"github.com/BradleyLewis08/HiVE/internal/routing"
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newRenderCommand() *cobra.Command {
+	var request api.EnvironmentProvisionRequest
+	var backend string
+	var gatewayConfig gateway.Config
+	var serverSide bool
+	cmd := &cobra.Command{
+		Use:   "render",
+		Short: "Print the objects a provisioning request would create",
+		Long: `Renders the Deployment and Service of each requested environment and the
+routing objects (Ingress, master-router ConfigMap or HTTPRoutes) that expose
+them, as YAML, without touching the cluster. These are all the objects the
+provisioner creates; environments have no PersistentVolumeClaims or
+NetworkPolicies.
+
+Rendering is done locally by default, where shared routing objects contain
+only the requested routes. With --server-side the provisioner renders the
+request using its own router and templates, includes the routes already in
+place, and validates every object with a server-side dry run.`,
+		Example: `  hivectl render --course cpsc-323 --assignment pset1 --netid abc12 --image codercom/code-server:latest
+  hivectl render --course cpsc-323 --assignment pset1 --netid abc12 --template cpsc323 --server-side`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var objects []*unstructured.Unstructured
+			if serverSide {
+				client, err := newClient()
+				if err != nil {
+					return err
+				}
+				response, err := client.RenderEnvironments(request)
+				if err != nil {
+					return err
+				}
+				for _, message := range response.Errors {
+					fmt.Fprintln(cmd.ErrOrStderr(), "Error:", message)
+				}
+				if err := printObjects(response.Objects); err != nil {
+					return err
+				}
+				if len(response.Errors) > 0 {
+					return fmt.Errorf("%d objects failed the server-side dry run", len(response.Errors))
+				}
+				return nil
+			}
+
+			if request.Template != "" {
+				return fmt.Errorf("--template needs the provisioner's templates; pass --image or use --server-side")
+			}
+			options := deployments.EnvironmentOptions{Image: request.Image, ResourceProfile: request.ResourceProfile}
+			if err := options.Validate(); err != nil {
+				return err
+			}
+			renderer, err := localRenderer(backend, gatewayConfig)
+			if err != nil {
+				return err
+			}
+
+			renderRequest := render.Request{
+				CourseName:     request.CourseName,
+				AssignmentName: request.AssignmentName,
+				NetIDs:         request.NetIDs,
+				Options:        options,
+			}
+			objects, err = render.Environments(renderRequest, renderer, renderRequest.Addresses())
+			if err != nil {
+				return err
+			}
+			return printObjects(objects)
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVar(&request.CourseName, "course", "", "course name")
+	flags.StringVar(&request.AssignmentName, "assignment", "", "assignment name")
+	flags.StringSliceVar(&request.NetIDs, "netid", nil, "student netID (repeatable or comma separated)")
+	flags.StringVar(&request.Image, "image", "", "environment image")
+	flags.StringVar(&request.Template, "template", "", "template to take the image from (server-side only)")
+	flags.StringVar(&request.ResourceProfile, "resource-profile", "", "resource profile: "+strings.Join(deployments.ResourceProfileNames(), ", "))
+	flags.BoolVar(&serverSide, "server-side", false, "render on the provisioner and validate with a server-side dry run")
+	flags.StringVar(&backend, "router", routing.BACKEND_INGRESS, "routing backend to render locally: ingress, nginx or gateway")
+	flags.StringVar(&gatewayConfig.GatewayName, "gateway-name", "", "Gateway the HTTPRoutes attach to")
+	flags.StringVar(&gatewayConfig.GatewayNamespace, "gateway-namespace", "", "namespace of the Gateway")
+	flags.StringVar(&gatewayConfig.Scope, "gateway-scope", gateway.SCOPE_ENVIRONMENT, "HTTPRoute scope: environment or course")
+	flags.StringVar(&gatewayConfig.Hostname, "gateway-hostname", "", "hostname the HTTPRoutes are bound to")
+	flags.BoolVar(&gatewayConfig.MatchHost, "gateway-match-host", false, "serve environments from their own hostname")
+	cmd.MarkFlagRequired("course")
+	cmd.MarkFlagRequired("assignment")
+	cmd.MarkFlagRequired("netid")
+	cmd.RegisterFlagCompletionFunc("router", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return []string{routing.BACKEND_INGRESS, routing.BACKEND_NGINX, routing.BACKEND_GATEWAY}, cobra.ShellCompDirectiveNoFileComp
+	})
+	return cmd
+}
+
+// localRenderer builds a routing backend without a cluster connection; it
+// is only used to render objects.
+func localRenderer(backend string, gatewayConfig gateway.Config) (routing.Renderer, error) {
+	switch backend {
+	case routing.BACKEND_INGRESS:
+		return ingress.NewIngressManager(nil), nil
+	case routing.BACKEND_NGINX:
+		return proxymanager.NewProxyManager(nil, deployments.NginxOptions{}), nil
+	case routing.BACKEND_GATEWAY:
+		return gateway.NewHTTPRouteManager(nil, gatewayConfig)
+	default:
+		return nil, fmt.Errorf("unknown router backend %q", backend)
+	}
+}
+
+// printObjects writes objects as a YAML stream, or as a JSON list with -o json.
+func printObjects(objects []*unstructured.Unstructured) error {
+	if options.output == OUTPUT_JSON {
+		return writeResult(os.Stdout, OUTPUT_JSON, objects, nil)
+	}
+	data, err := render.YAML(objects)
+	if err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
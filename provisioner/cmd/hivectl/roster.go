@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/api"
+	"github.com/BradleyLewis08/HiVE/internal/roster"
+	"github.com/spf13/cobra"
+)
+
+func newRosterCommand() *cobra.Command {
+	rosterCmd := &cobra.Command{
+		Use:   "roster",
+		Short: "Provision environments from a class roster",
+	}
+	rosterCmd.AddCommand(newRosterImportCommand())
+	return rosterCmd
+}
+
+func newRosterImportCommand() *cobra.Command {
+	var file string
+	var assumeYes bool
+	var planOnly bool
+	var importOptions api.RosterImportOptions
+	cmd := &cobra.Command{
+		Use:   "import <course> -f <file> --assignment <assignment>",
+		Short: "Add and remove environments so an assignment matches a roster",
+		Long: `Compares a roster export against the environments provisioned for an
+assignment and shows the students that would be added and removed. The plan
+is applied after confirmation, or straight away with --yes.`,
+		Example: `  hivectl roster import cpsc-323 -f roster.csv --assignment pset1 --template cpsc323
+  hivectl roster import cpsc-323 -f grades.csv --format canvas --assignment pset1 --template cpsc323 --plan
+  hivectl roster import cpsc-323 -f export.csv --netid-column "Email" --assignment pset1 --image code-server:latest --yes`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if file == "-" && !assumeYes && !planOnly {
+				return fmt.Errorf("--yes or --plan is required when reading the roster from standard input")
+			}
+			data, err := readRoster(file)
+			if err != nil {
+				return err
+			}
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+
+			importOptions.Apply = false
+			plan, err := client.ImportRoster(args[0], importOptions, bytes.NewReader(data))
+			if err != nil {
+				return err
+			}
+			if planOnly || plan.Empty() {
+				return printResult(plan, rosterPlanTable(plan))
+			}
+
+			if !assumeYes {
+				if err := writeResult(cmd.ErrOrStderr(), OUTPUT_TABLE, plan, rosterPlanTable(plan)); err != nil {
+					return err
+				}
+				if !confirm(cmd.InOrStdin(), cmd.ErrOrStderr(), fmt.Sprintf("Add %d and remove %d environments?", len(plan.Add), len(plan.Remove))) {
+					return fmt.Errorf("roster import cancelled")
+				}
+			}
+
+			importOptions.Apply = true
+			applied, err := client.ImportRoster(args[0], importOptions, bytes.NewReader(data))
+			if err != nil {
+				return err
+			}
+			return printResult(applied, rosterPlanTable(applied))
+		},
+	}
+	flags := cmd.Flags()
+	flags.StringVarP(&file, "filename", "f", "", "roster file, or - for standard input")
+	flags.StringVar(&importOptions.AssignmentName, "assignment", "", "assignment to provision")
+	flags.StringVar(&importOptions.Format, "format", roster.FORMAT_CSV, "roster format: "+strings.Join(roster.Formats(), ", "))
+	flags.StringVar(&importOptions.Mapping.NetID, "netid-column", "", "column holding netIDs, if not the format's default")
+	flags.StringVar(&importOptions.Mapping.Name, "name-column", "", "column holding student names, if not the format's default")
+	flags.StringVar(&importOptions.Image, "image", "", "image for new environments")
+	flags.StringVar(&importOptions.Template, "template", "", "template to take the image for new environments from")
+	flags.StringVar(&importOptions.ResourceProfile, "resource-profile", "", "resource profile for new environments: "+strings.Join(deployments.ResourceProfileNames(), ", "))
+	flags.BoolVar(&planOnly, "plan", false, "only show the plan")
+	flags.BoolVarP(&assumeYes, "yes", "y", false, "apply the plan without asking")
+	cmd.MarkFlagRequired("filename")
+	cmd.MarkFlagRequired("assignment")
+	cmd.MarkFlagFilename("filename", "csv", "tsv", "txt")
+	cmd.RegisterFlagCompletionFunc("format", func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return roster.Formats(), cobra.ShellCompDirectiveNoFileComp
+	})
+	return cmd
+}
+
+func readRoster(file string) ([]byte, error) {
+	if file == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(file)
+}
+
+func rosterPlanTable(plan *api.RosterImportResponse) func() *table {
+	return func() *table {
+		t := &table{headers: []string{"CHANGE", "COURSE", "ASSIGNMENT", "NETID"}}
+		add, remove := "add", "remove"
+		if plan.Applied {
+			add, remove = "added", "removed"
+		}
+		for _, netID := range plan.Add {
+			t.add(add, plan.CourseName, plan.AssignmentName, netID)
+		}
+		for _, netID := range plan.Remove {
+			t.add(remove, plan.CourseName, plan.AssignmentName, netID)
+		}
+		if plan.Unchanged > 0 {
+			t.add("unchanged", plan.CourseName, plan.AssignmentName, fmt.Sprintf("(%d students)", plan.Unchanged))
+		}
+		return t
+	}
+}
+
+func confirm(in io.Reader, out io.Writer, question string) bool {
+	fmt.Fprintf(out, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+func newRouteCommand() *cobra.Command {
+	route := &cobra.Command{
+		Use:     "route",
+		Aliases: []string{"routes"},
+		Short:   "Inspect and repair environment routing",
+	}
+	route.AddCommand(newRouteListCommand(), newRouteSyncCommand(), newRouteStatusCommand())
+	return route
+}
+
+func newRouteListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List the routes exposed by the active router",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			list, err := client.ListRoutes()
+			if err != nil {
+				return err
+			}
+			return printResult(list, environmentTable(list.Environments))
+		},
+	}
+}
+
+func newRouteSyncCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "sync",
+		Short: "Rebuild routes from the environments running in the cluster",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			result, err := client.SyncRoutes()
+			if err != nil {
+				return err
+			}
+			return printResult(result, func() *table {
+				t := &table{headers: []string{"CHANGE", "ENVIRONMENT"}}
+				for _, environment := range result.Added {
+					t.add("added", environment)
+				}
+				for _, environment := range result.Removed {
+					t.add("removed", environment)
+				}
+				return t
+			})
+		},
+	}
+}
+
+func newRouteStatusCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "status",
+		Short: "Show whether the router is ready",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			status, err := client.RouterStatus()
+			if err != nil {
+				return err
+			}
+			return printResult(status, func() *table {
+				t := &table{headers: []string{"BACKEND", "READY", "REPLICAS", "ADDRESS"}}
+				t.add(status.Backend, status.Ready, fmt.Sprintf("%d/%d", status.ReadyReplicas, status.Replicas), status.Address)
+				return t
+			})
+		},
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BradleyLewis08/HiVE/internal/templates"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+)
+
+func newTemplateCommand() *cobra.Command {
+	template := &cobra.Command{
+		Use:     "template",
+		Aliases: []string{"templates"},
+		Short:   "Manage environment templates",
+	}
+	template.AddCommand(newTemplateListCommand(), newTemplateApplyCommand())
+	return template
+}
+
+func templateTable(list []templates.Template) func() *table {
+	return func() *table {
+		t := &table{headers: []string{"NAME", "IMAGE", "DESCRIPTION"}}
+		for _, template := range list {
+			t.add(template.Name, template.Image, template.Description)
+		}
+		return t
+	}
+}
+
+func newTemplateListCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "List environment templates",
+		Args:    cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			list, err := client.ListTemplates()
+			if err != nil {
+				return err
+			}
+			return printResult(list, templateTable(list))
+		},
+	}
+}
+
+func newTemplateApplyCommand() *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:   "apply -f <file>",
+		Short: "Create or update a template from a YAML or JSON file",
+		Example: `  # cpsc323.yaml
+  name: cpsc323
+  description: C toolchain with gdb and valgrind
+  image: ghcr.io/example/cpsc323-code-server:2024
+
+  hivectl template apply -f cpsc323.yaml`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			var template templates.Template
+			if err := yaml.UnmarshalStrict(data, &template); err != nil {
+				return fmt.Errorf("parsing %s: %w", file, err)
+			}
+			if err := template.Validate(); err != nil {
+				return err
+			}
+			client, err := newClient()
+			if err != nil {
+				return err
+			}
+			applied, err := client.ApplyTemplate(template)
+			if err != nil {
+				return err
+			}
+			return printResult(applied, templateTable([]templates.Template{*applied}))
+		},
+	}
+	cmd.Flags().StringVarP(&file, "filename", "f", "", "template file")
+	cmd.MarkFlagRequired("filename")
+	cmd.MarkFlagFilename("filename", "yaml", "yml", "json")
+	return cmd
+}
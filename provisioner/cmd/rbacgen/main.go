@@ -0,0 +1,26 @@
+// rbacgen prints the ServiceAccount, Role and RoleBinding the provisioner
+// needs, as kept in deploy/rbac.yaml.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	k8sclient "github.com/BradleyLewis08/HiVE/internal/kubernetes"
+	"github.com/BradleyLewis08/HiVE/internal/render"
+)
+
+func main() {
+	objects, err := render.ToUnstructured(k8sclient.RBACManifests())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	data, err := render.YAML(objects)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	fmt.Println("# Generated by cmd/rbacgen; run go generate ./internal/kubernetes after changing POLICY_RULES.")
+	os.Stdout.Write(data)
+}
@@ -3,27 +3,48 @@ package deployments
 import (
 	"fmt"
 
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/naming"
 	"github.com/BradleyLewis08/HiVE/internal/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
 var CODER_PORT = 8080
 
-func NewEnvironmentDeployment(assignmentName string, courseName string, imageName string, netId string) *appsv1.Deployment {
-	deploymentName := utils.ConstructEnvironmentDeploymentName(assignmentName, courseName, netId)
-	labels := map[string]string{
-		"app": "hive-course",
-		"course": courseName,
-		"assignment": assignmentName,
-		"student": netId,
+const ENVIRONMENT_CONTAINER = "code-server"
+
+// Served by code-server without authentication
+const CODER_HEALTH_PATH = "/healthz"
+
+func NewEnvironmentDeployment(assignmentName string, courseName string, netId string, options EnvironmentOptions) (*appsv1.Deployment, error) {
+	environment := address.New(assignmentName, courseName, netId)
+	deploymentName := environment.DeploymentName()
+	labels := environment.Labels()
+
+	resources, err := ResourceProfile(options.ResourceProfile)
+	if err != nil {
+		return nil, err
+	}
+	annotations := naming.OriginalAnnotations(assignmentName, courseName, netId)
+	if options.ResourceProfile != "" {
+		annotations[RESOURCE_PROFILE_ANNOTATION] = options.ResourceProfile
+	}
+
+	healthProbe := apiv1.ProbeHandler{
+		HTTPGet: &apiv1.HTTPGetAction{
+			Path: CODER_HEALTH_PATH,
+			Port: intstr.FromInt(CODER_PORT),
+		},
 	}
 
     deployment := &appsv1.Deployment{
         ObjectMeta: metav1.ObjectMeta{
             Name: deploymentName,
             Labels: labels,
+            Annotations: annotations,
         },
         Spec: appsv1.DeploymentSpec{
             Replicas: utils.Int32ptr(1),
@@ -37,18 +58,33 @@ func NewEnvironmentDeployment(assignmentName string, courseName string, imageNam
                 Spec: apiv1.PodSpec{
 					Containers: []apiv1.Container {
 						{
-							Name: "code-server",
-							Image: imageName,
+							Name: ENVIRONMENT_CONTAINER,
+							Image: options.Image,
+							Resources: resources,
 							Ports: []apiv1.ContainerPort {
 								{
 									Name: "http",
 									ContainerPort: 8080,
 								},
 							},
+							ReadinessProbe: &apiv1.Probe{
+								ProbeHandler: healthProbe,
+								PeriodSeconds: 5,
+								FailureThreshold: 3,
+							},
+							// code-server can take a while to start on a
+							// cold node, so only restart it once it has had
+							// time to come up
+							LivenessProbe: &apiv1.Probe{
+								ProbeHandler: healthProbe,
+								InitialDelaySeconds: 30,
+								PeriodSeconds: 20,
+								FailureThreshold: 3,
+							},
 							VolumeMounts: []apiv1.VolumeMount {
 								{
 									Name: "workspace",
-									MountPath: fmt.Sprintf("home/coder/proj/%s", netId),
+									MountPath: fmt.Sprintf("home/coder/proj/%s", environment.NetID),
 								},
 							},
 						},
@@ -66,5 +102,16 @@ func NewEnvironmentDeployment(assignmentName string, courseName string, imageNam
             },
         },
     }
-	return deployment
-} 
\ No newline at end of file
+	return deployment, nil
+} 
+// OwnerReference points an environment's other objects, such as its
+// Service, at its Deployment, so that deleting the Deployment deletes them
+// too. The Deployment must have been created, so that it has a UID.
+func OwnerReference(deployment *appsv1.Deployment) metav1.OwnerReference {
+	return metav1.OwnerReference{
+		APIVersion: appsv1.SchemeGroupVersion.String(),
+		Kind:       "Deployment",
+		Name:       deployment.Name,
+		UID:        deployment.UID,
+	}
+}
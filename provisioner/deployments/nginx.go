@@ -1,20 +1,38 @@
 package deployments
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/BradleyLewis08/HiVE/internal/utils"
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
-// TODO: Make this dynamic
+const NGINX_NAME = "master-router"
+const NGINX_HEALTH_PATH = "/healthz"
 
-var LOAD_BALANCER_SUFFIX_URL = "-lb.default.svc.cluster.local"
+// Pinned so that router pods never silently change nginx versions
+const DEFAULT_NGINX_IMAGE = "nginx:1.27.2"
+const DEFAULT_NGINX_REPLICAS = 3
 
-const NGINX_NAME = "master-router"
+// How long the router waits after its config changes before rolling its
+// pods. Every change within the delay, such as provisioning a whole class,
+// is rolled out together.
+const DEFAULT_NGINX_ROLLOUT_DELAY = 10 * time.Second
+
+// Pod template annotation holding a hash of the rendered nginx.conf. The
+// ConfigMap is mounted with a SubPath and is never refreshed in running pods,
+// so changing the hash is what rolls the router onto a new config.
+const NGINX_CONFIG_HASH_ANNOTATION = "hive-config-hash"
 const NGINX_BASE_CONFIG = `
 	events {}
 	http {
@@ -38,22 +56,36 @@ const NGINX_BASE_CONFIG = `
 			
 			# Increase max body size if needed
 			client_max_body_size 10m;
+
+			# Liveness and readiness probes
+			location = /healthz {
+				access_log off;
+				return 200 "ok";
+			}
 			%s
 		}
 	}
 `
 
+// Routes map an environment path to the URL of its Service. Locations are
+// rendered in sorted order so the same routes always produce the same config.
 func constructLocationBlocks(routes map[string]string) string {
 	var locationBlocks strings.Builder
 
-	for path, service := range routes {
+	paths := make([]string, 0, len(routes))
+	for path := range routes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
 		locationBlocks.WriteString(fmt.Sprintf(`
-		location /%s/ {
-			proxy_pass http://%s:8080/;
+		location %s/ {
+			proxy_pass %s/;
 			proxy_set_header X-Original-URI $request_uri;
 			proxy_set_header Accept-Encoding "";
 		}
-		`, path, service))
+		`, path, routes[path]))
 	}
 
 	return locationBlocks.String()
@@ -72,10 +104,14 @@ func DefaultNginxConfigMap() *apiv1.ConfigMap {
 	return configMap
 } 
 
-func NewNginxConfigMap(routes map[string]string) (*apiv1.ConfigMap) {
+func NewNginxConfigMap(routes map[string]string) (*apiv1.ConfigMap, error) {
 	locationBlocks := constructLocationBlocks(routes)
 	configData := fmt.Sprintf(NGINX_BASE_CONFIG, locationBlocks)
 
+	if err := ValidateNginxConfig(configData); err != nil {
+		return nil, fmt.Errorf("invalid nginx config: %w", err)
+	}
+
 	configMap := &apiv1.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			Name: NGINX_NAME,
@@ -85,14 +121,67 @@ func NewNginxConfigMap(routes map[string]string) (*apiv1.ConfigMap) {
 		},
 	}
 
-	return configMap
+	return configMap, nil
 }
 
-func NewNginxDeployment(configMapName string) *appsv1.Deployment { 
-	labels := map[string]string {
+// Location blocks written by constructLocationBlocks; the healthz location
+// is an exact match and is not picked up
+var nginxLocationPattern = regexp.MustCompile(`(?m)^\s*location (/\S*)/ \{`)
+
+// NginxConfigPaths returns the route paths proxied by a master-router
+// ConfigMap, in the order they appear.
+func NginxConfigPaths(configMap *apiv1.ConfigMap) []string {
+	var paths []string
+	for _, match := range nginxLocationPattern.FindAllStringSubmatch(configMap.Data["nginx.conf"], -1) {
+		paths = append(paths, match[1])
+	}
+	return paths
+}
+
+func NginxConfigHash(configMap *apiv1.ConfigMap) string {
+	sum := sha256.Sum256([]byte(configMap.Data["nginx.conf"]))
+	return hex.EncodeToString(sum[:])
+}
+
+type NginxOptions struct {
+	Image string
+	Replicas int32
+	RolloutDelay time.Duration
+}
+
+// WithDefaults fills in the default of every option left unset.
+func (o NginxOptions) WithDefaults() NginxOptions {
+	if o.Image == "" {
+		o.Image = DEFAULT_NGINX_IMAGE
+	}
+	if o.Replicas <= 0 {
+		o.Replicas = DEFAULT_NGINX_REPLICAS
+	}
+	if o.RolloutDelay <= 0 {
+		o.RolloutDelay = DEFAULT_NGINX_ROLLOUT_DELAY
+	}
+	return o
+}
+
+func nginxLabels() map[string]string {
+	return map[string]string {
 		"app": "nginx-reverse-proxy",
 		"hive-component": "reverse-proxy",
 	}
+}
+
+func NewNginxDeployment(configMapName string, configHash string, options NginxOptions) *appsv1.Deployment { 
+	options = options.WithDefaults()
+	labels := nginxLabels()
+
+	healthProbe := apiv1.ProbeHandler{
+		HTTPGet: &apiv1.HTTPGetAction{
+			Path: NGINX_HEALTH_PATH,
+			Port: intstr.FromInt(80),
+		},
+	}
+	maxUnavailable := intstr.FromInt(0)
+	maxSurge := intstr.FromInt(1)
 
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -100,24 +189,62 @@ func NewNginxDeployment(configMapName string) *appsv1.Deployment {
 			Labels: labels,
 		},
 		Spec: appsv1.DeploymentSpec{
-			Replicas: utils.Int32ptr(1),
+			Replicas: utils.Int32ptr(options.Replicas),
 			Selector: &metav1.LabelSelector{
 				MatchLabels: labels,
 			},
+			// Never take a router pod down before its replacement is ready
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RollingUpdateDeploymentStrategyType,
+				RollingUpdate: &appsv1.RollingUpdateDeployment{
+					MaxUnavailable: &maxUnavailable,
+					MaxSurge: &maxSurge,
+				},
+			},
 			Template: apiv1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
 					Labels: labels,
+					Annotations: map[string]string{
+						NGINX_CONFIG_HASH_ANNOTATION: configHash,
+					},
 				},
 				Spec: apiv1.PodSpec{
+					// Spread replicas across nodes and zones so a single
+					// drain cannot take every environment offline
+					TopologySpreadConstraints: []apiv1.TopologySpreadConstraint{
+						{
+							MaxSkew: 1,
+							TopologyKey: "kubernetes.io/hostname",
+							WhenUnsatisfiable: apiv1.DoNotSchedule,
+							LabelSelector: &metav1.LabelSelector{MatchLabels: labels},
+						},
+						{
+							MaxSkew: 1,
+							TopologyKey: "topology.kubernetes.io/zone",
+							WhenUnsatisfiable: apiv1.ScheduleAnyway,
+							LabelSelector: &metav1.LabelSelector{MatchLabels: labels},
+						},
+					},
 					Containers: []apiv1.Container{
 						{
 							Name:  "nginx",
-							Image: "nginx:latest",
+							Image: options.Image,
 							Ports: []apiv1.ContainerPort{
 								{
 									ContainerPort: 80,
 								},
 							},
+							ReadinessProbe: &apiv1.Probe{
+								ProbeHandler: healthProbe,
+								PeriodSeconds: 5,
+								FailureThreshold: 2,
+							},
+							LivenessProbe: &apiv1.Probe{
+								ProbeHandler: healthProbe,
+								InitialDelaySeconds: 5,
+								PeriodSeconds: 10,
+								FailureThreshold: 3,
+							},
 							VolumeMounts: []apiv1.VolumeMount{
 								{
 									Name:      "nginx-config",
@@ -145,3 +272,21 @@ func NewNginxDeployment(configMapName string) *appsv1.Deployment {
 	}
 	return deployment
 }
+
+// NewNginxPodDisruptionBudget keeps at least one router replica running
+// through voluntary disruptions such as node drains.
+func NewNginxPodDisruptionBudget() *policyv1.PodDisruptionBudget {
+	maxUnavailable := intstr.FromInt(1)
+	return &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: NGINX_NAME,
+			Labels: nginxLabels(),
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			MaxUnavailable: &maxUnavailable,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: nginxLabels(),
+			},
+		},
+	}
+}
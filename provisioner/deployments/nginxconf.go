@@ -0,0 +1,193 @@
+package deployments
+
+import (
+	"fmt"
+	"strings"
+)
+
+// nginxDirective is a single parsed nginx directive, along with its block
+// if it opens one (e.g. http, server, location).
+type nginxDirective struct {
+	Name     string
+	Args     []string
+	Line     int
+	HasBlock bool
+	Block    []*nginxDirective
+}
+
+type nginxToken struct {
+	Value  string
+	Line   int
+	Quoted bool
+}
+
+// ValidateNginxConfig performs the structural checks `nginx -t` would for
+// the configs the provisioner generates: balanced braces and quotes,
+// terminated directives, and no duplicate locations within a server.
+func ValidateNginxConfig(config string) error {
+	tokens, err := tokenizeNginxConfig(config)
+	if err != nil {
+		return err
+	}
+
+	directives, rest, err := parseNginxBlock(tokens, 0)
+	if err != nil {
+		return err
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("line %d: unexpected \"}\"", rest[0].Line)
+	}
+
+	return validateNginxDirectives(directives, "main")
+}
+
+func tokenizeNginxConfig(config string) ([]nginxToken, error) {
+	var tokens []nginxToken
+	line := 1
+	i := 0
+	for i < len(config) {
+		c := config[i]
+		switch {
+		case c == '\n':
+			line++
+			i++
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+		case c == '#':
+			for i < len(config) && config[i] != '\n' {
+				i++
+			}
+		case c == '{' || c == '}' || c == ';':
+			tokens = append(tokens, nginxToken{Value: string(c), Line: line})
+			i++
+		case c == '"' || c == '\'':
+			start := line
+			var value strings.Builder
+			i++
+			for {
+				if i >= len(config) {
+					return nil, fmt.Errorf("line %d: unterminated quoted string", start)
+				}
+				if config[i] == '\\' && i+1 < len(config) {
+					value.WriteByte(config[i+1])
+					i += 2
+					continue
+				}
+				if config[i] == c {
+					i++
+					break
+				}
+				if config[i] == '\n' {
+					line++
+				}
+				value.WriteByte(config[i])
+				i++
+			}
+			tokens = append(tokens, nginxToken{Value: value.String(), Line: start, Quoted: true})
+		default:
+			start := i
+			for i < len(config) && !strings.ContainsRune(" \t\r\n{};#\"'", rune(config[i])) {
+				i++
+			}
+			tokens = append(tokens, nginxToken{Value: config[start:i], Line: line})
+		}
+	}
+	return tokens, nil
+}
+
+// parseNginxBlock parses directives until the closing brace of the current
+// block (depth > 0) or the end of input (depth == 0).
+func parseNginxBlock(tokens []nginxToken, depth int) ([]*nginxDirective, []nginxToken, error) {
+	var directives []*nginxDirective
+	for len(tokens) > 0 {
+		token := tokens[0]
+		if !token.Quoted && token.Value == "}" {
+			if depth == 0 {
+				return directives, tokens, nil
+			}
+			return directives, tokens[1:], nil
+		}
+		if !token.Quoted && (token.Value == "{" || token.Value == ";") {
+			return nil, nil, fmt.Errorf("line %d: unexpected %q", token.Line, token.Value)
+		}
+
+		directive := &nginxDirective{Name: token.Value, Line: token.Line}
+		tokens = tokens[1:]
+		for {
+			if len(tokens) == 0 {
+				return nil, nil, fmt.Errorf("line %d: directive %q is not terminated by \";\"", directive.Line, directive.Name)
+			}
+			next := tokens[0]
+			tokens = tokens[1:]
+			if next.Quoted {
+				directive.Args = append(directive.Args, next.Value)
+				continue
+			}
+			if next.Value == ";" {
+				break
+			}
+			if next.Value == "}" {
+				return nil, nil, fmt.Errorf("line %d: directive %q is not terminated by \";\"", directive.Line, directive.Name)
+			}
+			if next.Value == "{" {
+				block, rest, err := parseNginxBlock(tokens, depth+1)
+				if err != nil {
+					return nil, nil, err
+				}
+				directive.HasBlock = true
+				directive.Block = block
+				tokens = rest
+				break
+			}
+			directive.Args = append(directive.Args, next.Value)
+		}
+		directives = append(directives, directive)
+	}
+	if depth > 0 {
+		return nil, nil, fmt.Errorf("unexpected end of file, expecting \"}\"")
+	}
+	return directives, nil, nil
+}
+
+func validateNginxDirectives(directives []*nginxDirective, context string) error {
+	locations := make(map[string]int)
+	for _, directive := range directives {
+		switch directive.Name {
+		case "events", "http", "server":
+			if !directive.HasBlock || len(directive.Args) != 0 {
+				return fmt.Errorf("line %d: invalid %q block", directive.Line, directive.Name)
+			}
+		case "map":
+			if !directive.HasBlock || len(directive.Args) != 2 {
+				return fmt.Errorf("line %d: invalid number of arguments in \"map\" directive", directive.Line)
+			}
+		case "location":
+			if !directive.HasBlock || len(directive.Args) < 1 || len(directive.Args) > 2 {
+				return fmt.Errorf("line %d: invalid number of arguments in \"location\" directive", directive.Line)
+			}
+			if context != "server" && context != "location" {
+				return fmt.Errorf("line %d: \"location\" directive is not allowed here", directive.Line)
+			}
+			key := strings.Join(directive.Args, " ")
+			if previous, ok := locations[key]; ok {
+				return fmt.Errorf("line %d: duplicate location %q (first defined on line %d)", directive.Line, key, previous)
+			}
+			locations[key] = directive.Line
+		case "proxy_pass", "listen", "return":
+			if directive.HasBlock || len(directive.Args) == 0 {
+				return fmt.Errorf("line %d: invalid number of arguments in %q directive", directive.Line, directive.Name)
+			}
+		default:
+			if directive.HasBlock && context != "map" {
+				return fmt.Errorf("line %d: unknown block directive %q", directive.Line, directive.Name)
+			}
+		}
+
+		if directive.HasBlock && directive.Name != "map" {
+			if err := validateNginxDirectives(directive.Block, directive.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package deployments
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateNginxConfig(t *testing.T) {
+	valid := []struct {
+		name   string
+		config string
+	}{
+		{"default config", fmt.Sprintf(NGINX_BASE_CONFIG, "")},
+		{"routes", fmt.Sprintf(NGINX_BASE_CONFIG, constructLocationBlocks(map[string]string{
+			"/environment/cpsc323/hw1/alice": "http://alice.default.svc.cluster.local:80",
+			"/environment/cpsc323/hw1/bob":   "http://bob.default.svc.cluster.local:80",
+		}))},
+		{"comments", "events {} # no events\nhttp { server { listen 80; } }"},
+		{"quoted braces", `http { server { return 200 "{;}"; } }`},
+		{"escaped quote", `http { server { return 200 "say \"hi\""; } }`},
+		{"nested location", "http { server { location /a { location /a/b { return 200; } } } }"},
+		{"exact and prefix location", "http { server { location = /a { return 200; } location /a { return 200; } } }"},
+	}
+	for _, tc := range valid {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := ValidateNginxConfig(tc.config); err != nil {
+				t.Fatalf("ValidateNginxConfig: %v", err)
+			}
+		})
+	}
+
+	invalid := []struct {
+		name   string
+		config string
+		want   string
+	}{
+		{"unclosed block", "http { server { listen 80; }", "unexpected end of file"},
+		{"extra brace", "events {} }", `line 1: unexpected "}"`},
+		{"unterminated quote", "http {\n server { return 200 \"ok; }\n}", "line 2: unterminated quoted string"},
+		{"unterminated directive", "http { server { listen 80 } }", `directive "listen" is not terminated`},
+		{"unterminated at end", "events {}\nworker_processes 1", `line 2: directive "worker_processes" is not terminated`},
+		{"stray semicolon", "http { ; }", `unexpected ";"`},
+		{"duplicate location", "http { server {\nlocation /a/ { return 200; }\nlocation /a/ { return 200; }\n} }", `line 3: duplicate location "/a/" (first defined on line 2)`},
+		{"location outside server", "http { location /a { return 200; } }", `"location" directive is not allowed here`},
+		{"location without block", "http { server { location /a; } }", `invalid number of arguments in "location"`},
+		{"proxy_pass without arguments", "http { server { location /a { proxy_pass; } } }", `invalid number of arguments in "proxy_pass"`},
+		{"server with arguments", "http { server main { listen 80; } }", `invalid "server" block`},
+		{"map with one argument", "http { map $a { default 1; } }", `invalid number of arguments in "map"`},
+		{"unknown block", "http { upstream_thing { } }", `unknown block directive "upstream_thing"`},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateNginxConfig(tc.config)
+			if err == nil {
+				t.Fatal("ValidateNginxConfig succeeded, want an error")
+			}
+			if !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("ValidateNginxConfig = %q, want it to contain %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestNewNginxConfigMapIsDeterministic(t *testing.T) {
+	paths := []string{
+		"/environment/cpsc323/hw1/bob",
+		"/environment/cpsc201/lab2/carol",
+		"/environment/cpsc323/hw1/alice",
+		"/environment/cpsc323/hw2/alice",
+	}
+
+	var rendered []string
+	for i := 0; i < 20; i++ {
+		// Insert in a different order each time, on top of the random
+		// iteration order of maps
+		routes := make(map[string]string, len(paths))
+		for j := range paths {
+			path := paths[(i+j)%len(paths)]
+			routes[path] = "http://" + path[strings.LastIndex(path, "/")+1:] + ".default.svc.cluster.local:80"
+		}
+		configMap, err := NewNginxConfigMap(routes)
+		if err != nil {
+			t.Fatalf("NewNginxConfigMap: %v", err)
+		}
+		rendered = append(rendered, configMap.Data["nginx.conf"])
+		if i > 0 && rendered[i] != rendered[0] {
+			t.Fatalf("render %d differs from the first:\n%s\n---\n%s", i, rendered[i], rendered[0])
+		}
+	}
+
+	configMap, _ := NewNginxConfigMap(map[string]string{paths[0]: "http://bob"})
+	other, _ := NewNginxConfigMap(map[string]string{paths[0]: "http://bob", paths[1]: "http://carol"})
+	if NginxConfigHash(configMap) == NginxConfigHash(other) {
+		t.Fatal("different routes produced the same config hash")
+	}
+}
+
+func TestNginxConfigPaths(t *testing.T) {
+	routes := map[string]string{
+		"/environment/cpsc323/hw1/bob":   "http://bob",
+		"/environment/cpsc323/hw1/alice": "http://alice",
+	}
+	configMap, err := NewNginxConfigMap(routes)
+	if err != nil {
+		t.Fatalf("NewNginxConfigMap: %v", err)
+	}
+
+	want := []string{"/environment/cpsc323/hw1/alice", "/environment/cpsc323/hw1/bob"}
+	if got := NginxConfigPaths(configMap); !reflect.DeepEqual(got, want) {
+		t.Fatalf("NginxConfigPaths = %v, want %v", got, want)
+	}
+	if got := NginxConfigPaths(DefaultNginxConfigMap()); len(got) != 0 {
+		t.Fatalf("NginxConfigPaths of the default config = %v, want none", got)
+	}
+}
@@ -0,0 +1,85 @@
+package deployments
+
+import (
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Records the resource profile an environment was provisioned with, so that
+// a change of profile can be detected without comparing quantities.
+const RESOURCE_PROFILE_ANNOTATION = "hive-resource-profile"
+
+// Named CPU and memory settings for environments. Environments without a
+// profile run with no requests or limits.
+var RESOURCE_PROFILES = map[string]apiv1.ResourceRequirements{
+	"small":  newResourceRequirements("250m", "512Mi", "1", "1Gi"),
+	"medium": newResourceRequirements("500m", "1Gi", "2", "2Gi"),
+	"large":  newResourceRequirements("1", "2Gi", "4", "4Gi"),
+}
+
+// EnvironmentOptions are the per-assignment settings of a student environment.
+type EnvironmentOptions struct {
+	Image           string `json:"image"`
+	ResourceProfile string `json:"resourceProfile,omitempty"`
+}
+
+func (o EnvironmentOptions) Validate() error {
+	if o.Image == "" {
+		return fmt.Errorf("an image is required")
+	}
+	if _, err := ResourceProfile(o.ResourceProfile); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ResourceProfile returns the requirements of a named profile. The empty
+// name is the unrestricted profile.
+func ResourceProfile(name string) (apiv1.ResourceRequirements, error) {
+	if name == "" {
+		return apiv1.ResourceRequirements{}, nil
+	}
+	requirements, ok := RESOURCE_PROFILES[name]
+	if !ok {
+		return apiv1.ResourceRequirements{}, fmt.Errorf("unknown resource profile %q, expected one of %v", name, ResourceProfileNames())
+	}
+	return requirements, nil
+}
+
+func ResourceProfileNames() []string {
+	names := make([]string, 0, len(RESOURCE_PROFILES))
+	for name := range RESOURCE_PROFILES {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EnvironmentOptionsFromDeployment recovers the options an environment
+// Deployment was created or last updated with.
+func EnvironmentOptionsFromDeployment(deployment *appsv1.Deployment) EnvironmentOptions {
+	options := EnvironmentOptions{ResourceProfile: deployment.Annotations[RESOURCE_PROFILE_ANNOTATION]}
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		if container.Name == ENVIRONMENT_CONTAINER {
+			options.Image = container.Image
+		}
+	}
+	return options
+}
+
+func newResourceRequirements(cpuRequest string, memoryRequest string, cpuLimit string, memoryLimit string) apiv1.ResourceRequirements {
+	return apiv1.ResourceRequirements{
+		Requests: apiv1.ResourceList{
+			apiv1.ResourceCPU:    resource.MustParse(cpuRequest),
+			apiv1.ResourceMemory: resource.MustParse(memoryRequest),
+		},
+		Limits: apiv1.ResourceList{
+			apiv1.ResourceCPU:    resource.MustParse(cpuLimit),
+			apiv1.ResourceMemory: resource.MustParse(memoryLimit),
+		},
+	}
+}
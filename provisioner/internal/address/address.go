@@ -0,0 +1,226 @@
+package address
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BradleyLewis08/HiVE/internal/naming"
+)
+
+const (
+	PATH_PREFIX = "/environment/"
+	// Capture group appended to Ingress paths; the rewrite-target annotation
+	// forwards $2 so environments see requests relative to their root.
+	PATH_CAPTURE = "(/|$)(.*)"
+
+	// Environments and the routers in front of them live in this namespace
+	NAMESPACE      = "default"
+	SERVICE_PORT   = 80
+	SERVICE_DOMAIN = NAMESPACE + ".svc.cluster.local"
+
+	// Sanitized identifiers never contain repeated dashes, so this separator
+	// keeps DNS labels reversible.
+	DNS_SEPARATOR = "--"
+
+	APP_LABEL        = "app"
+	APP_LABEL_VALUE  = "hive-course"
+	COURSE_LABEL     = "course"
+	ASSIGNMENT_LABEL = "assignment"
+	STUDENT_LABEL    = "student"
+	// Tells apart the kinds of object the provisioner labels with APP_LABEL
+	COMPONENT_LABEL = "hive-component"
+)
+
+// Address is the canonical identity of a student environment. Every name,
+// label, path and URL belonging to an environment is derived from it.
+type Address struct {
+	CourseName     string `json:"courseName"`
+	AssignmentName string `json:"assignmentName"`
+	NetID          string `json:"netID"`
+}
+
+// New sanitizes the identifiers as requested by a user into an Address.
+// An identifier with nothing to keep is left empty, making the address
+// incomplete; use Parse to reject it instead.
+func New(assignmentName string, courseName string, netID string) Address {
+	courseName, _ = naming.Sanitize(courseName)
+	assignmentName, _ = naming.Sanitize(assignmentName)
+	netID, _ = naming.Sanitize(netID)
+	return Address{CourseName: courseName, AssignmentName: assignmentName, NetID: netID}
+}
+
+// Parse is New for identifiers that have not been checked, failing when
+// any of them has nothing to keep.
+func Parse(assignmentName string, courseName string, netID string) (Address, error) {
+	for _, identifier := range []struct{ name, value string }{
+		{"course", courseName},
+		{"assignment", assignmentName},
+		{"netID", netID},
+	} {
+		if _, err := naming.Sanitize(identifier.value); err != nil {
+			return Address{}, fmt.Errorf("invalid %s: %w", identifier.name, err)
+		}
+	}
+	return New(assignmentName, courseName, netID), nil
+}
+
+func (a Address) String() string {
+	return fmt.Sprintf("%s/%s/%s", a.CourseName, a.AssignmentName, a.NetID)
+}
+
+// Path is the public path prefix the environment is served under:
+// /environment/<course>/<assignment>/<netID>
+func (a Address) Path() string {
+	return PATH_PREFIX + a.String()
+}
+
+// PathPattern is Path followed by the capture groups used by the Ingress
+// rewrite-target annotation.
+func (a Address) PathPattern() string {
+	return a.Path() + PATH_CAPTURE
+}
+
+// DNSLabel is a single DNS label identifying the environment, used for host
+// based routing. It is reversible with FromDNSLabel unless the identifiers
+// are too long to fit, in which case a hashed name is used instead.
+func (a Address) DNSLabel() string {
+	label := strings.Join([]string{a.NetID, a.AssignmentName, a.CourseName}, DNS_SEPARATOR)
+	if len(label) > naming.MAX_NAME_LENGTH {
+		return naming.ResourceName("env", a.NetID, a.AssignmentName, a.CourseName)
+	}
+	return label
+}
+
+// PathURL is the environment's public URL when served under Path on base.
+func (a Address) PathURL(base string) string {
+	return strings.TrimRight(base, "/") + a.Path() + "/"
+}
+
+// HostURL is the environment's public URL when served from the root of its
+// own host under domain.
+func (a Address) HostURL(scheme string, domain string) string {
+	return fmt.Sprintf("%s://%s.%s/", scheme, a.DNSLabel(), domain)
+}
+
+func (a Address) DeploymentName() string {
+	return naming.ResourceName("hive-environment", a.AssignmentName, a.CourseName, a.NetID)
+}
+
+func (a Address) ServiceName() string {
+	return naming.ResourceName("hive-lb", a.AssignmentName, a.CourseName, a.NetID)
+}
+
+// ServiceURL is the in-cluster URL of the environment's Service.
+func (a Address) ServiceURL() string {
+	return fmt.Sprintf("http://%s.%s:%d", a.ServiceName(), SERVICE_DOMAIN, SERVICE_PORT)
+}
+
+func (a Address) HTTPRouteName() string {
+	return naming.ResourceName("hive-route", a.AssignmentName, a.CourseName, a.NetID)
+}
+
+// CourseHTTPRouteName names the part'th HTTPRoute of a course, counting
+// from 0, when its environments are split across several.
+func CourseHTTPRouteName(courseName string, part int) string {
+	return naming.ResourceName("hive-route", courseName, strconv.Itoa(part))
+}
+
+// Labels identify every object belonging to the environment.
+func (a Address) Labels() map[string]string {
+	return map[string]string{
+		APP_LABEL:        APP_LABEL_VALUE,
+		COURSE_LABEL:     a.CourseName,
+		ASSIGNMENT_LABEL: a.AssignmentName,
+		STUDENT_LABEL:    a.NetID,
+	}
+}
+
+// Selector selects the objects carrying Labels.
+func (a Address) Selector() string {
+	return fmt.Sprintf("%s=%s,%s=%s,%s=%s,%s=%s",
+		APP_LABEL, APP_LABEL_VALUE,
+		COURSE_LABEL, a.CourseName,
+		ASSIGNMENT_LABEL, a.AssignmentName,
+		STUDENT_LABEL, a.NetID,
+	)
+}
+
+// CourseSelector selects the environment objects of a course. A course name
+// with nothing to keep selects no course.
+func CourseSelector(courseName string) string {
+	courseName, _ = naming.Sanitize(courseName)
+	return fmt.Sprintf("%s=%s,%s=%s", APP_LABEL, APP_LABEL_VALUE, COURSE_LABEL, courseName)
+}
+
+func (a Address) validate() error {
+	if a.CourseName == "" || a.AssignmentName == "" || a.NetID == "" {
+		return fmt.Errorf("incomplete environment address %q", a)
+	}
+	for _, identifier := range []string{a.CourseName, a.AssignmentName, a.NetID} {
+		if sanitized, err := naming.Sanitize(identifier); err != nil || sanitized != identifier {
+			return fmt.Errorf("environment address %q is not canonical", a)
+		}
+	}
+	return nil
+}
+
+// FromLabels recovers an Address from the labels set by Labels.
+func FromLabels(labels map[string]string) (Address, error) {
+	a := Address{
+		CourseName:     labels[COURSE_LABEL],
+		AssignmentName: labels[ASSIGNMENT_LABEL],
+		NetID:          labels[STUDENT_LABEL],
+	}
+	return a, a.validate()
+}
+
+// FromPath recovers an Address from a Path or PathPattern, ignoring anything
+// after the netID segment.
+func FromPath(path string) (Address, error) {
+	if !strings.HasPrefix(path, PATH_PREFIX) {
+		return Address{}, fmt.Errorf("%q is not an environment path", path)
+	}
+	path = strings.TrimSuffix(strings.TrimPrefix(path, PATH_PREFIX), PATH_CAPTURE)
+	segments := strings.SplitN(path, "/", 4)
+	if len(segments) < 3 {
+		return Address{}, fmt.Errorf("%q is not an environment path", path)
+	}
+	a := Address{CourseName: segments[0], AssignmentName: segments[1], NetID: segments[2]}
+	return a, a.validate()
+}
+
+// FromDNSLabel is the inverse of DNSLabel for labels that were not hashed.
+func FromDNSLabel(label string) (Address, error) {
+	segments := strings.Split(label, DNS_SEPARATOR)
+	if len(segments) != 3 {
+		return Address{}, fmt.Errorf("%q is not an environment DNS label", label)
+	}
+	a := Address{NetID: segments[0], AssignmentName: segments[1], CourseName: segments[2]}
+	return a, a.validate()
+}
+
+// FromURL recovers an Address from a public URL produced by PathURL, or by
+// HostURL when domain is given.
+func FromURL(rawURL string, domain string) (Address, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Address{}, err
+	}
+	if strings.HasPrefix(u.Path, PATH_PREFIX) {
+		return FromPath(u.Path)
+	}
+	if domain != "" && strings.HasSuffix(u.Hostname(), "."+domain) {
+		return FromDNSLabel(strings.TrimSuffix(u.Hostname(), "."+domain))
+	}
+	return Address{}, fmt.Errorf("%q is not an environment URL", rawURL)
+}
+
+// Sort orders addresses by course, assignment and netID so listings are stable.
+func Sort(addresses []Address) {
+	sort.Slice(addresses, func(i, j int) bool {
+		return addresses[i].String() < addresses[j].String()
+	})
+}
@@ -0,0 +1,118 @@
+package address
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+var addresses = []Address{
+	New("hw1", "cpsc323", "alice"),
+	New("Homework 1", "CPSC 323: Systems", "jane.doe"),
+	New("lab-2", "cpsc201", "bob"),
+	New(strings.Repeat("assignment ", 8), strings.Repeat("course ", 8), "carol"),
+}
+
+func TestNew(t *testing.T) {
+	got := New("Homework 1", "CPSC 323: Systems", "jane.doe")
+	want := Address{CourseName: "cpsc-323-systems", AssignmentName: "homework-1", NetID: "jane-doe"}
+	if got != want {
+		t.Fatalf("New = %#v, want %#v", got, want)
+	}
+	if path := got.Path(); path != "/environment/cpsc-323-systems/homework-1/jane-doe" {
+		t.Fatalf("Path = %q", path)
+	}
+	if parsed, err := Parse("Homework 1", "CPSC 323: Systems", "jane.doe"); err != nil || parsed != want {
+		t.Fatalf("Parse = %#v, %v, want %#v", parsed, err, want)
+	}
+}
+
+func TestRoundTrips(t *testing.T) {
+	for _, a := range addresses {
+		t.Run(a.String(), func(t *testing.T) {
+			for name, path := range map[string]string{
+				"Path":             a.Path(),
+				"PathPattern":      a.PathPattern(),
+				"Path with suffix": a.Path() + "/static/main.js",
+			} {
+				got, err := FromPath(path)
+				if err != nil || got != a {
+					t.Errorf("FromPath(%s) = %v, %v, want %v", name, got, err, a)
+				}
+			}
+
+			if got, err := FromLabels(a.Labels()); err != nil || got != a {
+				t.Errorf("FromLabels(Labels()) = %v, %v, want %v", got, err, a)
+			}
+
+			selector, err := labels.Parse(a.Selector())
+			if err != nil {
+				t.Fatalf("Selector %q does not parse: %v", a.Selector(), err)
+			}
+			if !selector.Matches(labels.Set(a.Labels())) {
+				t.Errorf("Selector %q does not match Labels", a.Selector())
+			}
+
+			if got, err := FromURL(a.PathURL("https://hive.example.edu/"), ""); err != nil || got != a {
+				t.Errorf("FromURL(PathURL) = %v, %v, want %v", got, err, a)
+			}
+			if label := a.DNSLabel(); !strings.HasPrefix(label, "env-") {
+				got, err := FromURL(a.HostURL("https", "hive.example.edu"), "hive.example.edu")
+				if err != nil || got != a {
+					t.Errorf("FromURL(HostURL) = %v, %v, want %v", got, err, a)
+				}
+			}
+			if len(a.DNSLabel()) > 63 {
+				t.Errorf("DNSLabel %q is longer than a DNS label", a.DNSLabel())
+			}
+		})
+	}
+}
+
+func TestRejectsNonEnvironments(t *testing.T) {
+	for _, path := range []string{
+		"/ping",
+		"/environment/",
+		"/environment/cpsc323/hw1",
+		"/environment/CPSC323/hw1/alice",
+		"/environment/cpsc323//alice",
+	} {
+		if a, err := FromPath(path); err == nil {
+			t.Errorf("FromPath(%q) = %v, want an error", path, a)
+		}
+	}
+
+	incomplete := New("hw1", "cpsc323", "alice").Labels()
+	delete(incomplete, STUDENT_LABEL)
+	if a, err := FromLabels(incomplete); err == nil {
+		t.Errorf("FromLabels without a student = %v, want an error", a)
+	}
+	if a, err := FromDNSLabel("alice--hw1"); err == nil {
+		t.Errorf("FromDNSLabel with two segments = %v, want an error", a)
+	}
+	if a, err := FromURL("https://example.edu/elsewhere", "example.edu"); err == nil {
+		t.Errorf("FromURL outside the environment paths = %v, want an error", a)
+	}
+	if a, err := Parse("hw1", "cpsc323", "!!!"); err == nil {
+		t.Errorf("Parse of a netID with nothing to sanitize = %v, want an error", a)
+	}
+}
+
+func TestSort(t *testing.T) {
+	got := []Address{
+		New("hw1", "cpsc323", "bob"),
+		New("lab2", "cpsc201", "carol"),
+		New("hw1", "cpsc323", "alice"),
+	}
+	Sort(got)
+	want := []Address{
+		New("lab2", "cpsc201", "carol"),
+		New("hw1", "cpsc323", "alice"),
+		New("hw1", "cpsc323", "bob"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Sort = %v, want %v", got, want)
+	}
+}
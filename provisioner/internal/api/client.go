@@ -0,0 +1,323 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/course"
+	"github.com/BradleyLewis08/HiVE/internal/routing"
+	"github.com/BradleyLewis08/HiVE/internal/templates"
+)
+
+// Client talks to the provisioner HTTP API.
+type Client struct {
+	BaseURL    string
+	Token      string
+	HTTPClient *http.Client
+}
+
+// StatusError is returned for any non-2xx response.
+type StatusError struct {
+	StatusCode int
+	Message    string
+	// Set when the server answered with a problem document
+	Problem *Problem
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func NewClient(baseURL string, token string) *Client {
+	return &Client{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Token:      token,
+		HTTPClient: &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func environmentPath(environment address.Address) string {
+	return fmt.Sprintf("/environments/%s/%s/%s",
+		url.PathEscape(environment.CourseName),
+		url.PathEscape(environment.AssignmentName),
+		url.PathEscape(environment.NetID),
+	)
+}
+
+// CreateEnvironments provisions environments. With wait, the server holds
+// the response until they are ready; if any failed or is still pending, the
+// environments are returned with their status alongside a *StatusError.
+func (c *Client) CreateEnvironments(request EnvironmentProvisionRequest, wait bool) (*EnvironmentList, error) {
+	path := "/environments"
+	if wait {
+		path += "?wait=true"
+	}
+
+	var response EnvironmentList
+	err := c.do(http.MethodPost, path, request, &response)
+	var statusErr *StatusError
+	if wait && errors.As(err, &statusErr) {
+		if json.Unmarshal([]byte(statusErr.Message), &response) == nil && len(response.Environments) > 0 {
+			statusErr.Message = "not every environment became ready"
+		}
+	}
+	return &response, err
+}
+
+// RenderEnvironments returns the objects request would create, as validated
+// by a server-side dry run. request.DryRun is set regardless of its value.
+func (c *Client) RenderEnvironments(request EnvironmentProvisionRequest) (*RenderResponse, error) {
+	request.DryRun = true
+	var response RenderResponse
+	return &response, c.do(http.MethodPost, "/environments", request, &response)
+}
+
+// ListEnvironments lists environments, filtered by any non-empty field of filter.
+func (c *Client) ListEnvironments(filter address.Address) (*EnvironmentList, error) {
+	query := url.Values{}
+	if filter.CourseName != "" {
+		query.Set("course", filter.CourseName)
+	}
+	if filter.AssignmentName != "" {
+		query.Set("assignment", filter.AssignmentName)
+	}
+	if filter.NetID != "" {
+		query.Set("netID", filter.NetID)
+	}
+	path := "/environments"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var response EnvironmentList
+	return &response, c.do(http.MethodGet, path, nil, &response)
+}
+
+func (c *Client) GetEnvironment(environment address.Address) (*Environment, error) {
+	var response Environment
+	return &response, c.do(http.MethodGet, environmentPath(environment), nil, &response)
+}
+
+func (c *Client) DeleteEnvironment(environment address.Address) error {
+	return c.do(http.MethodDelete, environmentPath(environment), nil, nil)
+}
+
+func (c *Client) ResetEnvironment(environment address.Address) error {
+	return c.do(http.MethodPost, environmentPath(environment)+"/reset", nil, nil)
+}
+
+func (c *Client) HibernateEnvironment(environment address.Address) error {
+	return c.do(http.MethodPost, environmentPath(environment)+"/hibernate", nil, nil)
+}
+
+func (c *Client) ResumeEnvironment(environment address.Address) error {
+	return c.do(http.MethodPost, environmentPath(environment)+"/resume", nil, nil)
+}
+
+// StreamLogs copies the environment's logs to out until the server closes
+// the stream. tail < 0 returns all lines.
+func (c *Client) StreamLogs(environment address.Address, follow bool, tail int, out io.Writer) error {
+	query := url.Values{}
+	if follow {
+		query.Set("follow", "true")
+	}
+	if tail >= 0 {
+		query.Set("tail", fmt.Sprint(tail))
+	}
+
+	request, err := c.newRequest(http.MethodGet, environmentPath(environment)+"/logs?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	// Followed logs may stay open indefinitely
+	httpClient := *c.HTTPClient
+	httpClient.Timeout = 0
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if err := checkResponse(response); err != nil {
+		return err
+	}
+	_, err = io.Copy(out, response.Body)
+	return err
+}
+
+func (c *Client) Exec(environment address.Address, command []string) (*ExecResponse, error) {
+	var response ExecResponse
+	return &response, c.do(http.MethodPost, environmentPath(environment)+"/exec", ExecRequest{Command: command}, &response)
+}
+
+func (c *Client) GetCourseQuota(courseName string) (*CourseQuota, error) {
+	var response CourseQuota
+	return &response, c.do(http.MethodGet, "/courses/"+url.PathEscape(courseName)+"/quota", nil, &response)
+}
+
+func (c *Client) SetCourseQuota(courseName string, maxEnvironments int) (*CourseQuota, error) {
+	var response CourseQuota
+	request := CourseQuota{CourseName: courseName, MaxEnvironments: maxEnvironments}
+	return &response, c.do(http.MethodPut, "/courses/"+url.PathEscape(courseName)+"/quota", request, &response)
+}
+
+func (c *Client) ListRoutes() (*EnvironmentList, error) {
+	var response EnvironmentList
+	return &response, c.do(http.MethodGet, "/routes", nil, &response)
+}
+
+func (c *Client) SyncRoutes() (*RouteSyncResponse, error) {
+	var response RouteSyncResponse
+	return &response, c.do(http.MethodPost, "/routes/sync", nil, &response)
+}
+
+func (c *Client) RouterStatus() (*routing.Status, error) {
+	var response routing.Status
+	return &response, c.do(http.MethodGet, "/router/status", nil, &response)
+}
+
+func (c *Client) ListTemplates() ([]templates.Template, error) {
+	var response []templates.Template
+	return response, c.do(http.MethodGet, "/templates", nil, &response)
+}
+
+func (c *Client) ApplyTemplate(template templates.Template) (*templates.Template, error) {
+	var response templates.Template
+	return &response, c.do(http.MethodPut, "/templates/"+url.PathEscape(template.Name), template, &response)
+}
+
+// ImportRoster uploads a roster export for a course. Unless options.Apply
+// is set, the server only returns the plan.
+func (c *Client) ImportRoster(courseName string, options RosterImportOptions, file io.Reader) (*RosterImportResponse, error) {
+	query := url.Values{}
+	query.Set("assignment", options.AssignmentName)
+	if options.Format != "" {
+		query.Set("format", options.Format)
+	}
+	if options.Mapping.NetID != "" {
+		query.Set("netIDColumn", options.Mapping.NetID)
+	}
+	if options.Mapping.Name != "" {
+		query.Set("nameColumn", options.Mapping.Name)
+	}
+	if options.Image != "" {
+		query.Set("image", options.Image)
+	}
+	if options.Template != "" {
+		query.Set("template", options.Template)
+	}
+	if options.ResourceProfile != "" {
+		query.Set("resourceProfile", options.ResourceProfile)
+	}
+	if options.Apply {
+		query.Set("apply", "true")
+	}
+
+	request, err := c.newRequest(http.MethodPost, "/courses/"+url.PathEscape(courseName)+"/roster?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Body = io.NopCloser(file)
+	request.Header.Set("Content-Type", "text/csv")
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if err := checkResponse(response); err != nil {
+		return nil, err
+	}
+	var plan RosterImportResponse
+	return &plan, json.NewDecoder(response.Body).Decode(&plan)
+}
+
+// ApplyManifest plans a course manifest, and carries the plan out when
+// apply is set. Environments missing from the manifest are only deleted
+// when prune is set.
+func (c *Client) ApplyManifest(manifest *course.Manifest, apply bool, prune bool) (*ManifestApplyResponse, error) {
+	query := url.Values{}
+	if apply {
+		query.Set("apply", "true")
+	}
+	if prune {
+		query.Set("prune", "true")
+	}
+	path := "/manifests"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	var response ManifestApplyResponse
+	return &response, c.do(http.MethodPost, path, manifest, &response)
+}
+
+func (c *Client) newRequest(method string, path string, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	request, err := http.NewRequest(method, c.BaseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	return request, nil
+}
+
+// do sends a JSON request and decodes a JSON response into out, if given.
+func (c *Client) do(method string, path string, body interface{}, out interface{}) error {
+	request, err := c.newRequest(method, path, body)
+	if err != nil {
+		return err
+	}
+
+	response, err := c.HTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if err := checkResponse(response); err != nil {
+		return err
+	}
+	if out == nil || response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(out)
+}
+
+func checkResponse(response *http.Response) error {
+	if response.StatusCode >= 200 && response.StatusCode < 300 {
+		return nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(response.Body, 64*1024))
+	statusErr := &StatusError{StatusCode: response.StatusCode, Message: strings.TrimSpace(string(message))}
+
+	var problem Problem
+	if strings.HasPrefix(response.Header.Get("Content-Type"), PROBLEM_CONTENT_TYPE) && json.Unmarshal(message, &problem) == nil {
+		statusErr.Problem = &problem
+		statusErr.Message = problem.Detail
+	}
+	return statusErr
+}
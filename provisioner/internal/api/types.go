@@ -0,0 +1,154 @@
+package api
+
+import (
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/audit"
+	"github.com/BradleyLewis08/HiVE/internal/course"
+	"github.com/BradleyLewis08/HiVE/internal/drift"
+	"github.com/BradleyLewis08/HiVE/internal/gc"
+	"github.com/BradleyLewis08/HiVE/internal/provisioner"
+	"github.com/BradleyLewis08/HiVE/internal/roster"
+	"github.com/BradleyLewis08/HiVE/internal/storage"
+	"github.com/BradleyLewis08/HiVE/internal/webhooks"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Request and response bodies of the provisioner HTTP API, shared by the
+// server and hivectl.
+
+const (
+	PROBLEM_CONTENT_TYPE = "application/problem+json"
+	// Followed by the kind of error, such as not-found or quota-exceeded
+	PROBLEM_TYPE_PREFIX = "urn:hive:problem:"
+)
+
+// Problem is the RFC 7807 problem document every error response carries.
+type Problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+type EnvironmentProvisionRequest struct {
+	CourseName     string   `json:"courseName"`
+	AssignmentName string   `json:"assignmentName"`
+	NetIDs         []string `json:"netIDs"`
+	Image          string   `json:"image,omitempty"`
+	// Template supplies the image and resource profile when none are given
+	Template        string `json:"template,omitempty"`
+	ResourceProfile string `json:"resourceProfile,omitempty"`
+	// DryRun renders the objects the request would create, validated by a
+	// server-side dry run, instead of creating them
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+type EnvironmentDeleteRequest struct {
+	AssignmentName string `json:"assignmentName"`
+	CourseName     string `json:"courseName"`
+	NetID          string `json:"netIDs"`
+}
+
+type Environment struct {
+	address.Address
+	URL    string `json:"url"`
+	Status string `json:"status,omitempty"`
+	// Set when Status is failed
+	Failure *provisioner.Failure `json:"failure,omitempty"`
+}
+
+type EnvironmentList struct {
+	Environments []Environment `json:"environments"`
+}
+
+type AuditList struct {
+	Entries []audit.Entry `json:"entries"`
+}
+
+type JobList struct {
+	Jobs []storage.Job `json:"jobs"`
+}
+
+// DriftReport is the outcome of the last drift check.
+type DriftReport struct {
+	// Unset until the first check completes
+	CheckedAt *time.Time `json:"checkedAt,omitempty"`
+	// Drift left after the check
+	Drift []drift.Drift `json:"drift"`
+	// Drift the check repaired
+	Repaired []drift.Drift `json:"repaired"`
+	// Why the last check could not complete, if it could not
+	Error string `json:"error,omitempty"`
+}
+
+// GCReport lists the orphaned objects a garbage collection sweep found.
+type GCReport struct {
+	SweptAt time.Time `json:"sweptAt"`
+	// Set when nothing was deleted, only reported
+	DryRun bool `json:"dryRun"`
+	// Orphans left after the sweep, and when they will be deleted
+	Orphans []gc.Orphan `json:"orphans"`
+	Deleted []gc.Orphan `json:"deleted"`
+}
+
+type WebhookDeliveryList struct {
+	Deliveries []webhooks.Delivery `json:"deliveries"`
+}
+
+type RouteSyncResponse struct {
+	Added   []address.Address `json:"added"`
+	Removed []address.Address `json:"removed"`
+}
+
+type ExecRequest struct {
+	Command []string `json:"command"`
+}
+
+type ExecResponse struct {
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	ExitCode int    `json:"exitCode"`
+}
+
+type CourseQuota struct {
+	CourseName string `json:"courseName"`
+	// Maximum number of environments in the course; 0 means unlimited
+	MaxEnvironments int `json:"maxEnvironments"`
+	Environments    int `json:"environments"`
+}
+
+// RosterImportResponse is the plan produced by a roster import and, once
+// applied, the environments it created.
+type RosterImportResponse struct {
+	roster.Plan
+	Applied      bool          `json:"applied"`
+	Environments []Environment `json:"environments,omitempty"`
+}
+
+// RosterImportOptions are sent as query parameters alongside the roster file.
+type RosterImportOptions struct {
+	AssignmentName  string
+	Format          string
+	Mapping         roster.Mapping
+	Image           string
+	Template        string
+	ResourceProfile string
+	// Apply carries out the plan instead of only returning it
+	Apply bool
+}
+
+// ManifestApplyResponse is the plan for a course manifest, and whether it
+// was applied.
+type ManifestApplyResponse struct {
+	course.Plan
+	Applied bool `json:"applied"`
+}
+
+// RenderResponse holds the objects a dry-run request would write, and any
+// errors the API server raised validating them.
+type RenderResponse struct {
+	Objects []*unstructured.Unstructured `json:"objects"`
+	Errors  []string                     `json:"errors,omitempty"`
+}
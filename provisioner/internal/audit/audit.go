@@ -0,0 +1,221 @@
+// Package audit keeps an append-only record of the changes made to
+// environments: who made them, when, with what parameters and whether they
+// succeeded.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+)
+
+// Actions recorded against an environment
+const (
+	ACTION_CREATE    = "create"
+	ACTION_UPDATE    = "update"
+	ACTION_DELETE    = "delete"
+	ACTION_RESET     = "reset"
+	ACTION_HIBERNATE = "hibernate"
+	ACTION_RESUME    = "resume"
+	ACTION_EXEC      = "exec"
+	// A change made by the reconciler to undo drift
+	ACTION_REPAIR = "repair"
+	// A download of the audit log, recorded against the environments it
+	// was filtered to
+	ACTION_EXPORT = "export"
+)
+
+const (
+	OUTCOME_SUCCESS = "success"
+	OUTCOME_FAILURE = "failure"
+)
+
+type Entry struct {
+	// Assigned by the log's backing, increasing in order of appending
+	ID          int64             `json:"id"`
+	Time        time.Time         `json:"time"`
+	Actor       string            `json:"actor"`
+	// User the caller says it acted for, as named by the caller. It is not
+	// verified; only Actor is derived from the caller's credential.
+	OnBehalfOf  string            `json:"onBehalfOf,omitempty"`
+	Action      string            `json:"action"`
+	Environment address.Address   `json:"environment"`
+	Parameters  map[string]string `json:"parameters,omitempty"`
+	Outcome     string            `json:"outcome"`
+	Error       string            `json:"error,omitempty"`
+	RequestID   string            `json:"requestID,omitempty"`
+	JobID       string            `json:"jobID,omitempty"`
+}
+
+// Filter selects entries. Zero fields match everything; the environment
+// fields match individually, so a course alone selects all of its entries.
+type Filter struct {
+	Environment address.Address
+	Actor       string
+	OnBehalfOf  string
+	Action      string
+	Outcome     string
+	JobID       string
+	Since       time.Time
+	Until       time.Time
+	// Only the most recent Limit entries are returned, if set
+	Limit int
+}
+
+func (f Filter) Matches(entry Entry) bool {
+	return (f.Environment.CourseName == "" || f.Environment.CourseName == entry.Environment.CourseName) &&
+		(f.Environment.AssignmentName == "" || f.Environment.AssignmentName == entry.Environment.AssignmentName) &&
+		(f.Environment.NetID == "" || f.Environment.NetID == entry.Environment.NetID) &&
+		(f.Actor == "" || f.Actor == entry.Actor) &&
+		(f.OnBehalfOf == "" || f.OnBehalfOf == entry.OnBehalfOf) &&
+		(f.Action == "" || f.Action == entry.Action) &&
+		(f.Outcome == "" || f.Outcome == entry.Outcome) &&
+		(f.JobID == "" || f.JobID == entry.JobID) &&
+		(f.Since.IsZero() || !entry.Time.Before(f.Since)) &&
+		(f.Until.IsZero() || entry.Time.Before(f.Until))
+}
+
+// Select returns the entries, given oldest first, that match the filter,
+// keeping only the most recent Limit of them.
+func (f Filter) Select(entries []Entry) []Entry {
+	matching := []Entry{}
+	for _, entry := range entries {
+		if f.Matches(entry) {
+			matching = append(matching, entry)
+		}
+	}
+	if f.Limit > 0 && len(matching) > f.Limit {
+		matching = matching[len(matching)-f.Limit:]
+	}
+	return matching
+}
+
+// Log records audit entries in a backing, which assigns their IDs and
+// answers queries, so that replicas sharing the backing share one log.
+type Log struct {
+	backing Backing
+}
+
+// Backing persists audit entries for a Log, such as the provisioner's
+// storage.
+type Backing interface {
+	// AppendAudit records the entry and returns the ID it assigned, greater
+	// than that of every entry recorded before it.
+	AppendAudit(ctx context.Context, entry Entry) (int64, error)
+	// QueryAudit returns the entries matching the filter, oldest first.
+	QueryAudit(ctx context.Context, filter Filter) ([]Entry, error)
+}
+
+// NewLog returns a log kept only in memory.
+func NewLog() *Log {
+	return &Log{backing: &memory{}}
+}
+
+// Open returns a log that records its entries in backing.
+func Open(backing Backing) *Log {
+	return &Log{backing: backing}
+}
+
+// Append records the entry, with its time set to now if unset, and returns
+// it with the ID it was assigned.
+func (l *Log) Append(ctx context.Context, entry Entry) (Entry, error) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	id, err := l.backing.AppendAudit(ctx, entry)
+	if err != nil {
+		return Entry{}, fmt.Errorf("failed to record audit entry: %w", err)
+	}
+	entry.ID = id
+	return entry, nil
+}
+
+// Query returns the entries matching the filter, oldest first.
+func (l *Log) Query(ctx context.Context, filter Filter) ([]Entry, error) {
+	entries, err := l.backing.QueryAudit(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %w", err)
+	}
+	return entries, nil
+}
+
+// Import appends the entries of a JSON lines audit log, as kept in a file
+// before the log moved to storage, keeping their times but not their IDs.
+// A last line cut short by a crash is skipped. It returns how many entries
+// were imported.
+func (l *Log) Import(ctx context.Context, r io.Reader) (int, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	lines := bytes.Split(data, []byte("\n"))
+	imported := 0
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return imported, fmt.Errorf("invalid audit log line %d: %w", i+1, err)
+		}
+		if _, err := l.Append(ctx, entry); err != nil {
+			return imported, err
+		}
+		imported++
+	}
+	return imported, nil
+}
+
+// memory is the backing of a log kept only in memory.
+type memory struct {
+	mu      sync.RWMutex
+	entries []Entry
+}
+
+func (m *memory) AppendAudit(ctx context.Context, entry Entry) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry.ID = int64(len(m.entries)) + 1
+	m.entries = append(m.entries, entry)
+	return entry.ID, nil
+}
+
+func (m *memory) QueryAudit(ctx context.Context, filter Filter) ([]Entry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return filter.Select(m.entries), nil
+}
+
+type contextKey struct{}
+
+type onBehalfOfKey struct{}
+
+// WithActor records who a request is made by, for the entries it causes.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, contextKey{}, actor)
+}
+
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(contextKey{}).(string)
+	return actor
+}
+
+// WithOnBehalfOf records the user a request says it is made for, for the
+// entries it causes.
+func WithOnBehalfOf(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, onBehalfOfKey{}, user)
+}
+
+func OnBehalfOf(ctx context.Context) string {
+	user, _ := ctx.Value(onBehalfOfKey{}).(string)
+	return user
+}
@@ -0,0 +1,38 @@
+package audit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	log := NewLog()
+	if _, err := log.Append(ctx, Entry{Actor: "api", Action: ACTION_CREATE}); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	// Written by the file-based log, ending in a line cut short by a crash
+	file := `{"id":1,"time":"2024-09-01T12:00:00Z","actor":"api","action":"create","outcome":"success"}
+{"id":2,"time":"2024-09-01T12:01:00Z","actor":"api","action":"delete","outcome":"failure"}
+{"id":3,"ti`
+	imported, err := log.Import(ctx, strings.NewReader(file))
+	if err != nil || imported != 2 {
+		t.Fatalf("Import = %d, %v, want 2 entries", imported, err)
+	}
+
+	entries, _ := log.Query(ctx, Filter{})
+	if len(entries) != 3 {
+		t.Fatalf("entries after import = %+v, want 3", entries)
+	}
+	// Imported entries keep their times but are numbered after the log's own
+	if entries[1].ID != 2 || entries[2].ID != 3 || !entries[2].Time.Equal(time.Date(2024, 9, 1, 12, 1, 0, 0, time.UTC)) || entries[2].Action != ACTION_DELETE {
+		t.Fatalf("imported entries = %+v", entries[1:])
+	}
+
+	if _, err := log.Import(ctx, strings.NewReader("{\n"+file)); err == nil {
+		t.Fatal("Import of a log with a malformed line before the last succeeded")
+	}
+}
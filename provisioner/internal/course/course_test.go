@@ -0,0 +1,155 @@
+package course
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"sigs.k8s.io/yaml"
+)
+
+const EXAMPLE_MANIFEST = `
+course: CPSC 323
+resourceProfile: small
+assignments:
+  - name: pset1
+    template: cpsc323
+    schedule:
+      start: 2024-09-01T00:00:00-04:00
+      end: 2024-09-20T23:59:59-04:00
+  - name: pset2
+    image: ghcr.io/example/cpsc323:pset2
+    resourceProfile: medium
+roster:
+  - abc12
+  - def34
+`
+
+func TestValidate(t *testing.T) {
+	var manifest Manifest
+	if err := yaml.UnmarshalStrict([]byte(EXAMPLE_MANIFEST), &manifest); err != nil {
+		t.Fatalf("example manifest does not parse: %v", err)
+	}
+	if err := manifest.Validate(); err != nil {
+		t.Fatalf("example manifest is invalid: %v", err)
+	}
+
+	start := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	before := start.Add(-time.Hour)
+	invalid := []struct {
+		name     string
+		manifest Manifest
+		want     string
+	}{
+		{"no course", Manifest{}, "course is required"},
+		{"unknown course profile", Manifest{Course: "cpsc323", ResourceProfile: "huge"}, `unknown resource profile "huge"`},
+		{"unnamed assignment", Manifest{Course: "cpsc323", Assignments: []Assignment{{Image: "code-server"}}}, "every assignment needs a name"},
+		{"duplicate assignment", Manifest{Course: "cpsc323", Assignments: []Assignment{
+			{Name: "PSet 1", Image: "code-server"},
+			{Name: "pset-1", Image: "code-server"},
+		}}, "listed more than once"},
+		{"no image", Manifest{Course: "cpsc323", Assignments: []Assignment{{Name: "pset1"}}}, "needs an image or template"},
+		{"unknown assignment profile", Manifest{Course: "cpsc323", Assignments: []Assignment{
+			{Name: "pset1", Image: "code-server", ResourceProfile: "huge"},
+		}}, "assignment pset1: unknown resource profile"},
+		{"ends before it starts", Manifest{Course: "cpsc323", Assignments: []Assignment{
+			{Name: "pset1", Image: "code-server", Schedule: &Schedule{Start: &start, End: &before}},
+		}}, "ends before it starts"},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.manifest.Validate()
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("Validate = %v, want an error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestOpen(t *testing.T) {
+	start := time.Date(2024, 9, 1, 0, 0, 0, 0, time.UTC)
+	end := start.Add(14 * 24 * time.Hour)
+	tests := []struct {
+		name     string
+		schedule *Schedule
+		now      time.Time
+		want     bool
+	}{
+		{"unscheduled", nil, start, true},
+		{"before start", &Schedule{Start: &start, End: &end}, start.Add(-time.Second), false},
+		{"at start", &Schedule{Start: &start, End: &end}, start, true},
+		{"before end", &Schedule{Start: &start, End: &end}, end.Add(-time.Second), true},
+		{"at end", &Schedule{Start: &start, End: &end}, end, false},
+		{"open start", &Schedule{End: &end}, start.Add(-24 * time.Hour), true},
+		{"open end", &Schedule{Start: &start}, end.Add(365 * 24 * time.Hour), true},
+	}
+	for _, tc := range tests {
+		if got := (Assignment{Name: "pset1", Schedule: tc.schedule}).Open(tc.now); got != tc.want {
+			t.Errorf("%s: Open = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	small := deployments.EnvironmentOptions{Image: "cpsc323:pset1", ResourceProfile: "small"}
+	medium := deployments.EnvironmentOptions{Image: "cpsc323:pset1", ResourceProfile: "medium"}
+	alice := address.New("pset1", "cpsc323", "alice")
+	bob := address.New("pset1", "cpsc323", "bob")
+	carol := address.New("pset1", "cpsc323", "carol")
+	dave := address.New("pset1", "cpsc323", "dave")
+
+	desired := Desired{alice: small, bob: medium, carol: small}
+	live := Desired{alice: small, bob: small, dave: small}
+
+	tests := []struct {
+		name  string
+		prune bool
+		want  Plan
+	}{
+		{
+			name: "retain",
+			want: Plan{
+				CourseName: "cpsc323",
+				Changes: []Change{
+					{Action: ACTION_UPDATE, Address: bob, Options: medium, Previous: &small},
+					{Action: ACTION_CREATE, Address: carol, Options: small},
+				},
+				Retained:  []address.Address{dave},
+				Unchanged: 1,
+			},
+		},
+		{
+			name:  "prune",
+			prune: true,
+			want: Plan{
+				CourseName: "cpsc323",
+				Changes: []Change{
+					{Action: ACTION_UPDATE, Address: bob, Options: medium, Previous: &small},
+					{Action: ACTION_CREATE, Address: carol, Options: small},
+					{Action: ACTION_DELETE, Address: dave, Options: small},
+				},
+				Retained:  []address.Address{},
+				Unchanged: 1,
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			plan := Diff("cpsc323", desired, live, tc.prune)
+			if !reflect.DeepEqual(plan, tc.want) {
+				t.Fatalf("Diff = %+v, want %+v", plan, tc.want)
+			}
+			if plan.Count(ACTION_CREATE) != 1 || plan.Count(ACTION_UPDATE) != 1 {
+				t.Fatalf("Count = %d creates and %d updates, want one of each", plan.Count(ACTION_CREATE), plan.Count(ACTION_UPDATE))
+			}
+		})
+	}
+
+	converged := Diff("cpsc323", desired, desired, true)
+	if len(converged.Changes) != 0 || converged.Unchanged != len(desired) {
+		t.Fatalf("Diff of a converged course = %+v, want no changes", converged)
+	}
+}
@@ -0,0 +1,115 @@
+// Package course describes a course declaratively, as kept in a course.yaml
+// alongside the course materials, and plans the changes that bring the
+// cluster in line with it.
+package course
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/naming"
+)
+
+// Manifest is the desired state of a course:
+//
+//	course: CPSC 323
+//	resourceProfile: small
+//	assignments:
+//	  - name: pset1
+//	    template: cpsc323
+//	    schedule:
+//	      start: 2024-09-01T00:00:00-04:00
+//	      end: 2024-09-20T23:59:59-04:00
+//	  - name: pset2
+//	    image: ghcr.io/example/cpsc323:pset2
+//	    resourceProfile: medium
+//	roster:
+//	  - abc12
+//	  - def34
+type Manifest struct {
+	Course string `json:"course"`
+	// Default resource profile of the course's assignments
+	ResourceProfile string       `json:"resourceProfile,omitempty"`
+	Assignments     []Assignment `json:"assignments"`
+	// NetIDs of the students enrolled in the course
+	Roster []string `json:"roster,omitempty"`
+	// RosterFile is read by hivectl and merged into Roster before the
+	// manifest is sent to the provisioner.
+	RosterFile *RosterFile `json:"rosterFile,omitempty"`
+}
+
+type Assignment struct {
+	Name string `json:"name"`
+	// Template supplies the image and resource profile when none are given
+	Template        string    `json:"template,omitempty"`
+	Image           string    `json:"image,omitempty"`
+	ResourceProfile string    `json:"resourceProfile,omitempty"`
+	Schedule        *Schedule `json:"schedule,omitempty"`
+}
+
+// Schedule bounds when an assignment's environments exist. Either end may
+// be left open.
+type Schedule struct {
+	Start *time.Time `json:"start,omitempty"`
+	End   *time.Time `json:"end,omitempty"`
+}
+
+// RosterFile points at a roster export, relative to the manifest.
+type RosterFile struct {
+	Path        string `json:"path"`
+	Format      string `json:"format,omitempty"`
+	NetIDColumn string `json:"netIDColumn,omitempty"`
+}
+
+func (m *Manifest) Validate() error {
+	if m.Course == "" {
+		return fmt.Errorf("course is required")
+	}
+	if _, err := naming.Sanitize(m.Course); err != nil {
+		return fmt.Errorf("invalid course: %w", err)
+	}
+	if _, err := deployments.ResourceProfile(m.ResourceProfile); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool, len(m.Assignments))
+	for _, assignment := range m.Assignments {
+		if assignment.Name == "" {
+			return fmt.Errorf("every assignment needs a name")
+		}
+		name, err := naming.Sanitize(assignment.Name)
+		if err != nil {
+			return fmt.Errorf("invalid assignment name: %w", err)
+		}
+		if seen[name] {
+			return fmt.Errorf("assignment %s is listed more than once", assignment.Name)
+		}
+		seen[name] = true
+
+		if assignment.Image == "" && assignment.Template == "" {
+			return fmt.Errorf("assignment %s needs an image or template", assignment.Name)
+		}
+		if _, err := deployments.ResourceProfile(assignment.ResourceProfile); err != nil {
+			return fmt.Errorf("assignment %s: %w", assignment.Name, err)
+		}
+		if schedule := assignment.Schedule; schedule != nil && schedule.Start != nil && schedule.End != nil && !schedule.End.After(*schedule.Start) {
+			return fmt.Errorf("assignment %s ends before it starts", assignment.Name)
+		}
+	}
+	return nil
+}
+
+// Open reports whether the assignment's environments should exist at now.
+func (a Assignment) Open(now time.Time) bool {
+	if a.Schedule == nil {
+		return true
+	}
+	if a.Schedule.Start != nil && now.Before(*a.Schedule.Start) {
+		return false
+	}
+	if a.Schedule.End != nil && !now.Before(*a.Schedule.End) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package course
+
+import (
+	"sort"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+)
+
+const (
+	ACTION_CREATE = "create"
+	ACTION_UPDATE = "update"
+	ACTION_DELETE = "delete"
+)
+
+// Change is a single step of a plan. For updates, Previous holds the
+// options the environment currently runs with.
+type Change struct {
+	Action string `json:"action"`
+	address.Address
+	Options  deployments.EnvironmentOptions  `json:"options"`
+	Previous *deployments.EnvironmentOptions `json:"previous,omitempty"`
+}
+
+// Plan lists the changes that converge a course on its manifest.
+type Plan struct {
+	CourseName string   `json:"courseName"`
+	Changes    []Change `json:"changes"`
+	// Environments missing from the manifest that are kept because pruning
+	// was not requested
+	Retained  []address.Address `json:"retained"`
+	Unchanged int               `json:"unchanged"`
+}
+
+// Desired holds the options of every environment a manifest calls for.
+type Desired map[address.Address]deployments.EnvironmentOptions
+
+// Diff plans the creates, updates and, when prune is set, deletes that turn
+// live into desired. Both maps are keyed by canonical address.
+func Diff(courseName string, desired Desired, live Desired, prune bool) Plan {
+	plan := Plan{CourseName: courseName, Changes: []Change{}, Retained: []address.Address{}}
+
+	for environment, options := range desired {
+		current, ok := live[environment]
+		switch {
+		case !ok:
+			plan.Changes = append(plan.Changes, Change{Action: ACTION_CREATE, Address: environment, Options: options})
+		case current != options:
+			previous := current
+			plan.Changes = append(plan.Changes, Change{Action: ACTION_UPDATE, Address: environment, Options: options, Previous: &previous})
+		default:
+			plan.Unchanged++
+		}
+	}
+
+	for environment, options := range live {
+		if _, ok := desired[environment]; ok {
+			continue
+		}
+		if prune {
+			plan.Changes = append(plan.Changes, Change{Action: ACTION_DELETE, Address: environment, Options: options})
+		} else {
+			plan.Retained = append(plan.Retained, environment)
+		}
+	}
+
+	sort.Slice(plan.Changes, func(i, j int) bool {
+		return plan.Changes[i].Address.String() < plan.Changes[j].Address.String()
+	})
+	address.Sort(plan.Retained)
+	return plan
+}
+
+// Count returns the number of changes with the given action.
+func (p Plan) Count(action string) int {
+	count := 0
+	for _, change := range p.Changes {
+		if change.Action == action {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,534 @@
+// Package docker runs student environments as local Docker containers, so
+// the provisioner and frontend can be developed without a cluster.
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/metrics"
+	"github.com/BradleyLewis08/HiVE/internal/naming"
+	"github.com/BradleyLewis08/HiVE/internal/provisioner"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/docker/go-connections/nat"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/exec"
+)
+
+const (
+	DEFAULT_NETWORK = "hive"
+
+	// Marks the containers and network managed by the provisioner
+	COMPONENT_LABEL       = address.COMPONENT_LABEL
+	COMPONENT_ENVIRONMENT = "environment"
+
+	HEALTH_CHECK_TIMEOUT = 2 * time.Second
+
+	// Appended to the name of a container while its replacement starts
+	PREVIOUS_SUFFIX = "-previous"
+)
+
+var CODER_PORT = nat.Port(fmt.Sprintf("%d/tcp", deployments.CODER_PORT))
+
+// Backend runs each environment as a container named after its Deployment,
+// labeled like the Kubernetes objects and attached to a user-defined
+// network. The code-server port is published on the loopback interface for
+// the local proxy.
+type Backend struct {
+	client  *client.Client
+	network string
+}
+
+var _ provisioner.Backend = (*Backend)(nil)
+
+// NewBackend connects to the Docker daemon configured in the environment
+// (DOCKER_HOST and friends) and creates the network if it is missing.
+func NewBackend(ctx context.Context, networkName string) (*Backend, error) {
+	if networkName == "" {
+		networkName = DEFAULT_NETWORK
+	}
+	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	if err != nil {
+		return nil, err
+	}
+
+	backend := &Backend{client: cli, network: networkName}
+	if err := backend.ensureNetwork(ctx); err != nil {
+		return nil, fmt.Errorf("failed to create docker network %s: %w", networkName, err)
+	}
+	return backend, nil
+}
+
+func (b *Backend) ensureNetwork(ctx context.Context) error {
+	_, err := b.client.NetworkInspect(ctx, b.network, network.InspectOptions{})
+	if err == nil || !errdefs.IsNotFound(err) {
+		return err
+	}
+	_, err = b.client.NetworkCreate(ctx, b.network, network.CreateOptions{
+		Driver: "bridge",
+		Labels: map[string]string{address.APP_LABEL: address.APP_LABEL_VALUE},
+	})
+	return err
+}
+
+func (b *Backend) ProvisionStudentEnvironment(
+	ctx context.Context,
+	assignmentName string,
+	courseName string,
+	netID string,
+	options deployments.EnvironmentOptions,
+) (address.Address, error) {
+	environment := address.New(assignmentName, courseName, netID)
+	config, hostConfig, networkConfig, err := b.containerConfig(environment, assignmentName, courseName, netID, options)
+	if err != nil {
+		return address.Address{}, provisioner.WithKind(provisioner.ERROR_INVALID, err)
+	}
+
+	if err := b.pullImage(ctx, options.Image); err != nil {
+		// A missing image is the request's fault, not a missing environment
+		if errdefs.IsNotFound(err) {
+			return address.Address{}, provisioner.WithKind(provisioner.ERROR_INVALID, err)
+		}
+		return address.Address{}, classify(err)
+	}
+
+	// The container stands in for the Deployment, and has no Service
+	start := time.Now()
+	slog.InfoContext(ctx, "Creating container", "course", courseName, "assignment", assignmentName, "netID", netID)
+	created, err := b.client.ContainerCreate(ctx, config, hostConfig, networkConfig, nil, environment.DeploymentName())
+	if err != nil {
+		slog.ErrorContext(ctx, "Error creating container", "error", err)
+		return address.Address{}, classify(err)
+	}
+
+	err = b.client.ContainerStart(ctx, created.ID, container.StartOptions{})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error starting container", "error", err)
+		return address.Address{}, classify(err)
+	}
+	metrics.ObservePhase(metrics.PHASE_DEPLOYMENT, start)
+
+	return environment, nil
+}
+
+// UpdateEnvironment replaces the environment's container, as a Deployment
+// rollout would. The old container is set aside under PREVIOUS_SUFFIX and
+// keeps running until its replacement has started, so an image that fails
+// to pull or a container that fails to start leaves the environment as it
+// was.
+func (b *Backend) UpdateEnvironment(ctx context.Context, environment address.Address, options deployments.EnvironmentOptions) error {
+	existing, err := b.inspect(ctx, environment)
+	if err != nil {
+		return err
+	}
+	labels := existing.Config.Labels
+
+	name := environment.DeploymentName()
+	previous := name + PREVIOUS_SUFFIX
+	if err := b.client.ContainerRename(ctx, existing.ID, previous); err != nil {
+		return classify(err)
+	}
+
+	_, err = b.ProvisionStudentEnvironment(
+		ctx,
+		originalName(labels, naming.ORIGINAL_ASSIGNMENT_ANNOTATION, environment.AssignmentName),
+		originalName(labels, naming.ORIGINAL_COURSE_ANNOTATION, environment.CourseName),
+		originalName(labels, naming.ORIGINAL_STUDENT_ANNOTATION, environment.NetID),
+		options,
+	)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to replace container, restoring the previous one", "environment", environment, "error", err)
+		return errors.Join(err, b.restoreContainer(ctx, existing.ID, name))
+	}
+
+	if err := b.client.ContainerRemove(ctx, existing.ID, container.RemoveOptions{Force: true}); err != nil && !errdefs.IsNotFound(err) {
+		// The environment runs its new container; only the old one is left over
+		slog.ErrorContext(ctx, "Failed to remove replaced container", "container", previous, "error", err)
+	}
+	return nil
+}
+
+// restoreContainer removes whatever was created under name by a failed
+// update, and gives the set-aside container its name back.
+func (b *Backend) restoreContainer(ctx context.Context, id string, name string) error {
+	// The update may have failed after creating its container
+	err := b.client.ContainerRemove(ctx, name, container.RemoveOptions{Force: true})
+	if err != nil && !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to remove replacement container: %w", classify(err))
+	}
+	if err := b.client.ContainerRename(ctx, id, name); err != nil {
+		return fmt.Errorf("failed to restore previous container: %w", classify(err))
+	}
+	return nil
+}
+
+func (b *Backend) DeleteEnvironment(ctx context.Context, environment address.Address) error {
+	err := b.client.ContainerRemove(ctx, environment.DeploymentName(), container.RemoveOptions{Force: true})
+	if errdefs.IsNotFound(err) {
+		return notFound(environment)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to delete container", "container", environment.DeploymentName(), "error", err)
+		return classify(err)
+	}
+	slog.InfoContext(ctx, "Deleted container", "environment", environment)
+	return nil
+}
+
+func (b *Backend) ListEnvironments(ctx context.Context) ([]address.Address, error) {
+	settings, err := b.ListEnvironmentOptions(ctx, provisioner.ENVIRONMENT_LABEL_SELECTOR)
+	if err != nil {
+		return nil, err
+	}
+
+	environments := make([]address.Address, 0, len(settings))
+	for environment := range settings {
+		environments = append(environments, environment)
+	}
+	address.Sort(environments)
+	return environments, nil
+}
+
+func (b *Backend) ListEnvironmentOptions(ctx context.Context, labelSelector string) (map[address.Address]deployments.EnvironmentOptions, error) {
+	args := filters.NewArgs(filters.Arg("label", COMPONENT_LABEL+"="+COMPONENT_ENVIRONMENT))
+	for _, requirement := range strings.Split(labelSelector, ",") {
+		if requirement = strings.TrimSpace(requirement); requirement != "" {
+			args.Add("label", requirement)
+		}
+	}
+
+	containers, err := b.client.ContainerList(ctx, container.ListOptions{All: true, Filters: args})
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	environments := make(map[address.Address]deployments.EnvironmentOptions, len(containers))
+	for _, c := range containers {
+		environment, err := address.FromLabels(c.Labels)
+		if err != nil {
+			continue
+		}
+		environments[environment] = deployments.EnvironmentOptions{
+			Image:           c.Image,
+			ResourceProfile: c.Labels[deployments.RESOURCE_PROFILE_ANNOTATION],
+		}
+	}
+	return environments, nil
+}
+
+func (b *Backend) EnvironmentStatus(ctx context.Context, environment address.Address) (provisioner.Status, error) {
+	info, err := b.inspect(ctx, environment)
+	if err != nil {
+		return provisioner.Status{}, err
+	}
+	return b.containerStatus(ctx, info), nil
+}
+
+// EnvironmentStatuses inspects every container matching the label selector.
+// Containers are never scaled down, so none is reported hibernated.
+func (b *Backend) EnvironmentStatuses(ctx context.Context, labelSelector string) (map[address.Address]provisioner.Status, error) {
+	environments, err := b.ListEnvironmentOptions(ctx, labelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[address.Address]provisioner.Status, len(environments))
+	for environment := range environments {
+		info, err := b.inspect(ctx, environment)
+		if provisioner.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		statuses[environment] = b.containerStatus(ctx, info)
+	}
+	return statuses, nil
+}
+
+// WaitForReady polls the container until code-server answers its health
+// check, the container stops, or ctx is done.
+func (b *Backend) WaitForReady(ctx context.Context, environment address.Address) error {
+	err := wait.PollUntilContextCancel(ctx, time.Second, true, func(ctx context.Context) (bool, error) {
+		info, err := b.inspect(ctx, environment)
+		if err != nil {
+			return false, err
+		}
+		status := b.containerStatus(ctx, info)
+		if status.Phase == provisioner.STATUS_FAILED {
+			return false, &provisioner.FailureError{Environment: environment, Failure: *status.Failure}
+		}
+		return status.Phase == provisioner.STATUS_READY, nil
+	})
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// containerStatus reports a container as ready once code-server answers on
+// its published port. Containers are not restarted, so one that has exited
+// is reported the way Kubernetes would report its pod.
+func (b *Backend) containerStatus(ctx context.Context, info *types.ContainerJSON) provisioner.Status {
+	if info.State == nil {
+		return provisioner.Status{Phase: provisioner.STATUS_PENDING}
+	}
+	if info.State.OOMKilled {
+		return provisioner.Status{Phase: provisioner.STATUS_FAILED, Failure: &provisioner.Failure{
+			Reason:  provisioner.REASON_OOM_KILLED,
+			Message: "container exceeded its memory limit",
+		}}
+	}
+	if info.State.Status == "exited" || info.State.Status == "dead" {
+		return provisioner.Status{Phase: provisioner.STATUS_FAILED, Failure: &provisioner.Failure{
+			Reason:  provisioner.REASON_CRASH_LOOP_BACK_OFF,
+			Message: fmt.Sprintf("container exited with code %d", info.State.ExitCode),
+		}}
+	}
+	if !info.State.Running {
+		return provisioner.Status{Phase: provisioner.STATUS_PENDING}
+	}
+
+	serviceAddress, err := publishedAddress(info)
+	if err != nil || !healthy(ctx, serviceAddress) {
+		return provisioner.Status{Phase: provisioner.STATUS_PENDING}
+	}
+	return provisioner.Status{Phase: provisioner.STATUS_READY}
+}
+
+// healthy probes code-server's health endpoint, as the readiness probe
+// does on Kubernetes.
+func healthy(ctx context.Context, serviceAddress string) bool {
+	ctx, cancel := context.WithTimeout(ctx, HEALTH_CHECK_TIMEOUT)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+serviceAddress+deployments.CODER_HEALTH_PATH, nil)
+	if err != nil {
+		return false
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return false
+	}
+	response.Body.Close()
+	return response.StatusCode == http.StatusOK
+}
+
+// ResetEnvironment recreates the container. The workspace lives in the
+// container's filesystem, so it is discarded as with a new pod.
+func (b *Backend) ResetEnvironment(ctx context.Context, environment address.Address) error {
+	existing, err := b.inspect(ctx, environment)
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Resetting environment", "environment", environment)
+	return b.UpdateEnvironment(ctx, environment, deployments.EnvironmentOptions{
+		Image:           existing.Config.Image,
+		ResourceProfile: existing.Config.Labels[deployments.RESOURCE_PROFILE_ANNOTATION],
+	})
+}
+
+func (b *Backend) StreamLogs(ctx context.Context, environment address.Address, options *apiv1.PodLogOptions) (io.ReadCloser, error) {
+	if _, err := b.inspect(ctx, environment); err != nil {
+		return nil, classify(err)
+	}
+
+	logOptions := container.LogsOptions{ShowStdout: true, ShowStderr: true, Follow: options.Follow}
+	if options.TailLines != nil {
+		logOptions.Tail = strconv.FormatInt(*options.TailLines, 10)
+	}
+	logs, err := b.client.ContainerLogs(ctx, environment.DeploymentName(), logOptions)
+	if err != nil {
+		return nil, classify(err)
+	}
+
+	// Containers run without a TTY, so stdout and stderr are multiplexed
+	reader, writer := io.Pipe()
+	go func() {
+		_, err := stdcopy.StdCopy(writer, writer, logs)
+		logs.Close()
+		writer.CloseWithError(err)
+	}()
+	return reader, nil
+}
+
+// Exec runs command in the environment. A non-zero exit status is returned
+// as an exec.ExitError, as the Kubernetes backend does.
+func (b *Backend) Exec(ctx context.Context, environment address.Address, command []string, stdout io.Writer, stderr io.Writer) error {
+	if _, err := b.inspect(ctx, environment); err != nil {
+		return err
+	}
+
+	created, err := b.client.ContainerExecCreate(ctx, environment.DeploymentName(), container.ExecOptions{
+		Cmd:          command,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return classify(err)
+	}
+
+	attached, err := b.client.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return classify(err)
+	}
+	defer attached.Close()
+
+	if _, err := stdcopy.StdCopy(stdout, stderr, attached.Reader); err != nil {
+		return err
+	}
+
+	result, err := b.client.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return classify(err)
+	}
+	if result.ExitCode != 0 {
+		return exec.CodeExitError{Err: fmt.Errorf("command terminated with exit code %d", result.ExitCode), Code: result.ExitCode}
+	}
+	return nil
+}
+
+// ServiceAddress returns the loopback address the environment's code-server
+// port is published on.
+func (b *Backend) ServiceAddress(ctx context.Context, environment address.Address) (string, error) {
+	info, err := b.inspect(ctx, environment)
+	if err != nil {
+		return "", err
+	}
+	serviceAddress, err := publishedAddress(info)
+	if err != nil {
+		return "", fmt.Errorf("environment %s has no published port", environment)
+	}
+	return serviceAddress, nil
+}
+
+func publishedAddress(info *types.ContainerJSON) (string, error) {
+	if info.NetworkSettings == nil || len(info.NetworkSettings.Ports[CODER_PORT]) == 0 {
+		return "", fmt.Errorf("container %s has no published port", info.Name)
+	}
+	binding := info.NetworkSettings.Ports[CODER_PORT][0]
+	return fmt.Sprintf("127.0.0.1:%s", binding.HostPort), nil
+}
+
+func (b *Backend) containerConfig(
+	environment address.Address,
+	assignmentName string,
+	courseName string,
+	netID string,
+	options deployments.EnvironmentOptions,
+) (*container.Config, *container.HostConfig, *network.NetworkingConfig, error) {
+	resources, err := deployments.ResourceProfile(options.ResourceProfile)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Labels carry what annotations carry on Kubernetes
+	labels := environment.Labels()
+	labels[COMPONENT_LABEL] = COMPONENT_ENVIRONMENT
+	for key, value := range naming.OriginalAnnotations(assignmentName, courseName, netID) {
+		labels[key] = value
+	}
+	if options.ResourceProfile != "" {
+		labels[deployments.RESOURCE_PROFILE_ANNOTATION] = options.ResourceProfile
+	}
+
+	config := &container.Config{
+		Image:        options.Image,
+		Labels:       labels,
+		ExposedPorts: nat.PortSet{CODER_PORT: struct{}{}},
+	}
+
+	hostConfig := &container.HostConfig{
+		NetworkMode: container.NetworkMode(b.network),
+		// Publish on a free loopback port for the local proxy
+		PortBindings: nat.PortMap{CODER_PORT: []nat.PortBinding{{HostIP: "127.0.0.1"}}},
+	}
+	if limit, ok := resources.Limits[apiv1.ResourceCPU]; ok {
+		hostConfig.NanoCPUs = limit.MilliValue() * 1000000
+	}
+	if limit, ok := resources.Limits[apiv1.ResourceMemory]; ok {
+		hostConfig.Memory = limit.Value()
+	}
+
+	// Reachable from other containers on the network under its service name
+	networkConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			b.network: {Aliases: []string{environment.ServiceName()}},
+		},
+	}
+	return config, hostConfig, networkConfig, nil
+}
+
+// pullImage pulls the image unless it is already present locally.
+func (b *Backend) pullImage(ctx context.Context, ref string) error {
+	if _, _, err := b.client.ImageInspectWithRaw(ctx, ref); err == nil {
+		return nil
+	}
+	slog.InfoContext(ctx, "Pulling image", "image", ref)
+	progress, err := b.client.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return classify(err)
+	}
+	defer progress.Close()
+	_, err = io.Copy(io.Discard, progress)
+	return classify(err)
+}
+
+func (b *Backend) inspect(ctx context.Context, environment address.Address) (*types.ContainerJSON, error) {
+	info, err := b.client.ContainerInspect(ctx, environment.DeploymentName())
+	if errdefs.IsNotFound(err) {
+		return nil, notFound(environment)
+	}
+	if err != nil {
+		return nil, classify(err)
+	}
+	return &info, nil
+}
+
+// notFound reports a missing container the way the Kubernetes backend
+// reports a missing Deployment, so handlers treat both alike.
+func notFound(environment address.Address) error {
+	return provisioner.WithKind(provisioner.ERROR_NOT_FOUND, fmt.Errorf("environment %s not found", environment))
+}
+
+// classify gives errors from the Docker daemon the kinds the Kubernetes
+// backend derives from API errors.
+func classify(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errdefs.IsNotFound(err):
+		return provisioner.WithKind(provisioner.ERROR_NOT_FOUND, err)
+	case errdefs.IsConflict(err):
+		return provisioner.WithKind(provisioner.ERROR_CONFLICT, err)
+	case errdefs.IsInvalidParameter(err):
+		return provisioner.WithKind(provisioner.ERROR_INVALID, err)
+	case errdefs.IsUnavailable(err), client.IsErrConnectionFailed(err):
+		return provisioner.WithKind(provisioner.ERROR_UNAVAILABLE, err)
+	}
+	return err
+}
+
+func originalName(labels map[string]string, key string, sanitized string) string {
+	if name := labels[key]; name != "" {
+		return name
+	}
+	return sanitized
+}
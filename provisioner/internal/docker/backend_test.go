@@ -0,0 +1,193 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/naming"
+	"github.com/BradleyLewis08/HiVE/internal/provisioner"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+)
+
+// fakeDaemon is the part of the Docker Engine API the backend uses to
+// create, rename and remove containers. Images listed in missing cannot be
+// pulled, and every other image pulls successfully.
+type fakeDaemon struct {
+	mu         sync.Mutex
+	containers map[string]*types.ContainerJSON // name -> container
+	missing    map[string]bool
+	nextID     int
+}
+
+func newFakeDaemon(t *testing.T) (*fakeDaemon, *Backend) {
+	daemon := &fakeDaemon{containers: make(map[string]*types.ContainerJSON), missing: make(map[string]bool)}
+	server := httptest.NewServer(daemon)
+	t.Cleanup(server.Close)
+
+	cli, err := client.NewClientWithOpts(client.WithHost("tcp://"+strings.TrimPrefix(server.URL, "http://")), client.WithVersion("1.45"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return daemon, &Backend{client: cli, network: DEFAULT_NETWORK}
+}
+
+func (d *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	path := r.URL.Path[strings.Index(r.URL.Path[1:], "/")+1:] // strip the version
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && segments[0] == "images":
+		writeError(w, http.StatusNotFound, "no such image")
+	case r.Method == http.MethodPost && path == "/images/create":
+		image := r.URL.Query().Get("fromImage")
+		if tag := r.URL.Query().Get("tag"); tag != "" {
+			image += ":" + tag
+		}
+		if d.missing[image] {
+			writeError(w, http.StatusNotFound, "pull access denied for "+image)
+			return
+		}
+		w.Write([]byte(`{"status":"Downloaded"}`))
+	case r.Method == http.MethodPost && path == "/containers/create":
+		name := r.URL.Query().Get("name")
+		if _, ok := d.containers[name]; ok {
+			writeError(w, http.StatusConflict, "name "+name+" is already in use")
+			return
+		}
+		var config container.Config
+		json.NewDecoder(r.Body).Decode(&config)
+		d.nextID++
+		d.containers[name] = &types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: fmt.Sprintf("id%d", d.nextID), Name: "/" + name, State: &types.ContainerState{Status: "created"}},
+			Config:            &config,
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(container.CreateResponse{ID: fmt.Sprintf("id%d", d.nextID)})
+	case segments[0] == "containers" && len(segments) >= 2:
+		name, info := d.find(segments[1])
+		if info == nil {
+			writeError(w, http.StatusNotFound, "no such container")
+			return
+		}
+		switch {
+		case r.Method == http.MethodGet && len(segments) == 3 && segments[2] == "json":
+			json.NewEncoder(w).Encode(info)
+		case r.Method == http.MethodPost && len(segments) == 3 && segments[2] == "start":
+			info.State = &types.ContainerState{Status: "running", Running: true}
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodPost && len(segments) == 3 && segments[2] == "rename":
+			newName := r.URL.Query().Get("name")
+			if _, ok := d.containers[newName]; ok {
+				writeError(w, http.StatusConflict, "name "+newName+" is already in use")
+				return
+			}
+			delete(d.containers, name)
+			info.Name = "/" + newName
+			d.containers[newName] = info
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodDelete && len(segments) == 2:
+			delete(d.containers, name)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.NotFound(w, r)
+		}
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// find looks a container up by name or ID.
+func (d *fakeDaemon) find(ref string) (string, *types.ContainerJSON) {
+	if info, ok := d.containers[ref]; ok {
+		return ref, info
+	}
+	for name, info := range d.containers {
+		if info.ID == ref {
+			return name, info
+		}
+	}
+	return "", nil
+}
+
+func (d *fakeDaemon) names() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var names []string
+	for name := range d.containers {
+		names = append(names, name)
+	}
+	return names
+}
+
+func (d *fakeDaemon) image(name string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if info, ok := d.containers[name]; ok {
+		return info.Config.Image
+	}
+	return ""
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+func TestUpdateEnvironment(t *testing.T) {
+	ctx := context.Background()
+	daemon, backend := newFakeDaemon(t)
+	daemon.missing["code-server:missing"] = true
+
+	environment, err := backend.ProvisionStudentEnvironment(ctx, "hw1", "CPSC 323", "alice", deployments.EnvironmentOptions{Image: "code-server:v1"})
+	if err != nil {
+		t.Fatalf("ProvisionStudentEnvironment: %v", err)
+	}
+	name := environment.DeploymentName()
+
+	err = backend.UpdateEnvironment(ctx, environment, deployments.EnvironmentOptions{Image: "code-server:missing"})
+	if provisioner.ErrorKind(err) != provisioner.ERROR_INVALID {
+		t.Fatalf("UpdateEnvironment with a missing image = %v, want an invalid request", err)
+	}
+	if names := daemon.names(); len(names) != 1 || names[0] != name {
+		t.Fatalf("containers after a failed update = %v, want only %s", names, name)
+	}
+	if image := daemon.image(name); image != "code-server:v1" {
+		t.Fatalf("environment runs %q after a failed update, want the previous image", image)
+	}
+
+	if err := backend.UpdateEnvironment(ctx, environment, deployments.EnvironmentOptions{Image: "code-server:v2"}); err != nil {
+		t.Fatalf("UpdateEnvironment: %v", err)
+	}
+	if names := daemon.names(); len(names) != 1 || names[0] != name {
+		t.Fatalf("containers after an update = %v, want only %s", names, name)
+	}
+	if image := daemon.image(name); image != "code-server:v2" {
+		t.Fatalf("environment runs %q after an update, want code-server:v2", image)
+	}
+
+	// The original names are carried over to the replacement
+	daemon.mu.Lock()
+	labels := daemon.containers[name].Config.Labels
+	daemon.mu.Unlock()
+	if labels[naming.ORIGINAL_COURSE_ANNOTATION] != "CPSC 323" {
+		t.Fatalf("replacement container lost the original course name: %v", labels)
+	}
+
+	missing := address.New("hw1", "cpsc323", "nobody")
+	if err := backend.UpdateEnvironment(ctx, missing, deployments.EnvironmentOptions{Image: "code-server:v2"}); !provisioner.IsNotFound(err) {
+		t.Fatalf("UpdateEnvironment of a missing environment = %v, want not found", err)
+	}
+}
@@ -0,0 +1,171 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/routing"
+)
+
+const DEFAULT_PROXY_ADDRESS = ":8080"
+
+// ProxyRouter exposes environment containers through an in-process reverse
+// proxy, standing in for the Ingress controller. Like the Ingress backend it
+// strips the /environment/<course>/<assignment>/<netID> prefix.
+type ProxyRouter struct {
+	backend       *Backend
+	listenAddress string
+
+	mu     sync.RWMutex
+	routes map[string]*proxyRoute // path -> route
+	ready  bool
+}
+
+type proxyRoute struct {
+	environment address.Address
+	proxy       *httputil.ReverseProxy
+}
+
+var _ routing.Router = (*ProxyRouter)(nil)
+var _ routing.StatusReporter = (*ProxyRouter)(nil)
+
+func NewProxyRouter(backend *Backend, listenAddress string) *ProxyRouter {
+	if listenAddress == "" {
+		listenAddress = DEFAULT_PROXY_ADDRESS
+	}
+	return &ProxyRouter{backend: backend, listenAddress: listenAddress, routes: make(map[string]*proxyRoute)}
+}
+
+// Provision starts serving the proxy. It is safe to call more than once.
+func (pr *ProxyRouter) Provision(ctx context.Context) error {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	if pr.ready {
+		return nil
+	}
+
+	listener, err := net.Listen("tcp", pr.listenAddress)
+	if err != nil {
+		return fmt.Errorf("failed to start environment proxy: %w", err)
+	}
+	go func() {
+		if err := http.Serve(listener, pr); err != nil {
+			slog.Error("Environment proxy stopped", "error", err)
+		}
+	}()
+
+	slog.InfoContext(ctx, "Environment proxy listening", "address", pr.listenAddress)
+	pr.ready = true
+	return nil
+}
+
+func (pr *ProxyRouter) AddRoute(ctx context.Context, environment address.Address) error {
+	route, err := pr.newRoute(ctx, environment)
+	if err != nil {
+		return err
+	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.routes[environment.Path()] = route
+	return nil
+}
+
+func (pr *ProxyRouter) RemoveRoute(ctx context.Context, environment address.Address) error {
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	delete(pr.routes, environment.Path())
+	return nil
+}
+
+func (pr *ProxyRouter) ListRoutes(ctx context.Context) ([]address.Address, error) {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+	routes := make([]address.Address, 0, len(pr.routes))
+	for _, route := range pr.routes {
+		routes = append(routes, route.environment)
+	}
+	address.Sort(routes)
+	return routes, nil
+}
+
+func (pr *ProxyRouter) SyncRoutes(ctx context.Context, routes []address.Address) error {
+	desired := make(map[string]*proxyRoute, len(routes))
+	for _, environment := range routes {
+		route, err := pr.newRoute(ctx, environment)
+		if err != nil {
+			return err
+		}
+		desired[environment.Path()] = route
+	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.routes = desired
+	return nil
+}
+
+func (pr *ProxyRouter) Status(ctx context.Context) (*routing.Status, error) {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+	status := &routing.Status{Backend: routing.BACKEND_DOCKER, Ready: pr.ready, Replicas: 1, Address: pr.listenAddress}
+	if pr.ready {
+		status.ReadyReplicas = 1
+	}
+	return status, nil
+}
+
+func (pr *ProxyRouter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/healthz" {
+		w.Write([]byte("ok"))
+		return
+	}
+
+	environment, err := address.FromPath(r.URL.Path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	prefix := environment.Path()
+
+	pr.mu.RLock()
+	route, ok := pr.routes[prefix]
+	pr.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// code-server serves relative links, so the root needs a trailing slash
+	if r.URL.Path == prefix {
+		http.Redirect(w, r, prefix+"/", http.StatusMovedPermanently)
+		return
+	}
+	route.proxy.ServeHTTP(w, r)
+}
+
+func (pr *ProxyRouter) newRoute(ctx context.Context, environment address.Address) (*proxyRoute, error) {
+	serviceAddress, err := pr.backend.ServiceAddress(ctx, environment)
+	if err != nil {
+		return nil, err
+	}
+	target := &url.URL{Scheme: "http", Host: serviceAddress}
+	prefix := environment.Path()
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(request *httputil.ProxyRequest) {
+			request.SetURL(target)
+			request.Out.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(request.In.URL.Path, prefix), "/")
+			request.Out.URL.RawPath = ""
+			request.Out.Host = request.In.Host
+			request.SetXForwarded()
+		},
+	}
+	return &proxyRoute{environment: environment, proxy: proxy}, nil
+}
@@ -0,0 +1,115 @@
+// Package drift finds where the cluster has strayed from the environments
+// that should exist, such as objects deleted or edited by hand and routes
+// that no longer lead anywhere.
+package drift
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/provisioner"
+)
+
+// Kinds of drift
+const (
+	// A desired environment has no Deployment
+	KIND_MISSING_DEPLOYMENT = "missing-deployment"
+	// A desired environment has no Service
+	KIND_MISSING_SERVICE = "missing-service"
+	// A desired environment runs with other options than it should
+	KIND_OPTIONS = "options"
+	// A desired environment is not routed
+	KIND_MISSING_ROUTE = "missing-route"
+	// A route leads to an environment that is neither desired nor running
+	KIND_STALE_ROUTE = "stale-route"
+	// An environment runs without being desired. It is not repaired; the
+	// garbage collector deletes it once it has been orphaned for a while.
+	KIND_UNDESIRED = "undesired"
+)
+
+// Drift is a single difference between the desired and live state.
+type Drift struct {
+	Environment address.Address `json:"environment"`
+	Kind        string          `json:"kind"`
+	Detail      string          `json:"detail,omitempty"`
+	// Whether the reconciler repairs this kind of drift
+	Repairable bool `json:"repairable"`
+	// When the drift was first detected; it may have been found in several
+	// passes since
+	Since time.Time `json:"since"`
+	// Why the last repair failed
+	Error string `json:"error,omitempty"`
+}
+
+// Key identifies the drift across passes.
+func (d Drift) Key() string {
+	return d.Kind + " " + d.Environment.String()
+}
+
+// Detect compares the desired environments with the inventory of the
+// backend and, unless routes is nil, with the routes the router serves.
+// Drift is returned sorted by environment, with Since unset.
+func Detect(desired map[address.Address]deployments.EnvironmentOptions, inventory provisioner.Inventory, routes []address.Address) []Drift {
+	found := []Drift{}
+	add := func(environment address.Address, kind string, detail string) {
+		found = append(found, Drift{
+			Environment: environment,
+			Kind:        kind,
+			Detail:      detail,
+			Repairable:  kind != KIND_UNDESIRED,
+		})
+	}
+
+	for environment, options := range desired {
+		live, ok := inventory.Deployments[environment]
+		switch {
+		case !ok:
+			add(environment, KIND_MISSING_DEPLOYMENT, "")
+		case live != options:
+			add(environment, KIND_OPTIONS, fmt.Sprintf("running %s, should run %s", describe(live), describe(options)))
+		}
+		if !inventory.Services[environment] {
+			add(environment, KIND_MISSING_SERVICE, "")
+		}
+	}
+	for environment := range inventory.Deployments {
+		if _, ok := desired[environment]; !ok {
+			add(environment, KIND_UNDESIRED, "")
+		}
+	}
+
+	if routes != nil {
+		routed := make(map[address.Address]bool, len(routes))
+		for _, environment := range routes {
+			routed[environment] = true
+			_, isDesired := desired[environment]
+			_, isRunning := inventory.Deployments[environment]
+			if !isDesired && !isRunning {
+				add(environment, KIND_STALE_ROUTE, "")
+			}
+		}
+		for environment := range desired {
+			if !routed[environment] {
+				add(environment, KIND_MISSING_ROUTE, "")
+			}
+		}
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Environment != found[j].Environment {
+			return found[i].Environment.String() < found[j].Environment.String()
+		}
+		return found[i].Kind < found[j].Kind
+	})
+	return found
+}
+
+func describe(options deployments.EnvironmentOptions) string {
+	if options.ResourceProfile == "" {
+		return options.Image
+	}
+	return fmt.Sprintf("%s with the %s profile", options.Image, options.ResourceProfile)
+}
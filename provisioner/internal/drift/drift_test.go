@@ -0,0 +1,110 @@
+package drift
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/provisioner"
+)
+
+func TestDetect(t *testing.T) {
+	alice := address.New("hw1", "cpsc323", "alice")
+	bob := address.New("hw1", "cpsc323", "bob")
+	small := deployments.EnvironmentOptions{Image: "code-server:v1", ResourceProfile: "small"}
+	upgraded := deployments.EnvironmentOptions{Image: "code-server:v2"}
+
+	tests := []struct {
+		name      string
+		desired   map[address.Address]deployments.EnvironmentOptions
+		inventory provisioner.Inventory
+		routes    []address.Address
+		want      []Drift
+	}{
+		{
+			name:    "converged",
+			desired: map[address.Address]deployments.EnvironmentOptions{alice: small},
+			inventory: provisioner.Inventory{
+				Deployments: map[address.Address]deployments.EnvironmentOptions{alice: small},
+				Services:    map[address.Address]bool{alice: true},
+			},
+			routes: []address.Address{alice},
+			want:   []Drift{},
+		},
+		{
+			name:    "deleted by hand",
+			desired: map[address.Address]deployments.EnvironmentOptions{alice: small},
+			routes:  []address.Address{alice},
+			want: []Drift{
+				{Environment: alice, Kind: KIND_MISSING_DEPLOYMENT, Repairable: true},
+				{Environment: alice, Kind: KIND_MISSING_SERVICE, Repairable: true},
+			},
+		},
+		{
+			name:    "other options",
+			desired: map[address.Address]deployments.EnvironmentOptions{alice: upgraded},
+			inventory: provisioner.Inventory{
+				Deployments: map[address.Address]deployments.EnvironmentOptions{alice: small},
+				Services:    map[address.Address]bool{alice: true},
+			},
+			routes: []address.Address{alice},
+			want: []Drift{
+				{Environment: alice, Kind: KIND_OPTIONS, Detail: "running code-server:v1 with the small profile, should run code-server:v2", Repairable: true},
+			},
+		},
+		{
+			name: "undesired",
+			inventory: provisioner.Inventory{
+				Deployments: map[address.Address]deployments.EnvironmentOptions{bob: small},
+				Services:    map[address.Address]bool{bob: true},
+			},
+			routes: []address.Address{bob},
+			want: []Drift{
+				{Environment: bob, Kind: KIND_UNDESIRED, Repairable: false},
+			},
+		},
+		{
+			name:    "routes",
+			desired: map[address.Address]deployments.EnvironmentOptions{alice: small},
+			inventory: provisioner.Inventory{
+				Deployments: map[address.Address]deployments.EnvironmentOptions{alice: small},
+				Services:    map[address.Address]bool{alice: true},
+			},
+			routes: []address.Address{bob},
+			want: []Drift{
+				{Environment: alice, Kind: KIND_MISSING_ROUTE, Repairable: true},
+				{Environment: bob, Kind: KIND_STALE_ROUTE, Repairable: true},
+			},
+		},
+		{
+			name:    "routes not checked",
+			desired: map[address.Address]deployments.EnvironmentOptions{alice: small},
+			inventory: provisioner.Inventory{
+				Deployments: map[address.Address]deployments.EnvironmentOptions{alice: small},
+				Services:    map[address.Address]bool{alice: true},
+			},
+			want: []Drift{},
+		},
+		{
+			name:    "sorted by environment, then kind",
+			desired: map[address.Address]deployments.EnvironmentOptions{bob: small, alice: small},
+			routes:  []address.Address{},
+			want: []Drift{
+				{Environment: alice, Kind: KIND_MISSING_DEPLOYMENT, Repairable: true},
+				{Environment: alice, Kind: KIND_MISSING_ROUTE, Repairable: true},
+				{Environment: alice, Kind: KIND_MISSING_SERVICE, Repairable: true},
+				{Environment: bob, Kind: KIND_MISSING_DEPLOYMENT, Repairable: true},
+				{Environment: bob, Kind: KIND_MISSING_ROUTE, Repairable: true},
+				{Environment: bob, Kind: KIND_MISSING_SERVICE, Repairable: true},
+			},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Detect(tc.desired, tc.inventory, tc.routes); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Detect = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
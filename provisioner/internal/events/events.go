@@ -0,0 +1,163 @@
+// Package events fans out typed environment events, such as an environment
+// becoming ready, to subscribers of the API's event stream.
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+)
+
+// Event types, in the order an environment usually goes through them
+const (
+	EVENT_CREATED       = "environment.created"
+	EVENT_POD_SCHEDULED = "pod.scheduled"
+	EVENT_IMAGE_PULLING = "image.pulling"
+	EVENT_READY         = "environment.ready"
+	EVENT_FAILED        = "environment.failed"
+	EVENT_HIBERNATED    = "environment.hibernated"
+	EVENT_ROUTE_ADDED   = "route.added"
+	EVENT_ROUTE_DELETED = "route.deleted"
+	EVENT_DELETED       = "environment.deleted"
+	// Drift the reconciler cannot repair, or failed to; the reason is the
+	// kind of drift
+	EVENT_DRIFT = "environment.drift"
+)
+
+// Number of past events kept so that subscribers reconnecting with the ID
+// of the last event they saw miss nothing
+const HISTORY_SIZE = 1024
+
+// Events buffered per subscriber. A subscriber that falls further behind is
+// disconnected, and can catch up from the history when it reconnects.
+const SUBSCRIBER_BUFFER = 256
+
+type Event struct {
+	// Assigned in order of publishing, starting at 1
+	ID          int64           `json:"id"`
+	Type        string          `json:"type"`
+	Time        time.Time       `json:"time"`
+	Environment address.Address `json:"environment"`
+	// Set on failures, e.g. ImagePullBackOff
+	Reason  string `json:"reason,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Filter selects events. Zero fields match everything; the environment
+// fields match individually, so a course alone selects all of its events.
+type Filter struct {
+	Environment address.Address
+	// Event types to deliver; all when empty
+	Types map[string]bool
+}
+
+func (f Filter) Matches(event Event) bool {
+	return (f.Environment.CourseName == "" || f.Environment.CourseName == event.Environment.CourseName) &&
+		(f.Environment.AssignmentName == "" || f.Environment.AssignmentName == event.Environment.AssignmentName) &&
+		(f.Environment.NetID == "" || f.Environment.NetID == event.Environment.NetID) &&
+		(len(f.Types) == 0 || f.Types[event.Type])
+}
+
+// Watcher is implemented by backends that can observe their environments
+// change. WatchEvents publishes events until ctx is done.
+type Watcher interface {
+	WatchEvents(ctx context.Context, broker *Broker) error
+}
+
+type Broker struct {
+	mu          sync.Mutex
+	nextID      int64
+	history     []Event
+	subscribers map[*Subscription]bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{nextID: 1, subscribers: make(map[*Subscription]bool)}
+}
+
+// Publish assigns the event its ID, and its time if unset, and delivers it
+// to every subscriber whose filter it matches.
+func (b *Broker) Publish(event Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	event.ID = b.nextID
+	b.nextID++
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	b.history = append(b.history, event)
+	if len(b.history) > HISTORY_SIZE {
+		b.history = b.history[len(b.history)-HISTORY_SIZE:]
+	}
+
+	for subscription := range b.subscribers {
+		if !subscription.filter.Matches(event) {
+			continue
+		}
+		select {
+		case subscription.events <- event:
+		default:
+			b.drop(subscription)
+		}
+	}
+}
+
+// Subscribe delivers matching events as they are published. When after is
+// set, matching events published after the one with that ID are delivered
+// first, as far back as the history goes.
+func (b *Broker) Subscribe(filter Filter, after int64) *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	subscription := &Subscription{
+		broker: b,
+		filter: filter,
+		events: make(chan Event, SUBSCRIBER_BUFFER),
+	}
+	if after > 0 {
+		var missed []Event
+		for _, event := range b.history {
+			if event.ID > after && filter.Matches(event) {
+				missed = append(missed, event)
+			}
+		}
+		if len(missed) > SUBSCRIBER_BUFFER {
+			missed = missed[len(missed)-SUBSCRIBER_BUFFER:]
+		}
+		for _, event := range missed {
+			subscription.events <- event
+		}
+	}
+	b.subscribers[subscription] = true
+	return subscription
+}
+
+// drop disconnects a subscriber, closing its channel. The lock must be held.
+func (b *Broker) drop(subscription *Subscription) {
+	if b.subscribers[subscription] {
+		delete(b.subscribers, subscription)
+		close(subscription.events)
+	}
+}
+
+type Subscription struct {
+	broker *Broker
+	filter Filter
+	events chan Event
+}
+
+// Events delivers the subscription's events. It is closed when the
+// subscription is, or when the subscriber falls too far behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.drop(s)
+}
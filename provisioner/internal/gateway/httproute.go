@@ -0,0 +1,394 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	k8sclient "github.com/BradleyLewis08/HiVE/internal/kubernetes"
+	"github.com/BradleyLewis08/HiVE/internal/routing"
+	"github.com/BradleyLewis08/HiVE/internal/utils"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	// One HTTPRoute per student environment
+	SCOPE_ENVIRONMENT = "environment"
+	// One HTTPRoute per course, with a rule per student environment, split
+	// across several HTTPRoutes when the course has more than MAX_RULES
+	SCOPE_COURSE = "course"
+
+	// Gateway API v1 allows at most this many rules in an HTTPRoute
+	MAX_RULES = 16
+
+	// Long-lived code-server WebSocket connections must not be cut off,
+	// matching the proxy-read-timeout used by the Ingress backend.
+	DEFAULT_TIMEOUT = "3600s"
+
+	// COMPONENT_LABEL value marking the HTTPRoutes the provisioner manages
+	COMPONENT_ROUTE = "environment-route"
+)
+
+var ROUTE_LABEL_SELECTOR = labels.SelectorFromSet(labels.Set{
+	address.APP_LABEL:       address.APP_LABEL_VALUE,
+	address.COMPONENT_LABEL: COMPONENT_ROUTE,
+}).String()
+
+type Config struct {
+	GatewayName      string
+	GatewayNamespace string
+	// Scope is either SCOPE_ENVIRONMENT (the default) or SCOPE_COURSE.
+	Scope string
+	// Hostname restricts routes to a single host. When MatchHost is set,
+	// environments are instead served from the root of
+	// <environment DNS label>.<Hostname>.
+	Hostname  string
+	MatchHost bool
+	// Timeout is applied to both the request and backend request timeouts.
+	Timeout string
+}
+
+// HTTPRouteManager exposes student environments through Gateway API
+// HTTPRoutes attached to an existing Gateway.
+type HTTPRouteManager struct {
+	k8sClient *k8sclient.Client
+	config    Config
+}
+
+var _ routing.Router = (*HTTPRouteManager)(nil)
+var _ routing.Renderer = (*HTTPRouteManager)(nil)
+
+func NewHTTPRouteManager(k8sClient *k8sclient.Client, config Config) (*HTTPRouteManager, error) {
+	if config.GatewayName == "" {
+		return nil, fmt.Errorf("a gateway name is required")
+	}
+	if config.Scope == "" {
+		config.Scope = SCOPE_ENVIRONMENT
+	}
+	if config.Scope != SCOPE_ENVIRONMENT && config.Scope != SCOPE_COURSE {
+		return nil, fmt.Errorf("unknown HTTPRoute scope %q", config.Scope)
+	}
+	if config.MatchHost && config.Hostname == "" {
+		return nil, fmt.Errorf("host matching requires a hostname")
+	}
+	// Hostnames are set per HTTPRoute, so a shared course route cannot
+	// match a different host for each student.
+	if config.MatchHost && config.Scope != SCOPE_ENVIRONMENT {
+		return nil, fmt.Errorf("host matching requires the %s scope", SCOPE_ENVIRONMENT)
+	}
+	if config.Timeout == "" {
+		config.Timeout = DEFAULT_TIMEOUT
+	}
+	return &HTTPRouteManager{k8sClient: k8sClient, config: config}, nil
+}
+
+// Provision is a no-op: HTTPRoutes are created alongside the environments
+// they expose and the Gateway itself is managed by the cluster operator.
+func (hm *HTTPRouteManager) Provision(ctx context.Context) error {
+	return nil
+}
+
+func (hm *HTTPRouteManager) AddRoute(ctx context.Context, environment address.Address) error {
+	if hm.config.Scope == SCOPE_ENVIRONMENT {
+		return hm.write(ctx, hm.newHTTPRoute(environment.HTTPRouteName(), environment.CourseName, []address.Address{environment}))
+	}
+
+	routes, names, err := hm.courseRoutes(ctx, environment.CourseName)
+	if err != nil {
+		return err
+	}
+	for _, existing := range routes {
+		if existing == environment {
+			return nil
+		}
+	}
+	return hm.writeCourse(ctx, append(routes, environment), names)
+}
+
+// RemoveRoute deletes the environment's HTTPRoute, or its rule within the
+// course's HTTPRoutes. A course HTTPRoute is deleted once it has no rules.
+func (hm *HTTPRouteManager) RemoveRoute(ctx context.Context, environment address.Address) error {
+	if hm.config.Scope == SCOPE_ENVIRONMENT {
+		return ignoreNotFound(hm.k8sClient.DeleteHTTPRoute(ctx, environment.HTTPRouteName()))
+	}
+
+	routes, names, err := hm.courseRoutes(ctx, environment.CourseName)
+	if err != nil {
+		return err
+	}
+	remaining := routes[:0]
+	for _, existing := range routes {
+		if existing != environment {
+			remaining = append(remaining, existing)
+		}
+	}
+	return hm.writeCourse(ctx, remaining, names)
+}
+
+func (hm *HTTPRouteManager) ListRoutes(ctx context.Context) ([]address.Address, error) {
+	objs, err := hm.k8sClient.ListHTTPRoutes(ctx, ROUTE_LABEL_SELECTOR)
+	if err != nil {
+		return nil, err
+	}
+
+	routes := []address.Address{}
+	for _, obj := range objs {
+		routes = append(routes, routesFromHTTPRoute(&obj)...)
+	}
+	address.Sort(routes)
+	return routes, nil
+}
+
+func (hm *HTTPRouteManager) SyncRoutes(ctx context.Context, routes []address.Address) error {
+	desired := hm.groupRoutes(routes)
+
+	objs, err := hm.k8sClient.ListHTTPRoutes(ctx, ROUTE_LABEL_SELECTOR)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objs {
+		if _, ok := desired[obj.GetName()]; !ok {
+			if err := ignoreNotFound(hm.k8sClient.DeleteHTTPRoute(ctx, obj.GetName())); err != nil {
+				return err
+			}
+		}
+	}
+
+	for name, group := range desired {
+		if err := hm.write(ctx, hm.newHTTPRoute(name, group[0].CourseName, group)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RenderRoutes returns the HTTPRoutes exposing routes, ordered by name.
+func (hm *HTTPRouteManager) RenderRoutes(routes []address.Address) ([]runtime.Object, error) {
+	groups := hm.groupRoutes(routes)
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	objects := make([]runtime.Object, 0, len(names))
+	for _, name := range names {
+		obj, err := toUnstructured(hm.newHTTPRoute(name, groups[name][0].CourseName, groups[name]))
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
+
+// groupRoutes groups routes by the HTTPRoute that exposes them. In the
+// course scope, each course's routes are split in order across HTTPRoutes
+// of at most MAX_RULES rules.
+func (hm *HTTPRouteManager) groupRoutes(routes []address.Address) map[string][]address.Address {
+	groups := make(map[string][]address.Address)
+	if hm.config.Scope == SCOPE_ENVIRONMENT {
+		for _, route := range routes {
+			groups[route.HTTPRouteName()] = append(groups[route.HTTPRouteName()], route)
+		}
+		return groups
+	}
+
+	courses := make(map[string][]address.Address)
+	for _, route := range routes {
+		courses[route.CourseName] = append(courses[route.CourseName], route)
+	}
+	for courseName, courseRoutes := range courses {
+		address.Sort(courseRoutes)
+		for part := 0; part*MAX_RULES < len(courseRoutes); part++ {
+			end := min((part+1)*MAX_RULES, len(courseRoutes))
+			groups[address.CourseHTTPRouteName(courseName, part)] = courseRoutes[part*MAX_RULES : end]
+		}
+	}
+	return groups
+}
+
+// courseRoutes returns the environments routed by a course's HTTPRoutes,
+// and the names of those HTTPRoutes.
+func (hm *HTTPRouteManager) courseRoutes(ctx context.Context, courseName string) ([]address.Address, []string, error) {
+	selector := ROUTE_LABEL_SELECTOR + "," + address.COURSE_LABEL + "=" + courseName
+	objs, err := hm.k8sClient.ListHTTPRoutes(ctx, selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	var routes []address.Address
+	var names []string
+	for _, obj := range objs {
+		routes = append(routes, routesFromHTTPRoute(&obj)...)
+		names = append(names, obj.GetName())
+	}
+	return routes, names, nil
+}
+
+// writeCourse writes the HTTPRoutes exposing a course's routes, then
+// deletes those of existing that are no longer needed.
+func (hm *HTTPRouteManager) writeCourse(ctx context.Context, routes []address.Address, existing []string) error {
+	groups := hm.groupRoutes(routes)
+	for name, group := range groups {
+		if err := hm.write(ctx, hm.newHTTPRoute(name, group[0].CourseName, group)); err != nil {
+			return err
+		}
+	}
+	for _, name := range existing {
+		if _, ok := groups[name]; !ok {
+			if err := ignoreNotFound(hm.k8sClient.DeleteHTTPRoute(ctx, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// write creates the HTTPRoute, or replaces the spec of an existing one.
+func (hm *HTTPRouteManager) write(ctx context.Context, httpRoute *HTTPRoute) error {
+	obj, err := toUnstructured(httpRoute)
+	if err != nil {
+		return err
+	}
+
+	existing, err := hm.k8sClient.GetHTTPRoute(ctx, httpRoute.Name)
+	if apierrors.IsNotFound(err) {
+		return hm.k8sClient.CreateHTTPRoute(ctx, obj)
+	}
+	if err != nil {
+		return err
+	}
+	obj.SetResourceVersion(existing.GetResourceVersion())
+	return hm.k8sClient.UpdateHTTPRoute(ctx, obj)
+}
+
+func (hm *HTTPRouteManager) newHTTPRoute(name string, courseName string, routes []address.Address) *HTTPRoute {
+	routeLabels := map[string]string{
+		address.APP_LABEL:    address.APP_LABEL_VALUE,
+		address.COURSE_LABEL: courseName,
+	}
+	if hm.config.Scope == SCOPE_ENVIRONMENT {
+		routeLabels = routes[0].Labels()
+	}
+	routeLabels[address.COMPONENT_LABEL] = COMPONENT_ROUTE
+
+	var hostnames []string
+	if hm.config.MatchHost {
+		hostnames = []string{routes[0].DNSLabel() + "." + hm.config.Hostname}
+	} else if hm.config.Hostname != "" {
+		hostnames = []string{hm.config.Hostname}
+	}
+
+	var rules []HTTPRouteRule
+	for _, route := range routes {
+		rules = append(rules, hm.newRule(route))
+	}
+
+	parentRef := ParentReference{Name: hm.config.GatewayName}
+	if hm.config.GatewayNamespace != "" {
+		parentRef.Namespace = utils.StringPtr(hm.config.GatewayNamespace)
+	}
+
+	return &HTTPRoute{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: k8sclient.HTTPRouteResource.GroupVersion().String(),
+			Kind:       "HTTPRoute",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: routeLabels,
+		},
+		Spec: HTTPRouteSpec{
+			ParentRefs: []ParentReference{parentRef},
+			Hostnames:  hostnames,
+			Rules:      rules,
+		},
+	}
+}
+
+func (hm *HTTPRouteManager) newRule(environment address.Address) HTTPRouteRule {
+	rule := HTTPRouteRule{
+		Matches: []HTTPRouteMatch{
+			{
+				Path: &HTTPPathMatch{
+					Type:  "PathPrefix",
+					Value: "/",
+				},
+			},
+		},
+		BackendRefs: []HTTPBackendRef{
+			{
+				Name: environment.ServiceName(),
+				Port: address.SERVICE_PORT,
+			},
+		},
+		Timeouts: &HTTPRouteTimeouts{
+			Request:        utils.StringPtr(hm.config.Timeout),
+			BackendRequest: utils.StringPtr(hm.config.Timeout),
+		},
+	}
+
+	if !hm.config.MatchHost {
+		// Strip the environment prefix before proxying, as the Ingress
+		// backend does with its rewrite-target annotation.
+		rule.Matches[0].Path.Value = environment.Path()
+		rule.Filters = []HTTPRouteFilter{
+			{
+				Type: "URLRewrite",
+				URLRewrite: &HTTPURLRewrite{
+					Path: &HTTPPathModifier{
+						Type:               "ReplacePrefixMatch",
+						ReplacePrefixMatch: utils.StringPtr("/"),
+					},
+				},
+			},
+		}
+	}
+	return rule
+}
+
+// routesFromHTTPRoute recovers the environments an HTTPRoute exposes, from
+// its labels for environment-scoped routes or its path matches otherwise.
+func routesFromHTTPRoute(obj *unstructured.Unstructured) []address.Address {
+	if environment, err := address.FromLabels(obj.GetLabels()); err == nil {
+		return []address.Address{environment}
+	}
+
+	var httpRoute HTTPRoute
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &httpRoute); err != nil {
+		return nil
+	}
+
+	var routes []address.Address
+	for _, rule := range httpRoute.Spec.Rules {
+		for _, match := range rule.Matches {
+			if match.Path == nil {
+				continue
+			}
+			if environment, err := address.FromPath(match.Path.Value); err == nil {
+				routes = append(routes, environment)
+			}
+		}
+	}
+	return routes
+}
+
+func toUnstructured(httpRoute *HTTPRoute) (*unstructured.Unstructured, error) {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(httpRoute)
+	if err != nil {
+		return nil, err
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
+
+func ignoreNotFound(err error) error {
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,69 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/kubernetes/k8stest"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// TestCourseRuleLimit checks that a course with more students than an
+// HTTPRoute can hold rules for is split across several HTTPRoutes.
+func TestCourseRuleLimit(t *testing.T) {
+	ctx := context.Background()
+	client, _ := k8stest.NewClient()
+	router, err := NewHTTPRouteManager(client, Config{GatewayName: "hive", Scope: SCOPE_COURSE})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var students []address.Address
+	for i := 0; i < MAX_RULES+1; i++ {
+		student := address.New("hw1", "cpsc323", fmt.Sprintf("student%02d", i))
+		students = append(students, student)
+		if err := router.AddRoute(ctx, student); err != nil {
+			t.Fatalf("AddRoute %s: %v", student, err)
+		}
+	}
+	expectHTTPRoutes(t, router, 2, len(students))
+
+	if err := router.RemoveRoute(ctx, students[0]); err != nil {
+		t.Fatalf("RemoveRoute: %v", err)
+	}
+	expectHTTPRoutes(t, router, 1, MAX_RULES)
+
+	other := address.New("lab1", "cpsc201", "carol")
+	if err := router.SyncRoutes(ctx, append(students, other)); err != nil {
+		t.Fatalf("SyncRoutes: %v", err)
+	}
+	expectHTTPRoutes(t, router, 3, len(students)+1)
+}
+
+// expectHTTPRoutes checks the number of HTTPRoutes and of routes they
+// serve, and that none of them holds more than MAX_RULES rules.
+func expectHTTPRoutes(t *testing.T, router *HTTPRouteManager, objects int, routes int) {
+	t.Helper()
+	ctx := context.Background()
+	list, err := router.k8sClient.ListHTTPRoutes(ctx, ROUTE_LABEL_SELECTOR)
+	if err != nil {
+		t.Fatalf("ListHTTPRoutes: %v", err)
+	}
+	if len(list) != objects {
+		t.Fatalf("%d HTTPRoutes, want %d", len(list), objects)
+	}
+	for _, obj := range list {
+		var httpRoute HTTPRoute
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &httpRoute); err != nil {
+			t.Fatal(err)
+		}
+		if len(httpRoute.Spec.Rules) > MAX_RULES {
+			t.Fatalf("HTTPRoute %s has %d rules, more than %d", obj.GetName(), len(httpRoute.Spec.Rules), MAX_RULES)
+		}
+	}
+	if served, err := router.ListRoutes(ctx); err != nil || len(served) != routes {
+		t.Fatalf("ListRoutes = %d routes, %v, want %d", len(served), err, routes)
+	}
+}
@@ -0,0 +1,66 @@
+package gateway
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// The types below mirror the subset of gateway.networking.k8s.io/v1 that the
+// provisioner writes. They are converted to unstructured objects so that the
+// provisioner does not need the Gateway API client libraries.
+
+type HTTPRoute struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              HTTPRouteSpec `json:"spec"`
+}
+
+type HTTPRouteSpec struct {
+	ParentRefs []ParentReference `json:"parentRefs,omitempty"`
+	Hostnames  []string          `json:"hostnames,omitempty"`
+	Rules      []HTTPRouteRule   `json:"rules,omitempty"`
+}
+
+type ParentReference struct {
+	Name      string  `json:"name"`
+	Namespace *string `json:"namespace,omitempty"`
+}
+
+type HTTPRouteRule struct {
+	Matches     []HTTPRouteMatch   `json:"matches,omitempty"`
+	Filters     []HTTPRouteFilter  `json:"filters,omitempty"`
+	BackendRefs []HTTPBackendRef   `json:"backendRefs,omitempty"`
+	Timeouts    *HTTPRouteTimeouts `json:"timeouts,omitempty"`
+}
+
+type HTTPRouteMatch struct {
+	Path *HTTPPathMatch `json:"path,omitempty"`
+}
+
+type HTTPPathMatch struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type HTTPRouteFilter struct {
+	Type       string          `json:"type"`
+	URLRewrite *HTTPURLRewrite `json:"urlRewrite,omitempty"`
+}
+
+type HTTPURLRewrite struct {
+	Path *HTTPPathModifier `json:"path,omitempty"`
+}
+
+type HTTPPathModifier struct {
+	Type               string  `json:"type"`
+	ReplacePrefixMatch *string `json:"replacePrefixMatch,omitempty"`
+}
+
+type HTTPRouteTimeouts struct {
+	Request        *string `json:"request,omitempty"`
+	BackendRequest *string `json:"backendRequest,omitempty"`
+}
+
+type HTTPBackendRef struct {
+	Name string `json:"name"`
+	Port int32  `json:"port"`
+}
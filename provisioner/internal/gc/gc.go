@@ -0,0 +1,55 @@
+// Package gc finds objects labelled as part of an environment that is not
+// desired, such as a Service left behind by a half-finished delete, so
+// that they can be deleted once they have stayed orphaned for a grace
+// period.
+package gc
+
+import (
+	"sort"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/provisioner"
+)
+
+// Kinds of object found besides those of provisioner.ObjectCollector
+const (
+	// A whole environment, on backends that cannot list its objects
+	KIND_ENVIRONMENT = "environment"
+	// A route on the active router, named by its path
+	KIND_ROUTE = "route"
+)
+
+// Orphan is an object whose environment is not desired.
+type Orphan struct {
+	provisioner.Object
+	// When a sweep first found the object orphaned
+	FirstSeen time.Time `json:"firstSeen"`
+	// When a sweep will delete the object, if it is still orphaned
+	DeleteAfter time.Time `json:"deleteAfter"`
+	// Why the last attempt to delete it failed
+	Error string `json:"error,omitempty"`
+}
+
+// Key identifies the object across sweeps.
+func (o Orphan) Key() string {
+	return o.Kind + "/" + o.Name
+}
+
+// Find returns the objects whose environment is not desired, sorted by
+// environment, then kind and name, with the times unset.
+func Find(desired map[address.Address]bool, objects []provisioner.Object) []Orphan {
+	orphans := []Orphan{}
+	for _, object := range objects {
+		if !desired[object.Environment] {
+			orphans = append(orphans, Orphan{Object: object})
+		}
+	}
+	sort.Slice(orphans, func(i, j int) bool {
+		if orphans[i].Environment != orphans[j].Environment {
+			return orphans[i].Environment.String() < orphans[j].Environment.String()
+		}
+		return orphans[i].Key() < orphans[j].Key()
+	})
+	return orphans
+}
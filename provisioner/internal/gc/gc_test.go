@@ -0,0 +1,64 @@
+package gc
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/provisioner"
+)
+
+func TestFind(t *testing.T) {
+	alice := address.New("hw1", "cpsc323", "alice")
+	bob := address.New("hw1", "cpsc323", "bob")
+	carol := address.New("hw2", "cpsc323", "carol")
+
+	aliceDeployment := provisioner.Object{Kind: provisioner.OBJECT_DEPLOYMENT, Name: alice.DeploymentName(), Environment: alice}
+	bobDeployment := provisioner.Object{Kind: provisioner.OBJECT_DEPLOYMENT, Name: bob.DeploymentName(), Environment: bob}
+	bobService := provisioner.Object{Kind: provisioner.OBJECT_SERVICE, Name: bob.ServiceName(), Environment: bob}
+	bobRoute := provisioner.Object{Kind: KIND_ROUTE, Name: bob.Path(), Environment: bob}
+	carolEnvironment := provisioner.Object{Kind: KIND_ENVIRONMENT, Name: carol.DeploymentName(), Environment: carol}
+
+	tests := []struct {
+		name    string
+		desired map[address.Address]bool
+		objects []provisioner.Object
+		want    []Orphan
+	}{
+		{
+			name:    "nothing orphaned",
+			desired: map[address.Address]bool{alice: true, bob: true},
+			objects: []provisioner.Object{aliceDeployment, bobDeployment, bobService},
+			want:    []Orphan{},
+		},
+		{
+			name:    "no objects",
+			desired: map[address.Address]bool{alice: true},
+			want:    []Orphan{},
+		},
+		{
+			name:    "left behind by a delete",
+			desired: map[address.Address]bool{alice: true},
+			objects: []provisioner.Object{aliceDeployment, bobService},
+			want:    []Orphan{{Object: bobService}},
+		},
+		{
+			name:    "nothing desired",
+			objects: []provisioner.Object{aliceDeployment},
+			want:    []Orphan{{Object: aliceDeployment}},
+		},
+		{
+			name:    "sorted by environment, then kind and name",
+			desired: map[address.Address]bool{alice: true},
+			objects: []provisioner.Object{carolEnvironment, bobService, aliceDeployment, bobRoute, bobDeployment},
+			want:    []Orphan{{Object: bobDeployment}, {Object: bobRoute}, {Object: bobService}, {Object: carolEnvironment}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Find(tc.desired, tc.objects); !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Find = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
@@ -1,137 +1,288 @@
 package ingress
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"strings"
 
+	"github.com/BradleyLewis08/HiVE/internal/address"
 	k8sclient "github.com/BradleyLewis08/HiVE/internal/kubernetes"
+	"github.com/BradleyLewis08/HiVE/internal/routing"
+	"github.com/BradleyLewis08/HiVE/internal/tracing"
 	"github.com/BradleyLewis08/HiVE/internal/utils"
 	networkingv1 "k8s.io/api/networking/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
 )
 
 const (
-    SERVICE_PORT = 80
+	SERVICE_PORT = 80
 )
 
 type IngressManager struct {
-    k8sClient *k8sclient.Client
+	k8sClient *k8sclient.Client
 }
 
 type IngressRule struct {
-	Path string
+	Path        string
 	ServiceName string
 	ServicePort int32
 }
 
+var _ routing.Router = (*IngressManager)(nil)
+var _ routing.Renderer = (*IngressManager)(nil)
+var _ routing.Observer = (*IngressManager)(nil)
+
 func NewIngressManager(k8sClient *k8sclient.Client) *IngressManager {
-    return &IngressManager{k8sClient: k8sClient}
+	return &IngressManager{k8sClient: k8sClient}
+}
+
+func (im *IngressManager) Provision(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "IngressManager.Provision")
+	defer span.End()
+
+	ingress := im.k8sClient.GetIngressController(ctx)
+	if ingress != nil {
+		slog.InfoContext(ctx, "Ingress controller already exists")
+		return nil
+	}
+
+	controller := NewEnvironmentIngressController(defaultRules())
+	err := im.k8sClient.DeployIngressController(ctx, controller)
+	if err != nil {
+		return fmt.Errorf("failed to deploy ingress controller: %w", err)
+	}
+
+	slog.InfoContext(ctx, "Ingress controller deployed")
+	return nil
+}
+
+func (im *IngressManager) AddRoute(ctx context.Context, environment address.Address) error {
+	ctx, span := tracing.Start(ctx, "IngressManager.AddRoute", tracing.Environment(environment))
+	defer span.End()
+
+	ingress := im.k8sClient.GetIngressController(ctx)
+	if ingress == nil {
+		return fmt.Errorf("ingress controller not found")
+	}
+
+	path := environment.PathPattern()
+	for _, existing := range ingress.Spec.Rules[0].HTTP.Paths {
+		if existing.Path == path {
+			return nil
+		}
+	}
+
+	ingress.Spec.Rules[0].HTTP.Paths = append(
+		ingress.Spec.Rules[0].HTTP.Paths,
+		newEnvironmentPath(environment),
+	)
+	ingress.Annotations["nginx.ingress.kubernetes.io/rewrite-target"] = "/$2"
+	ingress.Annotations["nginx.ingress.kubernetes.io/use-regex"] = "true"
+
+	return im.k8sClient.UpdateIngressController(ctx, ingress)
+}
+
+func (im *IngressManager) RemoveRoute(ctx context.Context, environment address.Address) error {
+	ctx, span := tracing.Start(ctx, "IngressManager.RemoveRoute", tracing.Environment(environment))
+	defer span.End()
+
+	ingress := im.k8sClient.GetIngressController(ctx)
+	if ingress == nil {
+		return fmt.Errorf("ingress controller not found")
+	}
+
+	path := environment.PathPattern()
+	paths := ingress.Spec.Rules[0].HTTP.Paths[:0]
+	for _, existing := range ingress.Spec.Rules[0].HTTP.Paths {
+		if existing.Path != path {
+			paths = append(paths, existing)
+		}
+	}
+	ingress.Spec.Rules[0].HTTP.Paths = paths
+
+	return im.k8sClient.UpdateIngressController(ctx, ingress)
+}
+
+func (im *IngressManager) ListRoutes(ctx context.Context) ([]address.Address, error) {
+	ctx, span := tracing.Start(ctx, "IngressManager.ListRoutes")
+	defer span.End()
+
+	ingress := im.k8sClient.GetIngressController(ctx)
+	if ingress == nil {
+		return nil, fmt.Errorf("ingress controller not found")
+	}
+
+	return routesFromIngress(ingress), nil
 }
 
-func (im *IngressManager) ProvisionIngressController() {
-    ingress := im.k8sClient.GetIngressController()
-    if(ingress != nil) {
-        log.Println("Ingress controller already exists")
-        return
-    }
-    
-    rules := []IngressRule {
-        {
-            Path: "/ping",
-            ServiceName: "ping-service",
-            ServicePort: SERVICE_PORT,   
-        },
-    }
-
-    controller := NewEnvironmentIngressController(rules)
-    err := im.k8sClient.DeployIngressController(controller)
-    if err != nil {
-        log.Fatalf("Failed to deploy ingress controller: %v", err)
-    }
-
-    fmt.Printf("Ingress controller deployed")
+// WatchRoutes watches the Ingress, calling changed with its environment
+// paths whenever it changes. An Ingress that has been deleted serves none.
+func (im *IngressManager) WatchRoutes(ctx context.Context, changed func(routes []address.Address)) error {
+	factory := im.k8sClient.InformerFactory(0, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", k8sclient.INGRESS_NAME).String(),
+	})
+	informer := factory.Networking().V1().Ingresses().Informer()
+
+	notify := func() {
+		routes := []address.Address{}
+		for _, obj := range informer.GetStore().List() {
+			if ingress, ok := obj.(*networkingv1.Ingress); ok {
+				routes = append(routes, routesFromIngress(ingress)...)
+			}
+		}
+		changed(routes)
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { notify() },
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) { notify() },
+		DeleteFunc: func(obj interface{}) { notify() },
+	})
+
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("ingress watch did not sync: %w", ctx.Err())
+	}
+	// Also covers an Ingress that does not exist, which no handler reports
+	notify()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func routesFromIngress(ingress *networkingv1.Ingress) []address.Address {
+	routes := []address.Address{}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if environment, err := address.FromPath(path.Path); err == nil {
+				routes = append(routes, environment)
+			}
+		}
+	}
+	address.Sort(routes)
+	return routes
 }
 
-func (im *IngressManager) AddRouteToIngress(assignmentName string, courseName string, netID string) error {
-    ingress := im.k8sClient.GetIngressController()
-    if ingress == nil {
-        return fmt.Errorf("ingress controller not found")
-    }
-
-    serviceName := utils.ConstructLoadBalancerServiceName(assignmentName, courseName, netID)
-    path := fmt.Sprintf("/environment/%s/%s/%s", courseName, assignmentName, netID)
-    pathType := networkingv1.PathTypePrefix
-
-    newPath := networkingv1.HTTPIngressPath{
-        Path: path,
-        PathType: &pathType,
-        Backend: networkingv1.IngressBackend{
-            Service: &networkingv1.IngressServiceBackend{
-                Name: serviceName, 
-                Port: networkingv1.ServiceBackendPort{
-                    Number: SERVICE_PORT,
-                },
-            },
-        },
-    }
-
-    ingress.Spec.Rules[0].HTTP.Paths = append(ingress.Spec.Rules[0].HTTP.Paths, newPath)
-    ingress.Annotations["nginx.ingress.kubernetes.io/rewrite-target"] = "/$2"
-
-    err := im.k8sClient.UpdateIngressController(ingress)
-
-    if err != nil {
-        log.Fatalf("Failed to update ingress controller: %v", err)
-    }
-
-    return nil
+// SyncRoutes rewrites every environment path on the Ingress, leaving any
+// non-environment paths (such as /ping) untouched.
+func (im *IngressManager) SyncRoutes(ctx context.Context, routes []address.Address) error {
+	ctx, span := tracing.Start(ctx, "IngressManager.SyncRoutes")
+	defer span.End()
+
+	ingress := im.k8sClient.GetIngressController(ctx)
+	if ingress == nil {
+		return fmt.Errorf("ingress controller not found")
+	}
+
+	var paths []networkingv1.HTTPIngressPath
+	for _, existing := range ingress.Spec.Rules[0].HTTP.Paths {
+		if !strings.HasPrefix(existing.Path, address.PATH_PREFIX) {
+			paths = append(paths, existing)
+		}
+	}
+
+	sorted := append([]address.Address(nil), routes...)
+	address.Sort(sorted)
+	for _, environment := range sorted {
+		paths = append(paths, newEnvironmentPath(environment))
+	}
+	ingress.Spec.Rules[0].HTTP.Paths = paths
+
+	return im.k8sClient.UpdateIngressController(ctx, ingress)
+}
+
+// RenderRoutes returns the Ingress as Provision creates it, with a path for
+// each of routes.
+func (im *IngressManager) RenderRoutes(routes []address.Address) ([]runtime.Object, error) {
+	ingress := NewEnvironmentIngressController(defaultRules())
+
+	sorted := append([]address.Address(nil), routes...)
+	address.Sort(sorted)
+	for _, environment := range sorted {
+		ingress.Spec.Rules[0].HTTP.Paths = append(ingress.Spec.Rules[0].HTTP.Paths, newEnvironmentPath(environment))
+	}
+	return []runtime.Object{ingress}, nil
+}
+
+func defaultRules() []IngressRule {
+	return []IngressRule{
+		{
+			Path:        "/ping",
+			ServiceName: "ping-service",
+			ServicePort: SERVICE_PORT,
+		},
+	}
+}
+
+// Environment paths are regular expressions so that the rewrite-target
+// annotation can strip the environment prefix.
+func newEnvironmentPath(environment address.Address) networkingv1.HTTPIngressPath {
+	pathType := networkingv1.PathTypeImplementationSpecific
+	return networkingv1.HTTPIngressPath{
+		Path:     environment.PathPattern(),
+		PathType: &pathType,
+		Backend: networkingv1.IngressBackend{
+			Service: &networkingv1.IngressServiceBackend{
+				Name: environment.ServiceName(),
+				Port: networkingv1.ServiceBackendPort{
+					Number: address.SERVICE_PORT,
+				},
+			},
+		},
+	}
 }
 
 // NewEnvironmentIngress creates an Ingress resource for routing to student environments
 func NewEnvironmentIngressController(rules []IngressRule) *networkingv1.Ingress {
-    pathType := networkingv1.PathTypePrefix
-    
-    var ingressPaths []networkingv1.HTTPIngressPath
-    for _, rule := range rules {
-        ingressPaths = append(ingressPaths, networkingv1.HTTPIngressPath{
-            Path: rule.Path,
-            PathType: &pathType,
-            Backend: networkingv1.IngressBackend{
-                Service: &networkingv1.IngressServiceBackend{
-                    Name: rule.ServiceName,
-                    Port: networkingv1.ServiceBackendPort{
-                        Number: rule.ServicePort,
-                    },
-                },
-            },
-        })
-    }
-
-    return &networkingv1.Ingress{
-        ObjectMeta: metav1.ObjectMeta{
-            Name: "hive-environments",
-            Annotations: map[string]string{
-                "nginx.ingress.kubernetes.io/rewrite-target": "/$2",
-                "nginx.ingress.kubernetes.io/proxy-body-size": "10m",
-                "nginx.ingress.kubernetes.io/proxy-buffering": "off",
-                "nginx.ingress.kubernetes.io/proxy-http-version": "1.1",
-                "nginx.ingress.kubernetes.io/proxy-read-timeout": "3600",
-                "nginx.ingress.kubernetes.io/proxy-send-timeout": "3600",
-                "nginx.ingress.kubernetes.io/websocket-services": "true",
-            },
-        },
-        Spec: networkingv1.IngressSpec{
-            IngressClassName: utils.StringPtr("nginx"),
-            Rules: []networkingv1.IngressRule{
+	pathType := networkingv1.PathTypePrefix
+
+	var ingressPaths []networkingv1.HTTPIngressPath
+	for _, rule := range rules {
+		ingressPaths = append(ingressPaths, networkingv1.HTTPIngressPath{
+			Path:     rule.Path,
+			PathType: &pathType,
+			Backend: networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: rule.ServiceName,
+					Port: networkingv1.ServiceBackendPort{
+						Number: rule.ServicePort,
+					},
+				},
+			},
+		})
+	}
+
+	return &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: k8sclient.INGRESS_NAME,
+			Annotations: map[string]string{
+				"nginx.ingress.kubernetes.io/rewrite-target":     "/$2",
+				"nginx.ingress.kubernetes.io/use-regex":          "true",
+				"nginx.ingress.kubernetes.io/proxy-body-size":    "10m",
+				"nginx.ingress.kubernetes.io/proxy-buffering":    "off",
+				"nginx.ingress.kubernetes.io/proxy-http-version": "1.1",
+				"nginx.ingress.kubernetes.io/proxy-read-timeout": "3600",
+				"nginx.ingress.kubernetes.io/proxy-send-timeout": "3600",
+				"nginx.ingress.kubernetes.io/websocket-services": "true",
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: utils.StringPtr("nginx"),
+			Rules: []networkingv1.IngressRule{
 				{
 					IngressRuleValue: networkingv1.IngressRuleValue{
-						HTTP: &networkingv1.HTTPIngressRuleValue {
+						HTTP: &networkingv1.HTTPIngressRuleValue{
 							Paths: ingressPaths,
 						},
 					},
 				},
-            },
-        },
-    }
+			},
+		},
+	}
 }
-
@@ -2,91 +2,276 @@ package k8sclient
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
-	"path/filepath"
+	"io"
+	"log/slog"
+	"os"
 	"time"
 
+	"github.com/BradleyLewis08/HiVE/internal/tracing"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
-	"k8s.io/client-go/util/homedir"
+	"k8s.io/client-go/tools/remotecommand"
+	watchtools "k8s.io/client-go/tools/watch"
 
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
 )
 
+var HTTPRouteResource = schema.GroupVersionResource{
+	Group:    "gateway.networking.k8s.io",
+	Version:  "v1",
+	Resource: "httproutes",
+}
+
+// Field manager recorded for server-side apply requests
+const FIELD_MANAGER = "hive-provisioner"
+
+// The Ingress holding a path for every environment, with the ingress router
+const INGRESS_NAME = "hive-environments"
+
+const (
+	DEFAULT_REQUEST_TIMEOUT       = 30 * time.Second
+	DEFAULT_LOAD_BALANCER_TIMEOUT = 30 * time.Second
+)
+
+// Timeouts are the deadlines the client applies on top of its caller's
+// context. A zero value leaves that operation bounded by the caller alone.
+type Timeouts struct {
+	// Request bounds each API request. Log streams and exec sessions are
+	// never subject to it.
+	Request time.Duration
+	// LoadBalancer bounds the wait for a LoadBalancer Service to be
+	// assigned an external address
+	LoadBalancer time.Duration
+}
+
+var DEFAULT_TIMEOUTS = Timeouts{
+	Request:      DEFAULT_REQUEST_TIMEOUT,
+	LoadBalancer: DEFAULT_LOAD_BALANCER_TIMEOUT,
+}
+
 type Client struct {
-	clientset *kubernetes.Clientset
+	clientset kubernetes.Interface
+	dynamic   dynamic.Interface
+	config    *rest.Config
+	mapper    meta.RESTMapper
+	timeouts  Timeouts
+	// Every call is made in this namespace
+	namespace string
+}
+
+// NewClient wraps existing clients, such as the fakes from
+// k8s.io/client-go/kubernetes/fake and k8s.io/client-go/dynamic/fake.
+// config is only needed to exec into pods and may be nil otherwise.
+func NewClient(clientset kubernetes.Interface, dynamicClient dynamic.Interface, config *rest.Config) *Client {
+	mapper := restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(clientset.Discovery()))
+	return &Client{clientset: clientset, dynamic: dynamicClient, config: config, mapper: mapper, timeouts: DEFAULT_TIMEOUTS, namespace: NAMESPACE}
+}
+
+func (c *Client) SetTimeouts(timeouts Timeouts) {
+	c.timeouts = timeouts
 }
 
-func GetKubernetesClient() (*Client, error) {
-	var kubeconfig string
-	if home := homedir.HomeDir(); home != "" {
-		kubeconfig = filepath.Join(home, ".kube", "config")
-	} else {
-		kubeconfig = ""
+// begin starts the span of a client call and bounds it by the request
+// timeout. done ends both.
+func (c *Client) begin(ctx context.Context, operation string) (context.Context, func()) {
+	ctx, span := tracing.Start(ctx, "Client."+operation)
+	ctx, cancel := c.withTimeout(ctx)
+	return ctx, func() {
+		cancel()
+		span.End()
 	}
+}
 
-	clientConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+// withTimeout bounds a single API request by the request timeout.
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withDeadline(ctx, c.timeouts.Request)
+}
+
+func withDeadline(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// ClientConfig selects the cluster to connect to. The zero value uses the
+// in-cluster ServiceAccount when running in a pod, and otherwise $KUBECONFIG
+// or ~/.kube/config with its current context.
+type ClientConfig struct {
+	// Kubeconfig is an explicit kubeconfig path, overriding $KUBECONFIG
+	Kubeconfig string
+	// Context overrides the kubeconfig's current context
+	Context string
+	// QPS and Burst tune client-side rate limiting; client-go defaults
+	// (5 and 10) apply when unset
+	QPS   float32
+	Burst int
+	// Timeouts default to DEFAULT_TIMEOUTS when unset
+	Timeouts *Timeouts
+}
+
+// LoadRESTConfig resolves the REST config described by config.
+func LoadRESTConfig(config ClientConfig) (*rest.Config, error) {
+	var restConfig *rest.Config
+	var err error
+
+	// A kubeconfig always wins when one is asked for explicitly
+	explicit := config.Kubeconfig != "" || config.Context != "" || os.Getenv(clientcmd.RecommendedConfigPathEnvVar) != ""
+	if !explicit {
+		restConfig, err = rest.InClusterConfig()
+		if err != nil && err != rest.ErrNotInCluster {
+			return nil, fmt.Errorf("failed to load in-cluster config: %w", err)
+		}
+	}
+
+	if restConfig == nil {
+		loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+		loadingRules.ExplicitPath = config.Kubeconfig
+		overrides := &clientcmd.ConfigOverrides{CurrentContext: config.Context}
+		restConfig, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+		}
+	}
+
+	if config.QPS > 0 {
+		restConfig.QPS = config.QPS
+	}
+	if config.Burst > 0 {
+		restConfig.Burst = config.Burst
+	}
+	return restConfig, nil
+}
+
+func GetKubernetesClient(config ClientConfig) (*Client, error) {
+	clientConfig, err := LoadRESTConfig(config)
 
 	if err != nil {
-		panic(err);
+		return nil, err
 	}
 
+	// Record the latency and result of every API request
+	clientConfig.Wrap(instrument)
+	clientConfig.Wrap(tracing.Transport)
 	clientset, err := kubernetes.NewForConfig(clientConfig)
 
 	if err != nil {
-		panic(err);
+		return nil, fmt.Errorf("failed to create kubernetes client: %w", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(clientConfig)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
 	}
 
-	return &Client{clientset: clientset}, nil
+	client := NewClient(clientset, dynamicClient, clientConfig)
+	if config.Timeouts != nil {
+		client.SetTimeouts(*config.Timeouts)
+	}
+	return client, nil
 }
 
-func (c *Client) DeployService(service *apiv1.Service) error {
-	_, err := c.clientset.CoreV1().Services(apiv1.NamespaceDefault).Create(context.TODO(), service, metav1.CreateOptions{})
+func (c *Client) DeployService(ctx context.Context, service *apiv1.Service) error {
+	ctx, done := c.begin(ctx, "DeployService")
+	defer done()
+
+	_, err := c.clientset.CoreV1().Services(c.namespace).Create(ctx, service, metav1.CreateOptions{})
 	return err
 }
 
-func (c *Client) DeployDeployment(deployment *appsv1.Deployment) error {
-	_, err := c.clientset.AppsV1().Deployments(apiv1.NamespaceDefault).Create(context.TODO(), deployment, metav1.CreateOptions{})
-	return err
+// DeployDeployment creates the Deployment and returns it as created, with
+// its UID.
+func (c *Client) DeployDeployment(ctx context.Context, deployment *appsv1.Deployment) (*appsv1.Deployment, error) {
+	ctx, done := c.begin(ctx, "DeployDeployment")
+	defer done()
+
+	return c.clientset.AppsV1().Deployments(c.namespace).Create(ctx, deployment, metav1.CreateOptions{})
 }
 
-func (c* Client) CreateConfigMap(configMap *apiv1.ConfigMap) error {
-	_, err := c.clientset.CoreV1().ConfigMaps(apiv1.NamespaceDefault).Create(context.TODO(), configMap, metav1.CreateOptions{})
+func (c* Client) CreateConfigMap(ctx context.Context, configMap *apiv1.ConfigMap) error {
+	ctx, done := c.begin(ctx, "CreateConfigMap")
+	defer done()
+
+	_, err := c.clientset.CoreV1().ConfigMaps(c.namespace).Create(ctx, configMap, metav1.CreateOptions{})
 	return err
 }
 
-func (c* Client) UpdateConfigMap(configMap *apiv1.ConfigMap) error {
-	_, err := c.clientset.CoreV1().ConfigMaps(apiv1.NamespaceDefault).Update(context.TODO(), configMap, metav1.UpdateOptions{})
+func (c* Client) UpdateConfigMap(ctx context.Context, configMap *apiv1.ConfigMap) error {
+	ctx, done := c.begin(ctx, "UpdateConfigMap")
+	defer done()
+
+	_, err := c.clientset.CoreV1().ConfigMaps(c.namespace).Update(ctx, configMap, metav1.UpdateOptions{})
 	return err
 }
 
-func (c* Client) GetServiceIP(serviceName string) (string, error) {
-	service, err := c.clientset.CoreV1().Services((apiv1.NamespaceDefault)).Get(context.TODO(), serviceName, metav1.GetOptions{})
+// GetServiceIP returns the address of a Service. For LoadBalancer Services
+// it waits up to the load balancer timeout for an external address to be
+// assigned, falling back to the cluster IP.
+func (c* Client) GetServiceIP(ctx context.Context, serviceName string) (string, error) {
+	ctx, span := tracing.Start(ctx, "Client.GetServiceIP")
+	defer span.End()
+
+	getService := func(ctx context.Context) (*apiv1.Service, error) {
+		ctx, cancel := c.withTimeout(ctx)
+		defer cancel()
+		return c.clientset.CoreV1().Services(c.namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	}
+
+	service, err := getService(ctx)
 	if err != nil {
 		return "", err
 	}
 
 	if service.Spec.Type == apiv1.ServiceTypeLoadBalancer {
-		// Wait for LoadBalncer to be assigned IP
-		for i := 0; i < 30; i++ {
-			service, err = c.clientset.CoreV1().Services(apiv1.NamespaceDefault).Get(context.TODO(), serviceName, metav1.GetOptions{})
+		waitCtx, cancel := withDeadline(ctx, c.timeouts.LoadBalancer)
+		defer cancel()
+
+		var external string
+		err = wait.PollUntilContextCancel(waitCtx, time.Second, true, func(ctx context.Context) (bool, error) {
+			service, err := getService(ctx)
 			if err != nil {
-				return "", err
+				return false, err
 			}
-
-			if len(service.Status.LoadBalancer.Ingress) > 0 {
-				if service.Status.LoadBalancer.Ingress[0].IP != "" {
-					return service.Status.LoadBalancer.Ingress[0].IP, nil
+			for _, ingress := range service.Status.LoadBalancer.Ingress {
+				if ingress.IP != "" {
+					external = ingress.IP
+					return true, nil
 				}
-
-				if service.Status.LoadBalancer.Ingress[0].Hostname != "" {
-					return service.Status.LoadBalancer.Ingress[0].Hostname, nil
+				if ingress.Hostname != "" {
+					external = ingress.Hostname
+					return true, nil
 				}
 			}
-			time.Sleep(time.Second);
+			return false, nil
+		})
+		if err == nil {
+			return external, nil
+		}
+		// Only the wait running out falls back to the cluster IP
+		if ctx.Err() != nil || !wait.Interrupted(err) {
+			return "", err
 		}
 	}
 
@@ -97,54 +282,321 @@ func (c* Client) GetServiceIP(serviceName string) (string, error) {
 	return "", fmt.Errorf("service IP not found")
 }
 
-func (c* Client) DeleteDeployment(deploymentName string) error {
-	err := c.clientset.AppsV1().Deployments(apiv1.NamespaceDefault).Delete(context.TODO(), deploymentName, metav1.DeleteOptions{})
+// SetPodTemplateAnnotation sets an annotation on a Deployment's pod template,
+// which triggers a rolling update when the value changes.
+func (c* Client) SetPodTemplateAnnotation(ctx context.Context, deploymentName string, key string, value string) error {
+	ctx, done := c.begin(ctx, "SetPodTemplateAnnotation")
+	defer done()
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{key: value},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = c.clientset.AppsV1().Deployments(c.namespace).Patch(ctx, deploymentName, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// DeleteDeployment deletes the Deployment, and in the background its pods
+// and any objects it owns.
+func (c* Client) DeleteDeployment(ctx context.Context, deploymentName string) error {
+	ctx, done := c.begin(ctx, "DeleteDeployment")
+	defer done()
+
+	propagation := metav1.DeletePropagationBackground
+	err := c.clientset.AppsV1().Deployments(c.namespace).Delete(ctx, deploymentName, metav1.DeleteOptions{PropagationPolicy: &propagation})
+	return err
+}
+
+func (c* Client) DeleteService(ctx context.Context, serviceName string) error {
+	ctx, done := c.begin(ctx, "DeleteService")
+	defer done()
+
+	err := c.clientset.CoreV1().Services(c.namespace).Delete(ctx, serviceName, metav1.DeleteOptions{})
+	return err
+}
+
+func (c* Client) DeleteConfigMap(ctx context.Context, configMapName string) error {
+	ctx, done := c.begin(ctx, "DeleteConfigMap")
+	defer done()
+
+	err := c.clientset.CoreV1().ConfigMaps(c.namespace).Delete(ctx, configMapName, metav1.DeleteOptions{})
+	return err
+}
+
+func (c* Client) ListDeployments(ctx context.Context, labelSelector string) ([]appsv1.Deployment, error) {
+	ctx, done := c.begin(ctx, "ListDeployments")
+	defer done()
+
+	list, err := c.clientset.AppsV1().Deployments(c.namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (c* Client) ListServices(ctx context.Context, labelSelector string) ([]apiv1.Service, error) {
+	ctx, done := c.begin(ctx, "ListServices")
+	defer done()
+
+	list, err := c.clientset.CoreV1().Services(c.namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (c* Client) GetDeployment(ctx context.Context, deploymentName string) (*appsv1.Deployment, error) {
+	ctx, done := c.begin(ctx, "GetDeployment")
+	defer done()
+
+	return c.clientset.AppsV1().Deployments(c.namespace).Get(ctx, deploymentName, metav1.GetOptions{})
+}
+
+func (c* Client) UpdateDeployment(ctx context.Context, deployment *appsv1.Deployment) error {
+	ctx, done := c.begin(ctx, "UpdateDeployment")
+	defer done()
+
+	_, err := c.clientset.AppsV1().Deployments(c.namespace).Update(ctx, deployment, metav1.UpdateOptions{})
 	return err
 }
 
-func (c* Client) DeleteService(serviceName string) error {
-	err := c.clientset.CoreV1().Services(apiv1.NamespaceDefault).Delete(context.TODO(), serviceName, metav1.DeleteOptions{})
+// ApplyPodDisruptionBudget creates the budget, or replaces the spec of an existing one.
+func (c* Client) ApplyPodDisruptionBudget(ctx context.Context, pdb *policyv1.PodDisruptionBudget) error {
+	ctx, done := c.begin(ctx, "ApplyPodDisruptionBudget")
+	defer done()
+
+	existing, err := c.clientset.PolicyV1().PodDisruptionBudgets(c.namespace).Get(ctx, pdb.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = c.clientset.PolicyV1().PodDisruptionBudgets(c.namespace).Create(ctx, pdb, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	existing.Spec = pdb.Spec
+	_, err = c.clientset.PolicyV1().PodDisruptionBudgets(c.namespace).Update(ctx, existing, metav1.UpdateOptions{})
 	return err
 }
 
-func (c* Client) DeleteConfigMap(configMapName string) error {
-	err := c.clientset.CoreV1().ConfigMaps(apiv1.NamespaceDefault).Delete(context.TODO(), configMapName, metav1.DeleteOptions{})
+func (c* Client) DeletePodDisruptionBudget(ctx context.Context, name string) error {
+	ctx, done := c.begin(ctx, "DeletePodDisruptionBudget")
+	defer done()
+
+	return c.clientset.PolicyV1().PodDisruptionBudgets(c.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+}
+
+func (c* Client) ListPods(ctx context.Context, labelSelector string) ([]apiv1.Pod, error) {
+	ctx, done := c.begin(ctx, "ListPods")
+	defer done()
+
+	list, err := c.clientset.CoreV1().Pods(c.namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (c* Client) DeletePods(ctx context.Context, labelSelector string) error {
+	ctx, done := c.begin(ctx, "DeletePods")
+	defer done()
+
+	return c.clientset.CoreV1().Pods(c.namespace).DeleteCollection(ctx, metav1.DeleteOptions{}, metav1.ListOptions{LabelSelector: labelSelector})
+}
+
+// WatchPods calls condition with each pod matching labelSelector, then
+// again whenever one changes, until condition returns true or an error. If
+// ctx is done first its error is returned.
+func (c* Client) WatchPods(ctx context.Context, labelSelector string, condition func(*apiv1.Pod) (bool, error)) error {
+	ctx, span := tracing.Start(ctx, "Client.WatchPods")
+	defer span.End()
+
+	pods := c.clientset.CoreV1().Pods(c.namespace)
+	listWatch := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = labelSelector
+			ctx, cancel := c.withTimeout(ctx)
+			defer cancel()
+			return pods.List(ctx, options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = labelSelector
+			return pods.Watch(ctx, options)
+		},
+	}
+
+	_, err := watchtools.UntilWithSync(ctx, listWatch, &apiv1.Pod{}, nil, func(event watch.Event) (bool, error) {
+		pod, ok := event.Object.(*apiv1.Pod)
+		if !ok || event.Type == watch.Deleted {
+			return false, nil
+		}
+		return condition(pod)
+	})
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
 	return err
 }
 
-func (c* Client) DeploymentExists(deploymentName string) bool {
-	_, err := c.clientset.AppsV1().Deployments(apiv1.NamespaceDefault).Get(context.TODO(), deploymentName, metav1.GetOptions{})
+// InformerFactory returns a factory for informers on the objects in the
+// client's namespace that match the label and field selectors of options. Informers
+// list and then watch, so they are not bounded by the request timeout.
+func (c* Client) InformerFactory(resync time.Duration, options metav1.ListOptions) informers.SharedInformerFactory {
+	return informers.NewSharedInformerFactoryWithOptions(
+		c.clientset,
+		resync,
+		informers.WithNamespace(c.namespace),
+		informers.WithTweakListOptions(func(list *metav1.ListOptions) {
+			list.LabelSelector = options.LabelSelector
+			list.FieldSelector = options.FieldSelector
+		}),
+	)
+}
+
+func (c* Client) StreamPodLogs(ctx context.Context, podName string, options *apiv1.PodLogOptions) (io.ReadCloser, error) {
+	ctx, span := tracing.Start(ctx, "Client.StreamPodLogs")
+	defer span.End()
+
+	return c.clientset.CoreV1().Pods(c.namespace).GetLogs(podName, options).Stream(ctx)
+}
+
+// ExecInPod runs command in a container without a TTY, copying its output to
+// stdout and stderr.
+func (c* Client) ExecInPod(ctx context.Context, podName string, container string, command []string, stdout io.Writer, stderr io.Writer) error {
+	ctx, span := tracing.Start(ctx, "Client.ExecInPod")
+	defer span.End()
+
+	if c.config == nil {
+		return fmt.Errorf("exec requires a connection to a cluster")
+	}
+	request := c.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Namespace(c.namespace).
+		Name(podName).
+		SubResource("exec").
+		VersionedParams(&apiv1.PodExecOptions{
+			Container: container,
+			Command:   command,
+			Stdout:    true,
+			Stderr:    true,
+		}, scheme.ParameterCodec)
+
+	executor, err := remotecommand.NewSPDYExecutor(c.config, "POST", request.URL())
+	if err != nil {
+		return err
+	}
+	return executor.StreamWithContext(ctx, remotecommand.StreamOptions{Stdout: stdout, Stderr: stderr})
+}
+
+func (c* Client) DeploymentExists(ctx context.Context, deploymentName string) bool {
+	ctx, done := c.begin(ctx, "DeploymentExists")
+	defer done()
+
+	_, err := c.clientset.AppsV1().Deployments(c.namespace).Get(ctx, deploymentName, metav1.GetOptions{})
 	return err == nil
 }
 
-func (c* Client) DeployIngressController(ingress *networkingv1.Ingress) error {
-	_, err := c.clientset.NetworkingV1().Ingresses(apiv1.NamespaceDefault).Create(context.TODO(), ingress, metav1.CreateOptions{})
+func (c* Client) DeployIngressController(ctx context.Context, ingress *networkingv1.Ingress) error {
+	ctx, done := c.begin(ctx, "DeployIngressController")
+	defer done()
+
+	_, err := c.clientset.NetworkingV1().Ingresses(c.namespace).Create(ctx, ingress, metav1.CreateOptions{})
 	return err
 }
 
-func (c* Client) GetIngressController() *networkingv1.Ingress {
-	ingress, err := c.clientset.NetworkingV1().Ingresses("default").Get(
-		context.TODO(),
-		"hive-environments",
+func (c* Client) GetIngressController(ctx context.Context) *networkingv1.Ingress {
+	ctx, done := c.begin(ctx, "GetIngressController")
+	defer done()
+
+	ingress, err := c.clientset.NetworkingV1().Ingresses(c.namespace).Get(
+		ctx,
+		INGRESS_NAME,
 		metav1.GetOptions{},
 	)
 
 	if err != nil {
-		fmt.Println("Failed to get ingress controller")
+		slog.InfoContext(ctx, "Failed to get ingress controller", "error", err)
 		return nil
 	}
 	return ingress
 }
 
-func(c* Client) UpdateIngressController(newIngress *networkingv1.Ingress) error {
-	_, err := c.clientset.NetworkingV1().Ingresses(apiv1.NamespaceDefault).Update(context.TODO(), newIngress, metav1.UpdateOptions{})
+func(c* Client) UpdateIngressController(ctx context.Context, newIngress *networkingv1.Ingress) error {
+	ctx, done := c.begin(ctx, "UpdateIngressController")
+	defer done()
+
+	_, err := c.clientset.NetworkingV1().Ingresses(c.namespace).Update(ctx, newIngress, metav1.UpdateOptions{})
 	return err
 }
 
+func (c* Client) GetHTTPRoute(ctx context.Context, name string) (*unstructured.Unstructured, error) {
+	ctx, done := c.begin(ctx, "GetHTTPRoute")
+	defer done()
 
+	return c.dynamic.Resource(HTTPRouteResource).Namespace(c.namespace).Get(ctx, name, metav1.GetOptions{})
+}
 
+func (c* Client) ListHTTPRoutes(ctx context.Context, labelSelector string) ([]unstructured.Unstructured, error) {
+	ctx, done := c.begin(ctx, "ListHTTPRoutes")
+	defer done()
 
+	list, err := c.dynamic.Resource(HTTPRouteResource).Namespace(c.namespace).List(ctx, metav1.ListOptions{LabelSelector: labelSelector})
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+func (c* Client) CreateHTTPRoute(ctx context.Context, route *unstructured.Unstructured) error {
+	ctx, done := c.begin(ctx, "CreateHTTPRoute")
+	defer done()
+
+	_, err := c.dynamic.Resource(HTTPRouteResource).Namespace(c.namespace).Create(ctx, route, metav1.CreateOptions{})
+	return err
+}
+
+func (c* Client) UpdateHTTPRoute(ctx context.Context, route *unstructured.Unstructured) error {
+	ctx, done := c.begin(ctx, "UpdateHTTPRoute")
+	defer done()
+
+	_, err := c.dynamic.Resource(HTTPRouteResource).Namespace(c.namespace).Update(ctx, route, metav1.UpdateOptions{})
+	return err
+}
 
+func (c* Client) DeleteHTTPRoute(ctx context.Context, name string) error {
+	ctx, done := c.begin(ctx, "DeleteHTTPRoute")
+	defer done()
+
+	return c.dynamic.Resource(HTTPRouteResource).Namespace(c.namespace).Delete(ctx, name, metav1.DeleteOptions{})
+}
 
+// DryRunApply submits obj as a server-side apply with dry-run, so it passes
+// validation and admission without being persisted. The object as the API
+// server would store it is returned.
+func (c* Client) DryRunApply(ctx context.Context, obj *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	ctx, done := c.begin(ctx, "DryRunApply")
+	defer done()
 
+	gvk := obj.GroupVersionKind()
+	mapping, err := c.mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, err
+	}
 
+	var resource dynamic.ResourceInterface = c.dynamic.Resource(mapping.Resource)
+	if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+		resource = c.dynamic.Resource(mapping.Resource).Namespace(c.namespace)
+	}
+	return resource.Apply(ctx, obj.GetName(), obj, metav1.ApplyOptions{
+		FieldManager: FIELD_MANAGER,
+		Force: true,
+		DryRun: []string{metav1.DryRunAll},
+	})
+}
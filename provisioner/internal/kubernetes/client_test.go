@@ -0,0 +1,104 @@
+package k8sclient_test
+
+import (
+	"context"
+	"testing"
+
+	k8sclient "github.com/BradleyLewis08/HiVE/internal/kubernetes"
+	"github.com/BradleyLewis08/HiVE/internal/kubernetes/k8stest"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestGetServiceIP(t *testing.T) {
+	ctx := context.Background()
+	client, _ := k8stest.NewClient()
+
+	for _, service := range []*apiv1.Service{
+		{ObjectMeta: metav1.ObjectMeta{Name: "internal"}, Spec: apiv1.ServiceSpec{Type: apiv1.ServiceTypeClusterIP}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "external"}, Spec: apiv1.ServiceSpec{Type: apiv1.ServiceTypeLoadBalancer}},
+	} {
+		if err := client.DeployService(ctx, service); err != nil {
+			t.Fatalf("DeployService %s: %v", service.Name, err)
+		}
+	}
+
+	tests := []struct {
+		service string
+		want    string
+	}{
+		{"internal", k8stest.CLUSTER_IP},
+		{"external", k8stest.LOAD_BALANCER_IP},
+	}
+	for _, tc := range tests {
+		if got, err := client.GetServiceIP(ctx, tc.service); err != nil || got != tc.want {
+			t.Errorf("GetServiceIP(%s) = %q, %v, want %q", tc.service, got, err, tc.want)
+		}
+	}
+	if _, err := client.GetServiceIP(ctx, "missing"); !apierrors.IsNotFound(err) {
+		t.Errorf("GetServiceIP of a missing Service = %v, want NotFound", err)
+	}
+}
+
+func TestSetPodTemplateAnnotation(t *testing.T) {
+	ctx := context.Background()
+	client, _ := k8stest.NewClient(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "router", Namespace: k8sclient.NAMESPACE},
+		Spec: appsv1.DeploymentSpec{Template: apiv1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"kept": "yes"}},
+		}},
+	})
+
+	if err := client.SetPodTemplateAnnotation(ctx, "router", "hive-config-hash", "abc"); err != nil {
+		t.Fatalf("SetPodTemplateAnnotation: %v", err)
+	}
+	deployment, err := client.GetDeployment(ctx, "router")
+	if err != nil {
+		t.Fatalf("GetDeployment: %v", err)
+	}
+	annotations := deployment.Spec.Template.Annotations
+	if annotations["hive-config-hash"] != "abc" || annotations["kept"] != "yes" {
+		t.Fatalf("pod template annotations = %v, want the new one merged in", annotations)
+	}
+
+	if err := client.SetPodTemplateAnnotation(ctx, "missing", "hive-config-hash", "abc"); !apierrors.IsNotFound(err) {
+		t.Fatalf("SetPodTemplateAnnotation of a missing Deployment = %v, want NotFound", err)
+	}
+}
+
+func TestHTTPRoutes(t *testing.T) {
+	ctx := context.Background()
+	client, _ := k8stest.NewClient()
+
+	route := &unstructured.Unstructured{}
+	route.SetAPIVersion(k8sclient.HTTPRouteResource.GroupVersion().String())
+	route.SetKind("HTTPRoute")
+	route.SetName("alice")
+	route.SetLabels(map[string]string{"app": "hive"})
+
+	if err := client.CreateHTTPRoute(ctx, route); err != nil {
+		t.Fatalf("CreateHTTPRoute: %v", err)
+	}
+	if err := client.CreateHTTPRoute(ctx, route); !apierrors.IsAlreadyExists(err) {
+		t.Fatalf("CreateHTTPRoute of an existing route = %v, want AlreadyExists", err)
+	}
+
+	route.SetLabels(map[string]string{"app": "hive", "updated": "true"})
+	if err := client.UpdateHTTPRoute(ctx, route); err != nil {
+		t.Fatalf("UpdateHTTPRoute: %v", err)
+	}
+	routes, err := client.ListHTTPRoutes(ctx, "updated=true")
+	if err != nil || len(routes) != 1 || routes[0].GetName() != "alice" {
+		t.Fatalf("ListHTTPRoutes = %v, %v, want the updated route", routes, err)
+	}
+
+	if err := client.DeleteHTTPRoute(ctx, "alice"); err != nil {
+		t.Fatalf("DeleteHTTPRoute: %v", err)
+	}
+	if _, err := client.GetHTTPRoute(ctx, "alice"); !apierrors.IsNotFound(err) {
+		t.Fatalf("GetHTTPRoute after delete = %v, want NotFound", err)
+	}
+}
@@ -0,0 +1,68 @@
+package k8sclient
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/metrics"
+)
+
+// instrumentedTransport records the latency and result of every request
+// made through it, labeled by verb and resource.
+type instrumentedTransport struct {
+	next http.RoundTripper
+}
+
+func instrument(next http.RoundTripper) http.RoundTripper {
+	return &instrumentedTransport{next: next}
+}
+
+func (t *instrumentedTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	verb := strings.ToLower(request.Method)
+	if request.URL.Query().Get("watch") == "true" {
+		verb = "watch"
+	}
+	resource := resourceFromPath(request.URL.Path)
+
+	start := time.Now()
+	response, err := t.next.RoundTrip(request)
+
+	// A watch stays open, so its latency says nothing about the API server
+	if verb != "watch" {
+		metrics.KubernetesRequestDuration.WithLabelValues(verb, resource).Observe(time.Since(start).Seconds())
+	}
+	code := "error"
+	if err == nil {
+		code = strconv.Itoa(response.StatusCode)
+	}
+	metrics.KubernetesRequests.WithLabelValues(verb, resource, code).Inc()
+	return response, err
+}
+
+// resourceFromPath extracts the resource, and any subresource, from an API
+// path such as /apis/apps/v1/namespaces/default/deployments/name/scale.
+func resourceFromPath(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	var rest []string
+	switch {
+	case len(parts) >= 2 && parts[0] == "api":
+		rest = parts[2:]
+	case len(parts) >= 3 && parts[0] == "apis":
+		rest = parts[3:]
+	default:
+		return "other"
+	}
+	if len(rest) > 2 && rest[0] == "namespaces" {
+		rest = rest[2:]
+	}
+	if len(rest) == 0 {
+		return "other"
+	}
+	if len(rest) >= 3 {
+		return rest[0] + "/" + rest[2]
+	}
+	return rest[0]
+}
@@ -0,0 +1,69 @@
+// Package k8stest builds Clients backed by the fake clientsets from
+// client-go, for tests that exercise the provisioner and routers without a
+// cluster.
+package k8stest
+
+import (
+	k8sclient "github.com/BradleyLewis08/HiVE/internal/kubernetes"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// Addresses the fake API server assigns to every Service, standing in for
+// the cluster IP allocator and the cloud load balancer
+const (
+	CLUSTER_IP       = "10.96.0.10"
+	LOAD_BALANCER_IP = "203.0.113.10"
+)
+
+// Fakes are the fake clientsets behind a Client, for seeding objects,
+// adding reactors and inspecting the actions a test caused.
+type Fakes struct {
+	Clientset *fake.Clientset
+	Dynamic   *dynamicfake.FakeDynamicClient
+}
+
+// NewClient returns a Client backed by fake clientsets holding objects.
+// Typed objects go to the clientset and unstructured ones, such as
+// HTTPRoutes, to the dynamic client.
+func NewClient(objects ...runtime.Object) (*k8sclient.Client, Fakes) {
+	var typed, unstructured []runtime.Object
+	for _, obj := range objects {
+		if obj.GetObjectKind().GroupVersionKind().Group == k8sclient.HTTPRouteResource.Group {
+			unstructured = append(unstructured, obj)
+		} else {
+			typed = append(typed, obj)
+		}
+	}
+
+	fakes := Fakes{
+		Clientset: fake.NewSimpleClientset(typed...),
+		Dynamic: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+			runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{k8sclient.HTTPRouteResource: "HTTPRouteList"},
+			unstructured...,
+		),
+	}
+	fakes.Clientset.PrependReactor("create", "services", assignAddresses)
+	return k8sclient.NewClient(fakes.Clientset, fakes.Dynamic, nil), fakes
+}
+
+// assignAddresses gives created Services the addresses the API server and
+// cloud provider would, and then lets the tracker store them.
+func assignAddresses(action k8stesting.Action) (bool, runtime.Object, error) {
+	service, ok := action.(k8stesting.CreateAction).GetObject().(*apiv1.Service)
+	if !ok {
+		return false, nil, nil
+	}
+	if service.Spec.ClusterIP == "" {
+		service.Spec.ClusterIP = CLUSTER_IP
+	}
+	if service.Spec.Type == apiv1.ServiceTypeLoadBalancer && len(service.Status.LoadBalancer.Ingress) == 0 {
+		service.Status.LoadBalancer.Ingress = []apiv1.LoadBalancerIngress{{IP: LOAD_BALANCER_IP}}
+	}
+	return false, nil, nil
+}
@@ -0,0 +1,105 @@
+package k8sclient
+
+import (
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	apiv1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+//go:generate sh -c "go run ../../cmd/rbacgen > ../../deploy/rbac.yaml"
+
+const (
+	SERVICE_ACCOUNT_NAME = "hive-provisioner"
+	// Every object the provisioner manages lives in this namespace
+	NAMESPACE = address.NAMESPACE
+)
+
+// POLICY_RULES grants exactly the verbs the Client methods use. Keep it in
+// step with client.go and regenerate deploy/rbac.yaml with go generate.
+// Patch covers SetPodTemplateAnnotation and the server-side dry-run applies
+// of rendered objects.
+var POLICY_RULES = []rbacv1.PolicyRule{
+	{
+		APIGroups: []string{"apps"},
+		Resources: []string{"deployments"},
+		Verbs:     []string{"get", "list", "watch", "create", "update", "patch", "delete"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"services"},
+		Verbs:     []string{"get", "list", "watch", "create", "patch", "delete"},
+	},
+	{
+		APIGroups: []string{""},
+		// Watched for drift in the master-router config
+		Resources: []string{"configmaps"},
+		Verbs:     []string{"list", "watch", "create", "update", "patch", "delete"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"pods"},
+		Verbs:     []string{"list", "watch", "deletecollection"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"pods/log"},
+		Verbs:     []string{"get"},
+	},
+	{
+		APIGroups: []string{""},
+		Resources: []string{"pods/exec"},
+		Verbs:     []string{"create"},
+	},
+	{
+		// Image pulls reported by the kubelet, for the event stream
+		APIGroups: []string{""},
+		Resources: []string{"events"},
+		Verbs:     []string{"list", "watch"},
+	},
+	{
+		APIGroups: []string{"policy"},
+		Resources: []string{"poddisruptionbudgets"},
+		Verbs:     []string{"get", "create", "update", "delete"},
+	},
+	{
+		APIGroups: []string{"networking.k8s.io"},
+		Resources: []string{"ingresses"},
+		Verbs:     []string{"get", "list", "watch", "create", "update", "patch"},
+	},
+	{
+		APIGroups: []string{HTTPRouteResource.Group},
+		Resources: []string{HTTPRouteResource.Resource},
+		Verbs:     []string{"get", "list", "create", "update", "patch", "delete"},
+	},
+}
+
+// RBACManifests returns the ServiceAccount the provisioner runs as, and the
+// Role and RoleBinding granting it POLICY_RULES in NAMESPACE.
+func RBACManifests() []runtime.Object {
+	return []runtime.Object{
+		&apiv1.ServiceAccount{
+			ObjectMeta: metav1.ObjectMeta{Name: SERVICE_ACCOUNT_NAME, Namespace: NAMESPACE},
+		},
+		&rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{Name: SERVICE_ACCOUNT_NAME, Namespace: NAMESPACE},
+			Rules:      POLICY_RULES,
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: SERVICE_ACCOUNT_NAME, Namespace: NAMESPACE},
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "Role",
+				Name:     SERVICE_ACCOUNT_NAME,
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind:      rbacv1.ServiceAccountKind,
+					Name:      SERVICE_ACCOUNT_NAME,
+					Namespace: NAMESPACE,
+				},
+			},
+		},
+	}
+}
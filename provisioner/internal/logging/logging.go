@@ -0,0 +1,117 @@
+// Package logging configures the provisioner's structured logger and
+// carries request and job IDs through contexts, so that every line logged
+// while serving a request can be traced back to it.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	FORMAT_TEXT = "text"
+	FORMAT_JSON = "json"
+)
+
+// Attribute keys added to every record logged with a context that carries
+// them
+const (
+	REQUEST_ID_KEY = "request_id"
+	JOB_ID_KEY     = "job_id"
+	TRACE_ID_KEY   = "trace_id"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	jobIDKey
+)
+
+// NewID returns a random 16 character hex ID.
+func NewID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the ID of the API request ctx belongs to, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// WithJob starts a job: a batch of changes made on behalf of one request,
+// such as applying a manifest, whose log lines share a job ID.
+func WithJob(ctx context.Context) (context.Context, string) {
+	id := NewID()
+	return context.WithValue(ctx, jobIDKey, id), id
+}
+
+// JobID returns the ID of the job ctx belongs to, if any.
+func JobID(ctx context.Context) string {
+	id, _ := ctx.Value(jobIDKey).(string)
+	return id
+}
+
+// New returns a logger writing records in format ("text" or "json") at or
+// above level ("debug", "info", "warn" or "error"). Records logged with a
+// context are annotated with its request, job and trace IDs.
+func New(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var minimum slog.Level
+	if level != "" {
+		if err := minimum.UnmarshalText([]byte(level)); err != nil {
+			return nil, fmt.Errorf("invalid log level %q", level)
+		}
+	}
+	options := &slog.HandlerOptions{Level: minimum}
+
+	var handler slog.Handler
+	switch strings.ToLower(format) {
+	case "", FORMAT_TEXT:
+		handler = slog.NewTextHandler(w, options)
+	case FORMAT_JSON:
+		handler = slog.NewJSONHandler(w, options)
+	default:
+		return nil, fmt.Errorf("invalid log format %q, must be %s or %s", format, FORMAT_TEXT, FORMAT_JSON)
+	}
+	return slog.New(&contextHandler{Handler: handler}), nil
+}
+
+// contextHandler adds the request and job IDs found on the context to each
+// record, along with the trace ID when the span is recorded.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		record.AddAttrs(slog.String(REQUEST_ID_KEY, id))
+	}
+	if id := JobID(ctx); id != "" {
+		record.AddAttrs(slog.String(JOB_ID_KEY, id))
+	}
+	if span := trace.SpanContextFromContext(ctx); span.IsSampled() {
+		record.AddAttrs(slog.String(TRACE_ID_KEY, span.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,140 @@
+// Package metrics defines the Prometheus metrics exported on /metrics.
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const NAMESPACE = "hive"
+
+// Phases of provisioning an environment, in order
+const (
+	PHASE_DEPLOYMENT = "deployment"
+	PHASE_SERVICE    = "service"
+	PHASE_ROUTE      = "route"
+	PHASE_READY      = "ready"
+)
+
+// Outcomes of a drift repair or an orphan deletion
+const (
+	OUTCOME_REPAIRED = "repaired"
+	OUTCOME_DELETED  = "deleted"
+	OUTCOME_FAILED   = "failed"
+)
+
+// Failure reason for environments still not ready when a wait times out
+const REASON_TIMEOUT = "timeout"
+
+var (
+	ProvisionPhaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "provision_phase_duration_seconds",
+		Help:      "Time taken by each phase of provisioning an environment.",
+		// Waiting for readiness includes image pulls, which can take minutes
+		Buckets: []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"phase"})
+
+	ProvisionsSucceeded = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "provisions_succeeded_total",
+		Help:      "Environments provisioned and routed.",
+	})
+
+	ProvisionsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "provisions_failed_total",
+		Help:      "Environments that failed to provision or become ready, by error kind or failure reason.",
+	}, []string{"reason"})
+
+	KubernetesRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "kubernetes_request_duration_seconds",
+		Help:      "Latency of Kubernetes API requests until response headers, excluding watches.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"verb", "resource"})
+
+	KubernetesRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "kubernetes_requests_total",
+		Help:      "Kubernetes API requests by response code, or \"error\" when no response was received.",
+	}, []string{"verb", "resource", "code"})
+
+	WebhookAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "webhook_attempts_total",
+		Help:      "Webhook delivery attempts by outcome: delivered, retry or dead-lettered.",
+	}, []string{"outcome"})
+
+	DriftDetected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "drift_detected_total",
+		Help:      "Drift between desired environments and the cluster, counted when first detected, by kind.",
+	}, []string{"kind"})
+
+	DriftRepairs = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "drift_repairs_total",
+		Help:      "Attempts to repair drift by kind and outcome: repaired or failed.",
+	}, []string{"kind", "outcome"})
+
+	DriftUnrepaired = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "drift_unrepaired",
+		Help:      "Drift left after the last reconcile pass, either unrepairable or failing to repair, by kind.",
+	}, []string{"kind"})
+
+	DriftLastCheck = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "drift_last_check_timestamp_seconds",
+		Help:      "Unix time of the last completed drift check.",
+	})
+
+	GCOrphans = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "gc_orphans",
+		Help:      "Objects whose environment is not desired, left after the last garbage collection sweep, by kind.",
+	}, []string{"kind"})
+
+	GCDeletions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "gc_deletions_total",
+		Help:      "Orphaned objects the garbage collector deleted or failed to delete, by kind and outcome.",
+	}, []string{"kind", "outcome"})
+)
+
+// ObservePhase records the duration of a provisioning phase begun at start.
+func ObservePhase(phase string, start time.Time) {
+	ProvisionPhaseDuration.WithLabelValues(phase).Observe(time.Since(start).Seconds())
+}
+
+// NewRegistry returns a registry holding the provisioner's metrics, along
+// with the Go runtime and process collectors.
+func NewRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		ProvisionPhaseDuration,
+		ProvisionsSucceeded,
+		ProvisionsFailed,
+		KubernetesRequestDuration,
+		KubernetesRequests,
+		WebhookAttempts,
+		DriftDetected,
+		DriftRepairs,
+		DriftUnrepaired,
+		DriftLastCheck,
+		GCOrphans,
+		GCDeletions,
+	)
+	return registry
+}
+
+func Handler(registry *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
@@ -0,0 +1,110 @@
+package naming
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+const (
+	// Maximum length of a DNS-1123 label, which also bounds Service names
+	// and label values.
+	MAX_NAME_LENGTH = 63
+	HASH_LENGTH     = 10
+
+	ORIGINAL_ASSIGNMENT_ANNOTATION = "hive-original-assignment"
+	ORIGINAL_COURSE_ANNOTATION     = "hive-original-course"
+	ORIGINAL_STUDENT_ANNOTATION    = "hive-original-student"
+)
+
+// Sanitize turns an arbitrary identifier such as "CPSC 323: Systems!" or
+// "jane.doe" into a DNS-1123 label that is also a valid label value
+// ("cpsc-323-systems", "jane-doe"). Identifiers that are too long are
+// truncated and suffixed with a hash of the full value.
+//
+// Sanitize is idempotent, so already sanitized identifiers pass through
+// unchanged. Identifiers differing only in case or punctuation sanitize to
+// the same value and therefore refer to the same environment. Identifiers
+// with no ASCII letter or digit to keep, including empty ones, are an error
+// rather than being given a name nobody asked for.
+func Sanitize(identifier string) (string, error) {
+	sanitized := sanitize(identifier)
+	if sanitized == "" {
+		return "", fmt.Errorf("%q has no letters or digits", identifier)
+	}
+	return sanitized, nil
+}
+
+// sanitize is Sanitize, returning an empty string for identifiers with
+// nothing to keep.
+func sanitize(identifier string) string {
+	var builder strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(identifier) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			builder.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && builder.Len() > 0 {
+			builder.WriteByte('-')
+			dash = true
+		}
+	}
+
+	sanitized := strings.TrimRight(builder.String(), "-")
+	if len(sanitized) > MAX_NAME_LENGTH {
+		return truncate(sanitized, MAX_NAME_LENGTH-HASH_LENGTH-1) + "-" + hash(sanitized)
+	}
+	return sanitized
+}
+
+// ResourceName builds a Kubernetes object name from a fixed prefix and a set
+// of identifiers. The result is always a valid DNS-1035 label of at most 63
+// characters. It ends in a hash over the individual identifiers, so
+// ("a-b", "c") and ("a", "b-c") never produce the same name even though their
+// readable parts do.
+func ResourceName(prefix string, identifiers ...string) string {
+	parts := []string{prefix}
+	sanitized := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		sanitized[i] = sanitize(identifier)
+		parts = append(parts, sanitized[i])
+	}
+
+	suffix := hash(sanitized...)
+	readable := truncate(strings.Join(parts, "-"), MAX_NAME_LENGTH-HASH_LENGTH-1)
+	return readable + "-" + suffix
+}
+
+// OriginalAnnotations records identifiers as they were requested, before
+// sanitization, so the original course and assignment names are not lost.
+func OriginalAnnotations(assignmentName string, courseName string, netID string) map[string]string {
+	return map[string]string{
+		ORIGINAL_ASSIGNMENT_ANNOTATION: assignmentName,
+		ORIGINAL_COURSE_ANNOTATION:     courseName,
+		ORIGINAL_STUDENT_ANNOTATION:    netID,
+	}
+}
+
+// hash returns a short, stable digest of the parts. Each part is length
+// prefixed so that different splits of the same characters hash differently.
+func hash(parts ...string) string {
+	digest := sha256.New()
+	for _, part := range parts {
+		var length [8]byte
+		binary.BigEndian.PutUint64(length[:], uint64(len(part)))
+		digest.Write(length[:])
+		digest.Write([]byte(part))
+	}
+	return hex.EncodeToString(digest.Sum(nil))[:HASH_LENGTH]
+}
+
+func truncate(name string, length int) string {
+	if len(name) > length {
+		name = name[:length]
+	}
+	return strings.TrimRight(name, "-")
+}
@@ -0,0 +1,101 @@
+package naming
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var identifiers = []string{
+	"CPSC 323: Systems!",
+	"jane.doe",
+	"JaneDoe",
+	"cpsc323",
+	"hw-1",
+	"--leading and trailing--",
+	"日本語 101",
+	strings.Repeat("very long course name ", 10),
+	strings.Repeat("a", MAX_NAME_LENGTH),
+	strings.Repeat("a", MAX_NAME_LENGTH+1),
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		identifier string
+		want       string
+	}{
+		{"CPSC 323: Systems!", "cpsc-323-systems"},
+		{"jane.doe", "jane-doe"},
+		{"JaneDoe", "janedoe"},
+		{"hw-1", "hw-1"},
+		{"--leading and trailing--", "leading-and-trailing"},
+		{"a  --  b", "a-b"},
+		{strings.Repeat("a", MAX_NAME_LENGTH), strings.Repeat("a", MAX_NAME_LENGTH)},
+	}
+	for _, tc := range tests {
+		if got, err := Sanitize(tc.identifier); err != nil || got != tc.want {
+			t.Errorf("Sanitize(%q) = %q, %v, want %q", tc.identifier, got, err, tc.want)
+		}
+	}
+
+	// Nothing is invented for identifiers with nothing to keep
+	for _, identifier := range []string{"", "   ", "!!!", "日本語"} {
+		if got, err := Sanitize(identifier); err == nil {
+			t.Errorf("Sanitize(%q) = %q, want an error", identifier, got)
+		}
+	}
+}
+
+// mustSanitize is Sanitize for identifiers known to have something to keep.
+func mustSanitize(t *testing.T, identifier string) string {
+	t.Helper()
+	sanitized, err := Sanitize(identifier)
+	if err != nil {
+		t.Fatalf("Sanitize(%q): %v", identifier, err)
+	}
+	return sanitized
+}
+
+func TestSanitizeProducesStableLabels(t *testing.T) {
+	for _, identifier := range identifiers {
+		sanitized := mustSanitize(t, identifier)
+		if errs := validation.IsDNS1123Label(sanitized); len(errs) > 0 {
+			t.Errorf("Sanitize(%q) = %q is not a DNS-1123 label: %v", identifier, sanitized, errs)
+		}
+		if errs := validation.IsValidLabelValue(sanitized); len(errs) > 0 {
+			t.Errorf("Sanitize(%q) = %q is not a label value: %v", identifier, sanitized, errs)
+		}
+		if again := mustSanitize(t, sanitized); again != sanitized {
+			t.Errorf("Sanitize is not idempotent for %q: %q then %q", identifier, sanitized, again)
+		}
+	}
+
+	long := strings.Repeat("a", MAX_NAME_LENGTH+1)
+	if mustSanitize(t, long) == mustSanitize(t, long+"a") {
+		t.Error("long identifiers sanitized to the same value")
+	}
+}
+
+func TestResourceName(t *testing.T) {
+	for _, identifier := range identifiers {
+		name := ResourceName("hive-environment", identifier, "cpsc323", "jane.doe")
+		if errs := validation.IsDNS1035Label(name); len(errs) > 0 {
+			t.Errorf("ResourceName for %q = %q is not a DNS-1035 label: %v", identifier, name, errs)
+		}
+		if again := ResourceName("hive-environment", identifier, "cpsc323", "jane.doe"); again != name {
+			t.Errorf("ResourceName for %q is not stable: %q then %q", identifier, name, again)
+		}
+		// Identifiers that sanitize alike name the same object
+		if sanitized := ResourceName("hive-environment", mustSanitize(t, identifier), "cpsc323", mustSanitize(t, "jane.doe")); sanitized != name {
+			t.Errorf("ResourceName for %q = %q, but %q once sanitized", identifier, name, sanitized)
+		}
+	}
+
+	if ResourceName("hive-lb", "a-b", "c") == ResourceName("hive-lb", "a", "b-c") {
+		t.Error("different splits of the same identifiers produced the same name")
+	}
+	if ResourceName("hive-lb", "a") == ResourceName("hive-route", "a") {
+		t.Error("different prefixes produced the same name")
+	}
+}
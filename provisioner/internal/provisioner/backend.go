@@ -0,0 +1,53 @@
+package provisioner
+
+import (
+	"context"
+	"io"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+const (
+	BACKEND_KUBERNETES = "kubernetes"
+	BACKEND_DOCKER     = "docker"
+)
+
+// Backend runs student environments. Provisioner runs them on Kubernetes;
+// the docker package runs them as local containers for development.
+type Backend interface {
+	// ProvisionStudentEnvironment takes names as requested and returns the
+	// canonical address of the new environment.
+	ProvisionStudentEnvironment(ctx context.Context, assignmentName string, courseName string, netID string, options deployments.EnvironmentOptions) (address.Address, error)
+	UpdateEnvironment(ctx context.Context, environment address.Address, options deployments.EnvironmentOptions) error
+	DeleteEnvironment(ctx context.Context, environment address.Address) error
+	ListEnvironments(ctx context.Context) ([]address.Address, error)
+	// ListEnvironmentOptions returns the environments matching an equality
+	// label selector, such as address.CourseSelector, with their options.
+	ListEnvironmentOptions(ctx context.Context, labelSelector string) (map[address.Address]deployments.EnvironmentOptions, error)
+	// EnvironmentStatus returns the environment's status, or a NotFound
+	// error for unknown environments.
+	EnvironmentStatus(ctx context.Context, environment address.Address) (Status, error)
+	// EnvironmentStatuses returns the status of every environment matching
+	// an equality label selector.
+	EnvironmentStatuses(ctx context.Context, labelSelector string) (map[address.Address]Status, error)
+	// WaitForReady blocks until the environment serves code-server. A
+	// *FailureError is returned if it fails first, and ctx's error if ctx
+	// is done first.
+	WaitForReady(ctx context.Context, environment address.Address) error
+	// ResetEnvironment restarts the environment with a fresh workspace.
+	ResetEnvironment(ctx context.Context, environment address.Address) error
+	StreamLogs(ctx context.Context, environment address.Address, options *apiv1.PodLogOptions) (io.ReadCloser, error)
+	Exec(ctx context.Context, environment address.Address, command []string, stdout io.Writer, stderr io.Writer) error
+}
+
+// Hibernator is implemented by backends that can stop an environment's
+// pods and start them again later, keeping the environment in place.
+type Hibernator interface {
+	HibernateEnvironment(ctx context.Context, environment address.Address) error
+	ResumeEnvironment(ctx context.Context, environment address.Address) error
+}
+
+var _ Backend = (*Provisioner)(nil)
+var _ Hibernator = (*Provisioner)(nil)
@@ -0,0 +1,97 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/BradleyLewis08/HiVE/internal/quota"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Kinds of error, which the API answers with different status codes
+const (
+	ERROR_NOT_FOUND      = "not-found"
+	ERROR_CONFLICT       = "conflict"
+	ERROR_INVALID        = "invalid"
+	ERROR_QUOTA_EXCEEDED = "quota-exceeded"
+	ERROR_UNAVAILABLE    = "unavailable"
+	ERROR_INTERNAL       = "internal"
+)
+
+// Error gives err a kind, so that callers can tell a missing environment or
+// a bad request apart from the cluster being unreachable.
+type Error struct {
+	Kind string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithKind wraps err as an error of the given kind. A nil err stays nil.
+func WithKind(kind string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// Classify wraps err with the kind ErrorKind derives for it, so that the
+// kind of a Kubernetes API error is kept once the error is wrapped further.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var typed *Error
+	if errors.As(err, &typed) {
+		return err
+	}
+	return WithKind(ErrorKind(err), err)
+}
+
+// ErrorKind returns the kind of the first *Error in err's chain, or derives
+// one from Kubernetes API, quota and network errors. Anything else is
+// ERROR_INTERNAL.
+func ErrorKind(err error) string {
+	var typed *Error
+	if errors.As(err, &typed) {
+		return typed.Kind
+	}
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		return ERROR_QUOTA_EXCEEDED
+	}
+
+	switch {
+	case apierrors.IsNotFound(err):
+		return ERROR_NOT_FOUND
+	case apierrors.IsAlreadyExists(err), apierrors.IsConflict(err):
+		return ERROR_CONFLICT
+	case apierrors.IsInvalid(err), apierrors.IsBadRequest(err):
+		return ERROR_INVALID
+	// A ResourceQuota rejection is a Forbidden error naming the quota
+	case apierrors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota"):
+		return ERROR_QUOTA_EXCEEDED
+	case apierrors.IsServerTimeout(err), apierrors.IsTimeout(err), apierrors.IsServiceUnavailable(err),
+		apierrors.IsTooManyRequests(err), errors.Is(err, context.DeadlineExceeded):
+		return ERROR_UNAVAILABLE
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return ERROR_UNAVAILABLE
+	}
+	return ERROR_INTERNAL
+}
+
+// IsNotFound reports whether err is of kind ERROR_NOT_FOUND.
+func IsNotFound(err error) bool {
+	return err != nil && ErrorKind(err) == ERROR_NOT_FOUND
+}
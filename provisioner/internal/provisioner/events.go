@@ -0,0 +1,132 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/events"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Kubelet events announcing an image pull, which pod status does not show
+const PULLING_FIELD_SELECTOR = "involvedObject.kind=Pod,reason=Pulling"
+
+// WatchEvents publishes the lifecycle of every environment, from watches
+// on their Deployments and pods and on the kubelet's image pull events,
+// until ctx is done. Objects that exist when the watch starts are not
+// announced.
+func (p* Provisioner) WatchEvents(ctx context.Context, broker *events.Broker) error {
+	environments := p.k8sClient.InformerFactory(0, metav1.ListOptions{LabelSelector: ENVIRONMENT_LABEL_SELECTOR})
+	deploymentInformer := environments.Apps().V1().Deployments().Informer()
+	podInformer := environments.Core().V1().Pods().Informer()
+
+	kubelet := p.k8sClient.InformerFactory(0, metav1.ListOptions{FieldSelector: PULLING_FIELD_SELECTOR})
+	pullInformer := kubelet.Core().V1().Events().Informer()
+
+	publish := func(eventType string, object metav1.Object, reason string, message string) {
+		environment, err := address.FromLabels(object.GetLabels())
+		if err != nil {
+			return
+		}
+		broker.Publish(events.Event{Type: eventType, Environment: environment, Reason: reason, Message: message})
+	}
+
+	deploymentInformer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			if deployment, ok := obj.(*appsv1.Deployment); ok && !isInInitialList {
+				publish(events.EVENT_CREATED, deployment, "", "")
+			}
+		},
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			old, _ := oldObj.(*appsv1.Deployment)
+			deployment, ok := newObj.(*appsv1.Deployment)
+			if ok && old != nil && !hibernated(old) && hibernated(deployment) {
+				publish(events.EVENT_HIBERNATED, deployment, "", "")
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if deployment, ok := obj.(*appsv1.Deployment); ok {
+				publish(events.EVENT_DELETED, deployment, "", "")
+			}
+		},
+	})
+
+	podChanged := func(old *apiv1.Pod, pod *apiv1.Pod) {
+		if !scheduled(old) && scheduled(pod) {
+			publish(events.EVENT_POD_SCHEDULED, pod, "", fmt.Sprintf("pod %s assigned to %s", pod.Name, pod.Spec.NodeName))
+		}
+
+		before, after := Status{Phase: STATUS_PENDING}, podStatus(pod)
+		if old != nil {
+			before = podStatus(old)
+		}
+		switch {
+		case after.Phase == STATUS_READY && before.Phase != STATUS_READY:
+			publish(events.EVENT_READY, pod, "", "")
+		case after.Phase == STATUS_FAILED && (before.Phase != STATUS_FAILED || before.Failure.Reason != after.Failure.Reason):
+			publish(events.EVENT_FAILED, pod, after.Failure.Reason, after.Failure.Message)
+		}
+	}
+	podInformer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			if pod, ok := obj.(*apiv1.Pod); ok && !isInInitialList {
+				podChanged(nil, pod)
+			}
+		},
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) {
+			old, _ := oldObj.(*apiv1.Pod)
+			if pod, ok := newObj.(*apiv1.Pod); ok && old != nil {
+				podChanged(old, pod)
+			}
+		},
+	})
+
+	// Kubelet events are not labeled, so the environment is that of the pod
+	pullInformer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			event, ok := obj.(*apiv1.Event)
+			if !ok || isInInitialList {
+				return
+			}
+			key := event.InvolvedObject.Namespace + "/" + event.InvolvedObject.Name
+			if pod, exists, err := podInformer.GetStore().GetByKey(key); err == nil && exists {
+				publish(events.EVENT_IMAGE_PULLING, pod.(*apiv1.Pod), "", event.Message)
+			}
+		},
+	})
+
+	environments.Start(ctx.Done())
+	kubelet.Start(ctx.Done())
+	defer environments.Shutdown()
+	defer kubelet.Shutdown()
+
+	if !cache.WaitForCacheSync(ctx.Done(), deploymentInformer.HasSynced, podInformer.HasSynced, pullInformer.HasSynced) {
+		return fmt.Errorf("event watches did not sync: %w", ctx.Err())
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// hibernated reports whether the Deployment is scaled to zero replicas.
+func hibernated(deployment *appsv1.Deployment) bool {
+	return deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == 0
+}
+
+func scheduled(pod *apiv1.Pod) bool {
+	if pod == nil {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == apiv1.PodScheduled {
+			return condition.Status == apiv1.ConditionTrue
+		}
+	}
+	return false
+}
@@ -0,0 +1,130 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/tracing"
+	"github.com/BradleyLewis08/HiVE/services"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Inventory is the environment objects that exist, by environment.
+type Inventory struct {
+	// Options of each environment that has a Deployment
+	Deployments map[address.Address]deployments.EnvironmentOptions
+	// Environments that have a Service
+	Services map[address.Address]bool
+}
+
+// InventoryWatcher is implemented by backends that can keep a watched copy
+// of their environments' objects, and so notice any of them going missing.
+type InventoryWatcher interface {
+	// WatchInventory calls changed with the current inventory whenever an
+	// environment's objects change, and once the watch has synced, until
+	// ctx is done. changed must be safe to call from more than one
+	// goroutine.
+	WatchInventory(ctx context.Context, changed func(Inventory)) error
+	// RestoreEnvironment recreates whichever of the environment's objects
+	// are missing, leaving the others as they are.
+	RestoreEnvironment(ctx context.Context, environment address.Address, options deployments.EnvironmentOptions) error
+}
+
+var _ InventoryWatcher = (*Provisioner)(nil)
+
+// WatchInventory watches every environment's Deployment and Service.
+func (p* Provisioner) WatchInventory(ctx context.Context, changed func(Inventory)) error {
+	factory := p.k8sClient.InformerFactory(0, metav1.ListOptions{LabelSelector: ENVIRONMENT_LABEL_SELECTOR})
+	deploymentInformer := factory.Apps().V1().Deployments().Informer()
+	serviceInformer := factory.Core().V1().Services().Informer()
+
+	notify := func() {
+		if !deploymentInformer.HasSynced() || !serviceInformer.HasSynced() {
+			return
+		}
+		inventory := Inventory{
+			Deployments: make(map[address.Address]deployments.EnvironmentOptions),
+			Services:    make(map[address.Address]bool),
+		}
+		for _, obj := range deploymentInformer.GetStore().List() {
+			deployment, ok := obj.(*appsv1.Deployment)
+			if !ok || deployment.DeletionTimestamp != nil {
+				continue
+			}
+			if environment, err := address.FromLabels(deployment.Labels); err == nil {
+				inventory.Deployments[environment] = deployments.EnvironmentOptionsFromDeployment(deployment)
+			}
+		}
+		for _, obj := range serviceInformer.GetStore().List() {
+			service, ok := obj.(*apiv1.Service)
+			if !ok || service.DeletionTimestamp != nil {
+				continue
+			}
+			if environment, err := address.FromLabels(service.Labels); err == nil {
+				inventory.Services[environment] = true
+			}
+		}
+		changed(inventory)
+	}
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { notify() },
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) { notify() },
+		DeleteFunc: func(obj interface{}) { notify() },
+	}
+	deploymentInformer.AddEventHandler(handler)
+	serviceInformer.AddEventHandler(handler)
+
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+	if !cache.WaitForCacheSync(ctx.Done(), deploymentInformer.HasSynced, serviceInformer.HasSynced) {
+		return fmt.Errorf("environment watch did not sync: %w", ctx.Err())
+	}
+	notify()
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// RestoreEnvironment creates the environment's Deployment and Service,
+// keeping whichever already exist. Names are taken from the canonical
+// address, since the originally requested names are lost with the
+// Deployment.
+func (p* Provisioner) RestoreEnvironment(ctx context.Context, environment address.Address, options deployments.EnvironmentOptions) error {
+	ctx, span := tracing.Start(ctx, "Provisioner.RestoreEnvironment", tracing.Environment(environment))
+	defer span.End()
+
+	slog.InfoContext(ctx, "Restoring environment", "environment", environment)
+	return p.restore(ctx, environment.AssignmentName, environment.CourseName, environment.NetID, options)
+}
+
+// restore creates the Deployment and Service of the environment named as
+// requested, keeping whichever already exist.
+func (p* Provisioner) restore(ctx context.Context, assignmentName string, courseName string, netID string, options deployments.EnvironmentOptions) error {
+	environment := address.New(assignmentName, courseName, netID)
+	deployment, err := deployments.NewEnvironmentDeployment(assignmentName, courseName, netID, options)
+	if err != nil {
+		return WithKind(ERROR_INVALID, err)
+	}
+
+	created, err := p.k8sClient.DeployDeployment(ctx, deployment)
+	if apierrors.IsAlreadyExists(err) {
+		created, err = p.k8sClient.GetDeployment(ctx, environment.DeploymentName())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to restore deployment of %s: %w", environment, err)
+	}
+
+	service := services.NewEnvironmentService(assignmentName, courseName, netID)
+	service.OwnerReferences = []metav1.OwnerReference{deployments.OwnerReference(created)}
+	err = p.k8sClient.DeployService(ctx, service)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to restore service of %s: %w", environment, err)
+	}
+	return nil
+}
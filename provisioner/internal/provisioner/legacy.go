@@ -0,0 +1,98 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/tracing"
+)
+
+// LegacyMigrator is implemented by backends that may hold environments
+// created before objects were named after their address. Those carry the
+// names built from the raw identifiers, and their Services carry no labels,
+// so they are invisible to everything that finds environments by label.
+type LegacyMigrator interface {
+	// MigrateLegacyEnvironments recreates each legacy environment under its
+	// canonical names and labels, then deletes its legacy objects, and
+	// returns the environments migrated.
+	MigrateLegacyEnvironments(ctx context.Context) ([]address.Address, error)
+}
+
+var _ LegacyMigrator = (*Provisioner)(nil)
+
+// MigrateLegacyEnvironments finds legacy Deployments by their labels, which
+// they always carried, and legacy Services by their selector. The canonical
+// objects are created before the legacy ones are deleted, so an environment
+// is only unreachable while its new pod starts. Its workspace, an emptyDir
+// in those versions, is not carried over.
+func (p* Provisioner) MigrateLegacyEnvironments(ctx context.Context) ([]address.Address, error) {
+	ctx, span := tracing.Start(ctx, "Provisioner.MigrateLegacyEnvironments")
+	defer span.End()
+
+	deploymentList, err := p.k8sClient.ListDeployments(ctx, ENVIRONMENT_LABEL_SELECTOR)
+	if err != nil {
+		return nil, err
+	}
+	// Legacy Services have no labels to select them by
+	serviceList, err := p.k8sClient.ListServices(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrated []address.Address
+	var failures []error
+	canonical := make(map[address.Address]bool)
+	for i := range deploymentList {
+		legacy := &deploymentList[i]
+		assignmentName := legacy.Labels[address.ASSIGNMENT_LABEL]
+		courseName := legacy.Labels[address.COURSE_LABEL]
+		netID := legacy.Labels[address.STUDENT_LABEL]
+		if assignmentName == "" || courseName == "" || netID == "" || legacy.DeletionTimestamp != nil {
+			continue
+		}
+		environment := address.New(assignmentName, courseName, netID)
+		if legacy.Name == environment.DeploymentName() {
+			canonical[environment] = true
+			continue
+		}
+
+		slog.InfoContext(ctx, "Migrating legacy environment", "environment", environment, "deployment", legacy.Name)
+		if err := p.restore(ctx, assignmentName, courseName, netID, deployments.EnvironmentOptionsFromDeployment(legacy)); err != nil {
+			failures = append(failures, fmt.Errorf("failed to migrate environment %s: %w", environment, err))
+			continue
+		}
+		canonical[environment] = true
+		if err := ignoreNotFound(p.k8sClient.DeleteDeployment(ctx, legacy.Name)); err != nil {
+			failures = append(failures, fmt.Errorf("failed to delete legacy deployment %s: %w", legacy.Name, err))
+			continue
+		}
+		migrated = append(migrated, environment)
+	}
+
+	// A legacy Service is deleted once its environment has a canonical one,
+	// including after a migration interrupted before it got this far
+	for _, service := range serviceList {
+		selector := service.Spec.Selector
+		if service.Labels[address.APP_LABEL] != "" || selector[address.APP_LABEL] != address.APP_LABEL_VALUE {
+			continue
+		}
+		assignmentName, courseName, netID := selector[address.ASSIGNMENT_LABEL], selector[address.COURSE_LABEL], selector[address.STUDENT_LABEL]
+		if assignmentName == "" || courseName == "" || netID == "" {
+			continue
+		}
+		environment := address.New(assignmentName, courseName, netID)
+		if !canonical[environment] || service.Name == environment.ServiceName() {
+			continue
+		}
+		if err := ignoreNotFound(p.k8sClient.DeleteService(ctx, service.Name)); err != nil {
+			failures = append(failures, fmt.Errorf("failed to delete legacy service %s: %w", service.Name, err))
+		}
+	}
+
+	address.Sort(migrated)
+	return migrated, errors.Join(failures...)
+}
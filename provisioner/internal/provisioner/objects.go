@@ -0,0 +1,88 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/tracing"
+)
+
+// Kinds of environment object
+const (
+	OBJECT_DEPLOYMENT = "deployment"
+	OBJECT_SERVICE    = "service"
+)
+
+// Object is a single object labelled as part of an environment.
+type Object struct {
+	Kind        string          `json:"kind"`
+	Name        string          `json:"name"`
+	Environment address.Address `json:"environment"`
+	// Unset for objects the backend does not timestamp
+	CreatedAt *time.Time `json:"createdAt,omitempty"`
+}
+
+// ObjectCollector is implemented by backends that can list and delete
+// their environments' objects one at a time, so that objects left behind
+// by a half-finished create or delete can be collected.
+type ObjectCollector interface {
+	// ListEnvironmentObjects returns every object labelled with an
+	// environment, whether or not the rest of the environment exists.
+	ListEnvironmentObjects(ctx context.Context) ([]Object, error)
+	DeleteObject(ctx context.Context, object Object) error
+}
+
+var _ ObjectCollector = (*Provisioner)(nil)
+
+// ListEnvironmentObjects lists the Deployments and Services matching
+// ENVIRONMENT_LABEL_SELECTOR. Pods are left out, since they are deleted
+// along with their Deployment.
+func (p* Provisioner) ListEnvironmentObjects(ctx context.Context) ([]Object, error) {
+	ctx, span := tracing.Start(ctx, "Provisioner.ListEnvironmentObjects")
+	defer span.End()
+
+	deploymentList, err := p.k8sClient.ListDeployments(ctx, ENVIRONMENT_LABEL_SELECTOR)
+	if err != nil {
+		return nil, err
+	}
+	serviceList, err := p.k8sClient.ListServices(ctx, ENVIRONMENT_LABEL_SELECTOR)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []Object
+	for _, deployment := range deploymentList {
+		if environment, err := address.FromLabels(deployment.Labels); err == nil && deployment.DeletionTimestamp == nil {
+			objects = append(objects, Object{Kind: OBJECT_DEPLOYMENT, Name: deployment.Name, Environment: environment, CreatedAt: &deployment.CreationTimestamp.Time})
+		}
+	}
+	for _, service := range serviceList {
+		if environment, err := address.FromLabels(service.Labels); err == nil && service.DeletionTimestamp == nil {
+			objects = append(objects, Object{Kind: OBJECT_SERVICE, Name: service.Name, Environment: environment, CreatedAt: &service.CreationTimestamp.Time})
+		}
+	}
+	return objects, nil
+}
+
+// DeleteObject deletes a single Deployment or Service. Objects that are
+// already gone are not an error.
+func (p* Provisioner) DeleteObject(ctx context.Context, object Object) error {
+	ctx, span := tracing.Start(ctx, "Provisioner.DeleteObject", tracing.Environment(object.Environment))
+	defer span.End()
+
+	var err error
+	switch object.Kind {
+	case OBJECT_DEPLOYMENT:
+		err = p.k8sClient.DeleteDeployment(ctx, object.Name)
+	case OBJECT_SERVICE:
+		err = p.k8sClient.DeleteService(ctx, object.Name)
+	default:
+		return WithKind(ERROR_INVALID, fmt.Errorf("unknown object kind %q", object.Kind))
+	}
+	if err = ignoreNotFound(err); err != nil {
+		return fmt.Errorf("failed to delete %s %s: %w", object.Kind, object.Name, err)
+	}
+	return nil
+}
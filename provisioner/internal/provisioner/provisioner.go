@@ -1,17 +1,42 @@
 package provisioner
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
+	"time"
 
 	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
 	k8sclient "github.com/BradleyLewis08/HiVE/internal/kubernetes"
+	"github.com/BradleyLewis08/HiVE/internal/metrics"
+	"github.com/BradleyLewis08/HiVE/internal/naming"
+	"github.com/BradleyLewis08/HiVE/internal/tracing"
 	"github.com/BradleyLewis08/HiVE/internal/utils"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"github.com/BradleyLewis08/HiVE/services"
 )
 
 var HTTPS_PORT = 80
 var CODER_PORT = 8080
 
+var ENVIRONMENT_LABEL_SELECTOR = labels.SelectorFromSet(labels.Set{address.APP_LABEL: address.APP_LABEL_VALUE}).String()
+
+const (
+	STATUS_READY = "ready"
+	STATUS_PENDING = "pending"
+	STATUS_FAILED = "failed"
+	// Scaled to zero replicas, keeping its Deployment and Service
+	STATUS_HIBERNATED = "hibernated"
+)
+
+const ENVIRONMENT_CONTAINER = deployments.ENVIRONMENT_CONTAINER
+
 type Provisioner struct {
 	k8sClient *k8sclient.Client
 }
@@ -20,52 +45,354 @@ func NewProvisioner(k8sClient *k8sclient.Client) *Provisioner {
 	return &Provisioner{k8sClient: k8sClient}
 }
 
-// Provisions pod and ClusterIP service for student environment
+// Provisions pod and ClusterIP service for student environment. Names are
+// taken as requested and the canonical address of the environment is returned.
 func (p* Provisioner) ProvisionStudentEnvironment(
+	ctx context.Context,
 	assignmentName string,
 	courseName string,
-	image string,
 	netID string,
-) error {
-	environmentDeployment := deployments.NewEnvironmentDeployment(assignmentName, courseName, image, netID)
-	fmt.Printf("Creating deployment for %s %s...\n", courseName, netID)
-	err := p.k8sClient.DeployDeployment(environmentDeployment)
+	options deployments.EnvironmentOptions,
+) (address.Address, error) {
+	ctx, span := tracing.Start(ctx, "Provisioner.ProvisionStudentEnvironment", tracing.Environment(address.New(assignmentName, courseName, netID)))
+	defer span.End()
+
+	environmentDeployment, err := deployments.NewEnvironmentDeployment(assignmentName, courseName, netID, options)
 
 	if err != nil {
-		fmt.Printf("Error creating deployment: %s\n", err)
-		return err
+		return address.Address{}, WithKind(ERROR_INVALID, err)
+	}
+
+	slog.InfoContext(ctx, "Creating deployment", "course", courseName, "assignment", assignmentName, "netID", netID)
+	start := time.Now()
+	created, err := p.k8sClient.DeployDeployment(ctx, environmentDeployment)
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Error creating deployment", "error", err)
+		return address.Address{}, err
 	}
+	metrics.ObservePhase(metrics.PHASE_DEPLOYMENT, start)
 
 	// -- Create ClusterIP service
-	fmt.Printf("Creating ClusterIP for %s:%s %s...\n", courseName, assignmentName, netID)
+	slog.InfoContext(ctx, "Creating ClusterIP service", "course", courseName, "assignment", assignmentName, "netID", netID)
+	// Owned by the Deployment, so that deleting it deletes the Service too
 	service := services.NewEnvironmentService(assignmentName, courseName, netID)
-	err = p.k8sClient.DeployService(service)
+	service.OwnerReferences = []metav1.OwnerReference{deployments.OwnerReference(created)}
+	start = time.Now()
+	err = p.k8sClient.DeployService(ctx, service)
 
 	if err != nil {
-		fmt.Printf("Error creating service: %s\n", err)
+		slog.ErrorContext(ctx, "Error creating service", "error", err)
+		return address.Address{}, err
+	}
+	metrics.ObservePhase(metrics.PHASE_SERVICE, start)
+
+	return address.New(assignmentName, courseName, netID), nil
+}
+
+// UpdateEnvironment changes the image and resource profile of an existing
+// environment. The Deployment rolls its pod, so the workspace is discarded.
+func (p* Provisioner) UpdateEnvironment(ctx context.Context, environment address.Address, options deployments.EnvironmentOptions) error {
+	ctx, span := tracing.Start(ctx, "Provisioner.UpdateEnvironment", tracing.Environment(environment))
+	defer span.End()
+
+	existing, err := p.k8sClient.GetDeployment(ctx, environment.DeploymentName())
+	if err != nil {
 		return err
 	}
 
+	// Rebuild from the original names kept in the annotations
+	desired, err := deployments.NewEnvironmentDeployment(
+		originalName(existing.Annotations, naming.ORIGINAL_ASSIGNMENT_ANNOTATION, environment.AssignmentName),
+		originalName(existing.Annotations, naming.ORIGINAL_COURSE_ANNOTATION, environment.CourseName),
+		originalName(existing.Annotations, naming.ORIGINAL_STUDENT_ANNOTATION, environment.NetID),
+		options,
+	)
+	if err != nil {
+		return WithKind(ERROR_INVALID, err)
+	}
+
+	existing.Annotations = desired.Annotations
+	existing.Spec.Template = desired.Spec.Template
+	slog.InfoContext(ctx, "Updating environment", "environment", environment)
+	return p.k8sClient.UpdateDeployment(ctx, existing)
+}
+
+// DeleteEnvironment deletes the environment's Deployment and Service. The
+// Service is owned by the Deployment and deleted along with it, but is also
+// deleted directly for environments created before it was. It only reports
+// a NotFound error when neither exists, so that a half-created environment
+// can still be cleaned up.
+func (p* Provisioner) DeleteEnvironment(ctx context.Context, environment address.Address) error {
+	ctx, span := tracing.Start(ctx, "Provisioner.DeleteEnvironment", tracing.Environment(environment))
+	defer span.End()
+
+	deploymentName := environment.DeploymentName()
+	deploymentErr := p.k8sClient.DeleteDeployment(ctx, deploymentName)
+	if deploymentErr != nil && !apierrors.IsNotFound(deploymentErr) {
+		slog.ErrorContext(ctx, "Failed to delete deployment", "deployment", deploymentName, "error", deploymentErr)
+	}
+
+	// Delete ClusterIP service
+	serviceName := environment.ServiceName()
+	serviceErr := p.k8sClient.DeleteService(ctx, serviceName)
+	if serviceErr != nil && !apierrors.IsNotFound(serviceErr) {
+		slog.ErrorContext(ctx, "Failed to delete service", "service", serviceName, "error", serviceErr)
+	}
+
+	if apierrors.IsNotFound(deploymentErr) && apierrors.IsNotFound(serviceErr) {
+		return WithKind(ERROR_NOT_FOUND, fmt.Errorf("environment %s not found", environment))
+	}
+	err := errors.Join(ignoreNotFound(deploymentErr), ignoreNotFound(serviceErr))
+	if err != nil {
+		return fmt.Errorf("failed to delete environment %s: %w", environment, err)
+	}
+
+	slog.InfoContext(ctx, "Deleted environment objects", "environment", environment)
 	return nil
 }
 
-func (p* Provisioner) DeleteEnvironment(assignmentName string, courseName string, netID string) error {
-	deploymentName := utils.ConstructEnvironmentDeploymentName(assignmentName, courseName, netID)
-	// Initialize error variable
-	err := p.k8sClient.DeleteDeployment(deploymentName)
+// ListEnvironments returns every environment that currently has a
+// Deployment in the cluster, identified by its labels.
+func (p* Provisioner) ListEnvironments(ctx context.Context) ([]address.Address, error) {
+	ctx, span := tracing.Start(ctx, "Provisioner.ListEnvironments")
+	defer span.End()
+
+	settings, err := p.ListEnvironmentOptions(ctx, ENVIRONMENT_LABEL_SELECTOR)
 	if err != nil {
-		fmt.Printf("Failed to delete deployment %s\n", deploymentName)
+		return nil, err
 	}
 
-	// Delete ClusterIP service
-	serviceName := utils.ConstructLoadBalancerServiceName(assignmentName, courseName, netID)
-	err = p.k8sClient.DeleteService(serviceName)
+	environments := make([]address.Address, 0, len(settings))
+	for environment := range settings {
+		environments = append(environments, environment)
+	}
+
+	address.Sort(environments)
+	return environments, nil
+}
+
+// ListEnvironmentOptions returns the options of every environment matching
+// the label selector that has a Deployment. Environments missing their
+// Service are included, so that their routes are not pruned as stale while
+// the Service is restored; they are logged and found as drift.
+func (p* Provisioner) ListEnvironmentOptions(ctx context.Context, labelSelector string) (map[address.Address]deployments.EnvironmentOptions, error) {
+	ctx, span := tracing.Start(ctx, "Provisioner.ListEnvironmentOptions")
+	defer span.End()
+
+	deploymentList, err := p.k8sClient.ListDeployments(ctx, labelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	serviceList, err := p.k8sClient.ListServices(ctx, labelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	servicesByName := make(map[string]bool, len(serviceList))
+	for _, service := range serviceList {
+		servicesByName[service.Name] = true
+	}
+
+	environments := make(map[address.Address]deployments.EnvironmentOptions, len(deploymentList))
+	for i := range deploymentList {
+		environment, err := address.FromLabels(deploymentList[i].Labels)
+		if err != nil {
+			continue
+		}
+		serviceName := environment.ServiceName()
+		if !servicesByName[serviceName] {
+			slog.WarnContext(ctx, "Environment has no service", "environment", environment, "service", serviceName)
+		}
+		environments[environment] = deployments.EnvironmentOptionsFromDeployment(&deploymentList[i])
+	}
+	return environments, nil
+}
+
+// EnvironmentStatus reports whether the environment's pod is serving, or
+// why it cannot.
+func (p* Provisioner) EnvironmentStatus(ctx context.Context, environment address.Address) (Status, error) {
+	ctx, span := tracing.Start(ctx, "Provisioner.EnvironmentStatus", tracing.Environment(environment))
+	defer span.End()
+
+	deployment, err := p.k8sClient.GetDeployment(ctx, environment.DeploymentName())
+	if err != nil {
+		return Status{}, err
+	}
+	if hibernated(deployment) {
+		return Status{Phase: STATUS_HIBERNATED}, nil
+	}
+	if deployment.Status.ReadyReplicas > 0 {
+		return Status{Phase: STATUS_READY}, nil
+	}
+
+	pods, err := p.k8sClient.ListPods(ctx, environment.Selector())
+	if err != nil {
+		return Status{}, err
+	}
+	for i := range pods {
+		if status := podStatus(&pods[i]); status.Phase == STATUS_FAILED {
+			return status, nil
+		}
+	}
+	return Status{Phase: STATUS_PENDING}, nil
+}
+
+// EnvironmentStatuses returns the status of every environment matching the
+// label selector, from a single list of Deployments and of pods.
+func (p* Provisioner) EnvironmentStatuses(ctx context.Context, labelSelector string) (map[address.Address]Status, error) {
+	ctx, span := tracing.Start(ctx, "Provisioner.EnvironmentStatuses")
+	defer span.End()
 
+	deploymentList, err := p.k8sClient.ListDeployments(ctx, labelSelector)
 	if err != nil {
-		fmt.Printf("Failed to delete service %s\n", serviceName)
+		return nil, err
 	}
+	pods, err := p.k8sClient.ListPods(ctx, labelSelector)
+	if err != nil {
+		return nil, err
+	}
+
+	failures := make(map[address.Address]Status)
+	for i := range pods {
+		environment, err := address.FromLabels(pods[i].Labels)
+		if err != nil {
+			continue
+		}
+		if status := podStatus(&pods[i]); status.Phase == STATUS_FAILED {
+			failures[environment] = status
+		}
+	}
+
+	statuses := make(map[address.Address]Status, len(deploymentList))
+	for _, deployment := range deploymentList {
+		environment, err := address.FromLabels(deployment.Labels)
+		if err != nil {
+			continue
+		}
+		switch failure, failed := failures[environment]; {
+		case hibernated(&deployment):
+			statuses[environment] = Status{Phase: STATUS_HIBERNATED}
+		case deployment.Status.ReadyReplicas > 0:
+			statuses[environment] = Status{Phase: STATUS_READY}
+		case failed:
+			statuses[environment] = failure
+		default:
+			statuses[environment] = Status{Phase: STATUS_PENDING}
+		}
+	}
+	return statuses, nil
+}
 
-	fmt.Printf("Successfully deleted environment for %s %s\n", courseName, netID)
+// WaitForReady watches the environment's pods until one is Ready, one has
+// failed, or ctx is done.
+func (p* Provisioner) WaitForReady(ctx context.Context, environment address.Address) error {
+	ctx, span := tracing.Start(ctx, "Provisioner.WaitForReady", tracing.Environment(environment))
+	defer span.End()
+
+	return p.k8sClient.WatchPods(ctx, environment.Selector(), func(pod *apiv1.Pod) (bool, error) {
+		status := podStatus(pod)
+		if status.Phase == STATUS_FAILED {
+			return false, &FailureError{Environment: environment, Failure: *status.Failure}
+		}
+		return status.Phase == STATUS_READY, nil
+	})
+}
+
+// ResetEnvironment deletes the environment's pods. The Deployment replaces
+// them with fresh pods, discarding the contents of the workspace.
+func (p* Provisioner) ResetEnvironment(ctx context.Context, environment address.Address) error {
+	ctx, span := tracing.Start(ctx, "Provisioner.ResetEnvironment", tracing.Environment(environment))
+	defer span.End()
+
+	if _, err := p.k8sClient.GetDeployment(ctx, environment.DeploymentName()); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Resetting environment", "environment", environment)
+	return p.k8sClient.DeletePods(ctx, environment.Selector())
+}
+
+// HibernateEnvironment scales the environment's Deployment to zero
+// replicas. Its Service and route stay in place for ResumeEnvironment.
+func (p* Provisioner) HibernateEnvironment(ctx context.Context, environment address.Address) error {
+	ctx, span := tracing.Start(ctx, "Provisioner.HibernateEnvironment", tracing.Environment(environment))
+	defer span.End()
+
+	return p.scaleEnvironment(ctx, environment, 0)
+}
+
+// ResumeEnvironment scales a hibernated environment back to one replica.
+func (p* Provisioner) ResumeEnvironment(ctx context.Context, environment address.Address) error {
+	ctx, span := tracing.Start(ctx, "Provisioner.ResumeEnvironment", tracing.Environment(environment))
+	defer span.End()
+
+	return p.scaleEnvironment(ctx, environment, 1)
+}
+
+func (p* Provisioner) scaleEnvironment(ctx context.Context, environment address.Address, replicas int32) error {
+	deployment, err := p.k8sClient.GetDeployment(ctx, environment.DeploymentName())
+	if err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Scaling environment", "environment", environment, "replicas", replicas)
+	deployment.Spec.Replicas = utils.Int32ptr(replicas)
+	return p.k8sClient.UpdateDeployment(ctx, deployment)
+}
+
+func (p* Provisioner) StreamLogs(ctx context.Context, environment address.Address, options *apiv1.PodLogOptions) (io.ReadCloser, error) {
+	ctx, span := tracing.Start(ctx, "Provisioner.StreamLogs", tracing.Environment(environment))
+	defer span.End()
+
+	podName, err := p.environmentPod(ctx, environment)
+	if err != nil {
+		return nil, err
+	}
+	options.Container = ENVIRONMENT_CONTAINER
+	return p.k8sClient.StreamPodLogs(ctx, podName, options)
+}
+
+func (p* Provisioner) Exec(ctx context.Context, environment address.Address, command []string, stdout io.Writer, stderr io.Writer) error {
+	ctx, span := tracing.Start(ctx, "Provisioner.Exec", tracing.Environment(environment))
+	defer span.End()
+
+	podName, err := p.environmentPod(ctx, environment)
+	if err != nil {
+		return err
+	}
+	return p.k8sClient.ExecInPod(ctx, podName, ENVIRONMENT_CONTAINER, command, stdout, stderr)
+}
+
+// environmentPod picks the running pod of an environment, falling back to
+// any of its pods so that logs of a failing pod can still be read.
+func (p* Provisioner) environmentPod(ctx context.Context, environment address.Address) (string, error) {
+	pods, err := p.k8sClient.ListPods(ctx, environment.Selector())
+	if err != nil {
+		return "", err
+	}
+	if len(pods) == 0 {
+		return "", WithKind(ERROR_NOT_FOUND, fmt.Errorf("no pods found for environment %s", environment))
+	}
+	for _, pod := range pods {
+		if pod.Status.Phase == apiv1.PodRunning && pod.DeletionTimestamp == nil {
+			return pod.Name, nil
+		}
+	}
+	return pods[0].Name, nil
+}
+
+func ignoreNotFound(err error) error {
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
 	return err
 }
 
+// originalName reads a name as originally requested, falling back to the
+// sanitized name for environments created without the annotations.
+func originalName(annotations map[string]string, key string, sanitized string) string {
+	if name := annotations[key]; name != "" {
+		return name
+	}
+	return sanitized
+}
@@ -0,0 +1,137 @@
+package provisioner_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/kubernetes/k8stest"
+	"github.com/BradleyLewis08/HiVE/internal/naming"
+	"github.com/BradleyLewis08/HiVE/internal/provisioner"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestProvisionAndDelete(t *testing.T) {
+	ctx := context.Background()
+	client, fakes := k8stest.NewClient()
+	p := provisioner.NewProvisioner(client)
+	options := deployments.EnvironmentOptions{Image: "code-server:v1", ResourceProfile: "small"}
+
+	environment, err := p.ProvisionStudentEnvironment(ctx, "Homework 1", "CPSC 323", "jane.doe", options)
+	if err != nil {
+		t.Fatalf("ProvisionStudentEnvironment: %v", err)
+	}
+	if want := address.New("Homework 1", "CPSC 323", "jane.doe"); environment != want {
+		t.Fatalf("ProvisionStudentEnvironment = %v, want %v", environment, want)
+	}
+
+	deployment, err := fakes.Clientset.AppsV1().Deployments(address.NAMESPACE).Get(ctx, environment.DeploymentName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Deployment was not created: %v", err)
+	}
+	if got, err := address.FromLabels(deployment.Labels); err != nil || got != environment {
+		t.Fatalf("Deployment labels name %v, %v, want %v", got, err, environment)
+	}
+	service, err := fakes.Clientset.CoreV1().Services(address.NAMESPACE).Get(ctx, environment.ServiceName(), metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("Service was not created: %v", err)
+	}
+	if owners := service.OwnerReferences; len(owners) != 1 || owners[0].Kind != "Deployment" || owners[0].Name != deployment.Name {
+		t.Fatalf("Service owners = %+v, want the environment's Deployment", owners)
+	}
+
+	environments, err := p.ListEnvironments(ctx)
+	if err != nil || !reflect.DeepEqual(environments, []address.Address{environment}) {
+		t.Fatalf("ListEnvironments = %v, %v, want [%v]", environments, err, environment)
+	}
+	settings, err := p.ListEnvironmentOptions(ctx, provisioner.ENVIRONMENT_LABEL_SELECTOR)
+	if err != nil || settings[environment] != options {
+		t.Fatalf("ListEnvironmentOptions = %v, %v, want %v for %v", settings, err, options, environment)
+	}
+
+	if err := p.DeleteEnvironment(ctx, environment); err != nil {
+		t.Fatalf("DeleteEnvironment: %v", err)
+	}
+	if environments, err := p.ListEnvironments(ctx); err != nil || len(environments) != 0 {
+		t.Fatalf("ListEnvironments after delete = %v, %v, want none", environments, err)
+	}
+	if err := p.DeleteEnvironment(ctx, environment); !provisioner.IsNotFound(err) {
+		t.Fatalf("DeleteEnvironment of a deleted environment = %v, want not found", err)
+	}
+}
+
+func TestProvisionErrors(t *testing.T) {
+	ctx := context.Background()
+
+	client, _ := k8stest.NewClient()
+	_, err := provisioner.NewProvisioner(client).ProvisionStudentEnvironment(ctx, "hw1", "cpsc323", "alice", deployments.EnvironmentOptions{Image: "code-server", ResourceProfile: "huge"})
+	if kind := provisioner.ErrorKind(err); kind != provisioner.ERROR_INVALID {
+		t.Fatalf("ProvisionStudentEnvironment with an unknown profile = %v (%s), want %s", err, kind, provisioner.ERROR_INVALID)
+	}
+
+	client, _ = k8stest.NewClient()
+	p := provisioner.NewProvisioner(client)
+	options := deployments.EnvironmentOptions{Image: "code-server"}
+	if _, err := p.ProvisionStudentEnvironment(ctx, "hw1", "cpsc323", "alice", options); err != nil {
+		t.Fatalf("ProvisionStudentEnvironment: %v", err)
+	}
+	_, err = p.ProvisionStudentEnvironment(ctx, "hw1", "cpsc323", "alice", options)
+	if kind := provisioner.ErrorKind(err); kind != provisioner.ERROR_CONFLICT {
+		t.Fatalf("ProvisionStudentEnvironment of an existing environment = %v (%s), want %s", err, kind, provisioner.ERROR_CONFLICT)
+	}
+
+	client, fakes := k8stest.NewClient()
+	fakes.Clientset.PrependReactor("create", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewServiceUnavailable("etcd is down")
+	})
+	_, err = provisioner.NewProvisioner(client).ProvisionStudentEnvironment(ctx, "hw1", "cpsc323", "alice", options)
+	if kind := provisioner.ErrorKind(err); kind != provisioner.ERROR_UNAVAILABLE {
+		t.Fatalf("ProvisionStudentEnvironment while the API server is unavailable = %v (%s), want %s", err, kind, provisioner.ERROR_UNAVAILABLE)
+	}
+
+	client, fakes = k8stest.NewClient()
+	fakes.Clientset.PrependReactor("delete", "deployments", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: "apps", Resource: "deployments"}, "", nil)
+	})
+	err = provisioner.NewProvisioner(client).DeleteEnvironment(ctx, address.New("hw1", "cpsc323", "alice"))
+	if err == nil || provisioner.IsNotFound(err) {
+		t.Fatalf("DeleteEnvironment without permission = %v, want the permission error", err)
+	}
+}
+
+func TestUpdateEnvironmentKeepsOriginalNames(t *testing.T) {
+	ctx := context.Background()
+	client, fakes := k8stest.NewClient()
+	p := provisioner.NewProvisioner(client)
+
+	environment, err := p.ProvisionStudentEnvironment(ctx, "Homework 1", "CPSC 323", "jane.doe", deployments.EnvironmentOptions{Image: "code-server:v1"})
+	if err != nil {
+		t.Fatalf("ProvisionStudentEnvironment: %v", err)
+	}
+	before, _ := fakes.Clientset.AppsV1().Deployments(address.NAMESPACE).Get(ctx, environment.DeploymentName(), metav1.GetOptions{})
+
+	updated := deployments.EnvironmentOptions{Image: "code-server:v2", ResourceProfile: "medium"}
+	if err := p.UpdateEnvironment(ctx, environment, updated); err != nil {
+		t.Fatalf("UpdateEnvironment: %v", err)
+	}
+	after, _ := fakes.Clientset.AppsV1().Deployments(address.NAMESPACE).Get(ctx, environment.DeploymentName(), metav1.GetOptions{})
+	if got := deployments.EnvironmentOptionsFromDeployment(after); got != updated {
+		t.Fatalf("options after update = %+v, want %+v", got, updated)
+	}
+	for _, key := range []string{naming.ORIGINAL_ASSIGNMENT_ANNOTATION, naming.ORIGINAL_COURSE_ANNOTATION, naming.ORIGINAL_STUDENT_ANNOTATION} {
+		if after.Annotations[key] != before.Annotations[key] {
+			t.Errorf("%s after update = %q, want %q", key, after.Annotations[key], before.Annotations[key])
+		}
+	}
+
+	missing := address.New("hw1", "cpsc323", "nobody")
+	if err := p.UpdateEnvironment(ctx, missing, updated); !provisioner.IsNotFound(err) {
+		t.Fatalf("UpdateEnvironment of a missing environment = %v, want not found", err)
+	}
+}
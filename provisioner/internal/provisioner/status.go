@@ -0,0 +1,85 @@
+package provisioner
+
+import (
+	"fmt"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	apiv1 "k8s.io/api/core/v1"
+)
+
+// Reasons an environment cannot become ready. They match the reasons
+// Kubernetes reports, so that both backends surface the same values.
+const (
+	REASON_IMAGE_PULL_BACK_OFF = "ImagePullBackOff"
+	REASON_CRASH_LOOP_BACK_OFF = "CrashLoopBackOff"
+	REASON_UNSCHEDULABLE       = "Unschedulable"
+	REASON_OOM_KILLED          = "OOMKilled"
+)
+
+// Failure explains why an environment will not become ready without
+// intervention.
+type Failure struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+}
+
+// Status is the state of an environment: STATUS_READY, STATUS_PENDING,
+// STATUS_HIBERNATED or STATUS_FAILED, in which case Failure is set.
+type Status struct {
+	Phase   string
+	Failure *Failure
+}
+
+// FailureError is returned by WaitForReady for environments that failed.
+type FailureError struct {
+	Environment address.Address
+	Failure
+}
+
+func (e *FailureError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("environment %s failed: %s", e.Environment, e.Reason)
+	}
+	return fmt.Sprintf("environment %s failed: %s: %s", e.Environment, e.Reason, e.Message)
+}
+
+// podStatus classifies a code-server pod. Transient states such as a first
+// ErrImagePull are pending; only the back-off states Kubernetes settles
+// into are failures.
+func podStatus(pod *apiv1.Pod) Status {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == apiv1.PodReady && condition.Status == apiv1.ConditionTrue {
+			return Status{Phase: STATUS_READY}
+		}
+		if condition.Type == apiv1.PodScheduled && condition.Status == apiv1.ConditionFalse && condition.Reason == apiv1.PodReasonUnschedulable {
+			return failed(REASON_UNSCHEDULABLE, condition.Message)
+		}
+	}
+
+	for _, container := range pod.Status.ContainerStatuses {
+		if terminated := container.State.Terminated; terminated != nil && terminated.Reason == REASON_OOM_KILLED {
+			return failed(REASON_OOM_KILLED, fmt.Sprintf("container %s exceeded its memory limit", container.Name))
+		}
+
+		waiting := container.State.Waiting
+		if waiting == nil {
+			continue
+		}
+		switch waiting.Reason {
+		case REASON_IMAGE_PULL_BACK_OFF, "InvalidImageName":
+			return failed(REASON_IMAGE_PULL_BACK_OFF, waiting.Message)
+		case REASON_CRASH_LOOP_BACK_OFF:
+			// A container restarted after running out of memory is
+			// reported by its last termination
+			if last := container.LastTerminationState.Terminated; last != nil && last.Reason == REASON_OOM_KILLED {
+				return failed(REASON_OOM_KILLED, fmt.Sprintf("container %s exceeded its memory limit", container.Name))
+			}
+			return failed(REASON_CRASH_LOOP_BACK_OFF, waiting.Message)
+		}
+	}
+	return Status{Phase: STATUS_PENDING}
+}
+
+func failed(reason string, message string) Status {
+	return Status{Phase: STATUS_FAILED, Failure: &Failure{Reason: reason, Message: message}}
+}
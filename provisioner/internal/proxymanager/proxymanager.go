@@ -1,61 +1,140 @@
 package proxymanager
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"sync"
+	"time"
 
 	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
 	k8sclient "github.com/BradleyLewis08/HiVE/internal/kubernetes"
-	"github.com/BradleyLewis08/HiVE/internal/utils"
+	"github.com/BradleyLewis08/HiVE/internal/routing"
+	"github.com/BradleyLewis08/HiVE/internal/tracing"
 	"github.com/BradleyLewis08/HiVE/services"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/cache"
 )
 
 type ProxyManager struct {
 	k8sClient *k8sclient.Client
+	options deployments.NginxOptions
 	mu sync.RWMutex
-	routes map[string]string // location -> proxyPass
+	routes map[string]address.Address // location -> environment
 	proxyIPAddress string
+	// Pending roll of the router onto configHash, run with the context of
+	// the change that scheduled it
+	rollout *time.Timer
+	rolloutCtx context.Context
+	configHash string
 }
 
-func NewProxyManager(k8sClient *k8sclient.Client) *ProxyManager {
-	return &ProxyManager{k8sClient: k8sClient, routes: make(map[string]string)}
+var _ routing.Router = (*ProxyManager)(nil)
+var _ routing.StatusReporter = (*ProxyManager)(nil)
+var _ routing.Renderer = (*ProxyManager)(nil)
+var _ routing.Observer = (*ProxyManager)(nil)
+
+func NewProxyManager(k8sClient *k8sclient.Client, options deployments.NginxOptions) *ProxyManager {
+	return &ProxyManager{k8sClient: k8sClient, options: options.WithDefaults(), routes: make(map[string]address.Address)}
+}
+
+func (pm *ProxyManager) DeleteExistingRouter(ctx context.Context) {
+	ctx, span := tracing.Start(ctx, "ProxyManager.DeleteExistingRouter")
+	defer span.End()
+
+	pm.k8sClient.DeleteDeployment(ctx, deployments.NGINX_NAME)
+	pm.k8sClient.DeleteService(ctx, deployments.NGINX_NAME)
+	pm.k8sClient.DeleteConfigMap(ctx, deployments.NGINX_NAME)
+	pm.k8sClient.DeletePodDisruptionBudget(ctx, deployments.NGINX_NAME)
 }
 
-func (pm *ProxyManager) DeleteExistingRouter() {
-	pm.k8sClient.DeleteDeployment("master-router")
-	pm.k8sClient.DeleteService("master-router")
-	pm.k8sClient.DeleteConfigMap("master-router")
+// Provision deploys the master router, or brings an existing one up to the
+// configured image, replica count and probes.
+func (pm *ProxyManager) Provision(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "ProxyManager.Provision")
+	defer span.End()
+
+	existing, err := pm.k8sClient.GetDeployment(ctx, deployments.NGINX_NAME)
+	if apierrors.IsNotFound(err) {
+		return pm.ProvisionMasterRouter(ctx)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get master router: %w", err)
+	}
+
+	// Keep the current config hash so the update alone does not roll pods
+	configHash := existing.Spec.Template.Annotations[deployments.NGINX_CONFIG_HASH_ANNOTATION]
+	desired := deployments.NewNginxDeployment(deployments.NGINX_NAME, configHash, pm.options)
+	existing.Spec = desired.Spec
+	err = pm.k8sClient.UpdateDeployment(ctx, existing)
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to update master router", "error", err)
+		return err
+	}
+
+	err = pm.k8sClient.ApplyPodDisruptionBudget(ctx, deployments.NewNginxPodDisruptionBudget())
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to apply master router disruption budget", "error", err)
+		return err
+	}
+
+	serviceAddr, err := pm.k8sClient.GetServiceIP(ctx, deployments.NGINX_NAME)
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to get service IP", "error", err)
+		return err
+	}
+
+	pm.proxyIPAddress = serviceAddr
+	return nil
 }
 
-func (pm *ProxyManager) ProvisionMasterRouter() error {
+func (pm *ProxyManager) ProvisionMasterRouter(ctx context.Context) error {
+	ctx, span := tracing.Start(ctx, "ProxyManager.ProvisionMasterRouter")
+	defer span.End()
+
 	configMap := deployments.DefaultNginxConfigMap()
-	err := pm.k8sClient.CreateConfigMap(configMap)
+	err := pm.k8sClient.CreateConfigMap(ctx, configMap)
+
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to create config map", "error", err)
+		return err
+	}
+
+	nginxDeployment := deployments.NewNginxDeployment(configMap.Name, deployments.NginxConfigHash(configMap), pm.options);
+	_, err = pm.k8sClient.DeployDeployment(ctx, nginxDeployment)
 
 	if err != nil {
-		fmt.Println("Failed to create config map")
+		slog.ErrorContext(ctx, "Failed to deploy master router", "error", err)
 		return err
 	}
 
-	nginxDeployment := deployments.NewNginxDeployment(configMap.Name);
-	err = pm.k8sClient.DeployDeployment(nginxDeployment)
+	err = pm.k8sClient.ApplyPodDisruptionBudget(ctx, deployments.NewNginxPodDisruptionBudget())
 
 	if err != nil {
-		fmt.Println("Failed to deploy master router")
+		slog.ErrorContext(ctx, "Failed to create master router disruption budget", "error", err)
 		return err
 	}
 
 	nginxService := services.NewNginxService()
-	err = pm.k8sClient.DeployService(nginxService)
+	err = pm.k8sClient.DeployService(ctx, nginxService)
 
 	if err != nil {
-		fmt.Println("Failed to deploy nginx router service")
+		slog.ErrorContext(ctx, "Failed to deploy nginx router service", "error", err)
 		return err
 	}
 
-	serviceAddr, err := pm.k8sClient.GetServiceIP(nginxService.Name);
+	serviceAddr, err := pm.k8sClient.GetServiceIP(ctx, nginxService.Name);
 
 	if err != nil {
-		fmt.Println("Failed to get service IP")
+		slog.ErrorContext(ctx, "Failed to get service IP", "error", err)
 		return err
 	}
 
@@ -63,28 +142,205 @@ func (pm *ProxyManager) ProvisionMasterRouter() error {
 	return nil
 }
 
-func (pm *ProxyManager) AddRoute(assignmentName string, courseName string, netID string) error {
+func (pm *ProxyManager) AddRoute(ctx context.Context, environment address.Address) error {
+	ctx, span := tracing.Start(ctx, "ProxyManager.AddRoute", tracing.Environment(environment))
+	defer span.End()
+
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
-	relativeRoute := utils.ConstructRelativeRoute(assignmentName, courseName, netID)
-	pm.routes[relativeRoute] = utils.ConstructLoadBalancerRoute(assignmentName, courseName, netID)
-	return pm.updateNginxConfig()
+	pm.routes[environment.Path()] = environment
+	return pm.updateNginxConfig(ctx)
 }
 
-func (pm *ProxyManager) RemoveRoute(assignmentName string, courseName string, netID string) error {
+func (pm *ProxyManager) RemoveRoute(ctx context.Context, environment address.Address) error {
+	ctx, span := tracing.Start(ctx, "ProxyManager.RemoveRoute", tracing.Environment(environment))
+	defer span.End()
+
 	pm.mu.Lock()
 	defer pm.mu.Unlock()
-	relativeRoute := utils.ConstructRelativeRoute(assignmentName, courseName, netID)
-	delete(pm.routes, relativeRoute)
-	return pm.updateNginxConfig()
+	delete(pm.routes, environment.Path())
+	return pm.updateNginxConfig(ctx)
+}
+
+func (pm *ProxyManager) ListRoutes(ctx context.Context) ([]address.Address, error) {
+	ctx, span := tracing.Start(ctx, "ProxyManager.ListRoutes")
+	defer span.End()
+
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	routes := make([]address.Address, 0, len(pm.routes))
+	for _, environment := range pm.routes {
+		routes = append(routes, environment)
+	}
+	address.Sort(routes)
+	return routes, nil
+}
+
+func (pm *ProxyManager) SyncRoutes(ctx context.Context, routes []address.Address) error {
+	ctx, span := tracing.Start(ctx, "ProxyManager.SyncRoutes")
+	defer span.End()
+
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	pm.routes = make(map[string]address.Address, len(routes))
+	for _, environment := range routes {
+		pm.routes[environment.Path()] = environment
+	}
+	return pm.updateNginxConfig(ctx)
+}
+
+// RenderRoutes returns the master-router ConfigMap proxying routes.
+func (pm* ProxyManager) RenderRoutes(routes []address.Address) ([]runtime.Object, error) {
+	configMap, err := newConfigMap(routes)
+	if err != nil {
+		return nil, err
+	}
+	return []runtime.Object{configMap}, nil
+}
+
+func newConfigMap(routes []address.Address) (*apiv1.ConfigMap, error) {
+	locations := make(map[string]string, len(routes))
+	for _, environment := range routes {
+		locations[environment.Path()] = environment.ServiceURL()
+	}
+	return deployments.NewNginxConfigMap(locations)
+}
+
+func (pm* ProxyManager) updateNginxConfig(ctx context.Context) error {
+	routes := make([]address.Address, 0, len(pm.routes))
+	for _, environment := range pm.routes {
+		routes = append(routes, environment)
+	}
+	configMap, err := newConfigMap(routes);
+
+	if err != nil {
+		return err
+	}
+
+	err = pm.k8sClient.UpdateConfigMap(ctx, configMap)
+
+	if err != nil {
+		return err
+	}
+
+	pm.scheduleRollout(ctx, deployments.NginxConfigHash(configMap))
+	return nil
+}
+
+// scheduleRollout rolls the router onto the config with the given hash
+// once the rollout delay has passed, along with any other change made in
+// the meantime. A rolling update restarts every router pod and cuts off
+// code-server connections, so a burst of route changes must not cause one
+// rollout each. pm.mu must be held.
+func (pm* ProxyManager) scheduleRollout(ctx context.Context, configHash string) {
+	pm.configHash = configHash
+	pm.rolloutCtx = context.WithoutCancel(ctx)
+	if pm.rollout == nil {
+		pm.rollout = time.AfterFunc(pm.options.RolloutDelay, pm.rollOut)
+	}
+}
+
+// rollOut rolls the router onto the latest config, retrying after the
+// rollout delay if it fails.
+func (pm* ProxyManager) rollOut() {
+	pm.mu.Lock()
+	ctx, configHash := pm.rolloutCtx, pm.configHash
+	pm.rollout = nil
+	pm.mu.Unlock()
+
+	ctx, span := tracing.Start(ctx, "ProxyManager.rollOut")
+	defer span.End()
+
+	if err := pm.setConfigHash(ctx, configHash); err != nil {
+		slog.ErrorContext(ctx, "Failed to roll master router onto new config", "error", err)
+		pm.mu.Lock()
+		if pm.rollout == nil {
+			pm.rollout = time.AfterFunc(pm.options.RolloutDelay, pm.rollOut)
+		}
+		pm.mu.Unlock()
+	}
 }
 
-func (pm* ProxyManager) updateNginxConfig() error {
-	configMap := deployments.NewNginxConfigMap(pm.routes);
-	return pm.k8sClient.UpdateConfigMap(configMap)
+// setConfigHash changes the config hash on the router's pod template, which
+// rolls its pods. Nothing is changed when the pods already run the config.
+func (pm* ProxyManager) setConfigHash(ctx context.Context, configHash string) error {
+	deployment, err := pm.k8sClient.GetDeployment(ctx, deployments.NGINX_NAME)
+	if err != nil {
+		return err
+	}
+	if deployment.Spec.Template.Annotations[deployments.NGINX_CONFIG_HASH_ANNOTATION] == configHash {
+		return nil
+	}
+
+	slog.InfoContext(ctx, "Rolling master router onto new config", "configHash", configHash)
+	return pm.k8sClient.SetPodTemplateAnnotation(ctx, deployments.NGINX_NAME, deployments.NGINX_CONFIG_HASH_ANNOTATION, configHash)
+}
+
+// WatchRoutes watches the master-router ConfigMap, calling changed with
+// the routes its config proxies whenever it changes. These can differ from
+// ListRoutes, which returns the routes the provisioner last wrote.
+func (pm *ProxyManager) WatchRoutes(ctx context.Context, changed func(routes []address.Address)) error {
+	factory := pm.k8sClient.InformerFactory(0, metav1.ListOptions{
+		FieldSelector: fields.OneTermEqualSelector("metadata.name", deployments.NGINX_NAME).String(),
+	})
+	informer := factory.Core().V1().ConfigMaps().Informer()
+
+	notify := func() {
+		routes := []address.Address{}
+		for _, obj := range informer.GetStore().List() {
+			configMap, ok := obj.(*apiv1.ConfigMap)
+			if !ok {
+				continue
+			}
+			for _, path := range deployments.NginxConfigPaths(configMap) {
+				if environment, err := address.FromPath(path); err == nil {
+					routes = append(routes, environment)
+				}
+			}
+		}
+		address.Sort(routes)
+		changed(routes)
+	}
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { notify() },
+		UpdateFunc: func(oldObj interface{}, newObj interface{}) { notify() },
+		DeleteFunc: func(obj interface{}) { notify() },
+	})
+
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return fmt.Errorf("master-router config watch did not sync: %w", ctx.Err())
+	}
+	// Also covers a ConfigMap that does not exist, which no handler reports
+	notify()
+	<-ctx.Done()
+	return ctx.Err()
 }
 
 func (pm* ProxyManager) GetProxyIPAddress() string {
 	return pm.proxyIPAddress
 }
 
+// Status reports the router as ready while at least one replica passes its
+// readiness probe on /healthz.
+func (pm* ProxyManager) Status(ctx context.Context) (*routing.Status, error) {
+	ctx, span := tracing.Start(ctx, "ProxyManager.Status")
+	defer span.End()
+
+	deployment, err := pm.k8sClient.GetDeployment(ctx, deployments.NGINX_NAME)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &routing.Status{
+		Backend: routing.BACKEND_NGINX,
+		ReadyReplicas: deployment.Status.ReadyReplicas,
+		Address: pm.GetProxyIPAddress(),
+	}
+	if deployment.Spec.Replicas != nil {
+		status.Replicas = *deployment.Spec.Replicas
+	}
+	status.Ready = status.ReadyReplicas > 0
+	return status, nil
+}
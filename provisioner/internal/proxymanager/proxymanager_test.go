@@ -0,0 +1,109 @@
+package proxymanager
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/kubernetes/k8stest"
+	apiv1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const TEST_ROLLOUT_DELAY = 50 * time.Millisecond
+
+func TestRouteChangesRollRouterOnce(t *testing.T) {
+	ctx := context.Background()
+	client, fakes := k8stest.NewClient()
+	pm := NewProxyManager(client, deployments.NginxOptions{RolloutDelay: TEST_ROLLOUT_DELAY})
+	if err := pm.Provision(ctx); err != nil {
+		t.Fatalf("Provision: %v", err)
+	}
+
+	var class []address.Address
+	for i := 0; i < 30; i++ {
+		environment := address.New("hw1", "cpsc323", fmt.Sprintf("student%d", i))
+		class = append(class, environment)
+		if err := pm.AddRoute(ctx, environment); err != nil {
+			t.Fatalf("AddRoute: %v", err)
+		}
+	}
+	waitForConfig(t, fakes)
+	if patches := countPatches(fakes); patches != 1 {
+		t.Fatalf("provisioning a class rolled the router %d times, want once", patches)
+	}
+
+	// The same routes render the same config, which the pods already run
+	if err := pm.SyncRoutes(ctx, class); err != nil {
+		t.Fatalf("SyncRoutes: %v", err)
+	}
+	time.Sleep(4 * TEST_ROLLOUT_DELAY)
+	if patches := countPatches(fakes); patches != 1 {
+		t.Fatalf("an unchanged config rolled the router again (%d rollouts)", patches)
+	}
+
+	if err := pm.RemoveRoute(ctx, class[0]); err != nil {
+		t.Fatalf("RemoveRoute: %v", err)
+	}
+	waitForConfig(t, fakes)
+	if patches := countPatches(fakes); patches != 2 {
+		t.Fatalf("router rolled %d times, want twice", patches)
+	}
+}
+
+// waitForConfig waits until the router's pod template carries the hash of
+// the config in its ConfigMap.
+func waitForConfig(t *testing.T, fakes k8stest.Fakes) {
+	t.Helper()
+	err := wait.PollUntilContextTimeout(context.Background(), 10*time.Millisecond, 2*time.Second, true, func(ctx context.Context) (bool, error) {
+		configMap, err := fakes.Clientset.CoreV1().ConfigMaps(apiv1.NamespaceDefault).Get(ctx, deployments.NGINX_NAME, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		deployment, err := fakes.Clientset.AppsV1().Deployments(apiv1.NamespaceDefault).Get(ctx, deployments.NGINX_NAME, metav1.GetOptions{})
+		if err != nil {
+			return false, err
+		}
+		return deployment.Spec.Template.Annotations[deployments.NGINX_CONFIG_HASH_ANNOTATION] == deployments.NginxConfigHash(configMap), nil
+	})
+	if err != nil {
+		t.Fatalf("router was not rolled onto its config: %v", err)
+	}
+}
+
+func countPatches(fakes k8stest.Fakes) int {
+	patches := 0
+	for _, action := range fakes.Clientset.Actions() {
+		if action.GetVerb() == "patch" && action.GetResource().Resource == "deployments" {
+			patches++
+		}
+	}
+	return patches
+}
+
+func TestProvisionReturnsLookupErrors(t *testing.T) {
+	client, fakes := k8stest.NewClient()
+	denied := apierrors.NewForbidden(schema.GroupResource{Group: "apps", Resource: "deployments"}, deployments.NGINX_NAME, fmt.Errorf("RBAC"))
+	fakes.Clientset.PrependReactor("get", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, denied
+	})
+
+	pm := NewProxyManager(client, deployments.NginxOptions{})
+	err := pm.Provision(context.Background())
+	if !apierrors.IsForbidden(err) {
+		t.Fatalf("Provision = %v, want the Forbidden error from the lookup", err)
+	}
+	for _, action := range fakes.Clientset.Actions() {
+		if action.GetVerb() == "create" {
+			t.Fatalf("Provision created %s after a failed lookup", action.GetResource().Resource)
+		}
+	}
+}
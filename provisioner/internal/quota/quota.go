@@ -0,0 +1,94 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Store holds the maximum number of environments each course may run.
+// Courses without a quota are unlimited.
+type Store struct {
+	mu      sync.RWMutex
+	limits  map[string]int
+	backing Backing
+}
+
+// Backing persists quotas for a Store, such as the provisioner's storage.
+type Backing interface {
+	LoadQuotas(ctx context.Context) (map[string]int, error)
+	// SaveQuota records a course's limit. A limit of 0 removes it.
+	SaveQuota(ctx context.Context, courseName string, limit int) error
+}
+
+type ExceededError struct {
+	CourseName string
+	Limit      int
+	Requested  int
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("course %s is limited to %d environments, %d requested", e.CourseName, e.Limit, e.Requested)
+}
+
+// NewStore returns a store kept only in memory.
+func NewStore() *Store {
+	return &Store{limits: make(map[string]int)}
+}
+
+// Open loads the quotas held by backing, and saves changes to it.
+func Open(ctx context.Context, backing Backing) (*Store, error) {
+	limits, err := backing.LoadQuotas(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load quotas: %w", err)
+	}
+	if limits == nil {
+		limits = make(map[string]int)
+	}
+	return &Store{limits: limits, backing: backing}, nil
+}
+
+// Get returns the course's limit, or 0 if it has none.
+func (s *Store) Get(courseName string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.limits[courseName]
+}
+
+// Validate checks a limit before it is set.
+func Validate(limit int) error {
+	if limit < 0 {
+		return fmt.Errorf("quota must not be negative")
+	}
+	return nil
+}
+
+// Set changes the course's limit. A limit of 0 removes it.
+func (s *Store) Set(ctx context.Context, courseName string, limit int) error {
+	if err := Validate(limit); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.backing != nil {
+		if err := s.backing.SaveQuota(ctx, courseName, limit); err != nil {
+			return fmt.Errorf("failed to save quota: %w", err)
+		}
+	}
+	if limit == 0 {
+		delete(s.limits, courseName)
+		return nil
+	}
+	s.limits[courseName] = limit
+	return nil
+}
+
+// Check reports whether a course running current environments may create
+// requested more.
+func (s *Store) Check(courseName string, current int, requested int) error {
+	limit := s.Get(courseName)
+	if limit > 0 && current+requested > limit {
+		return &ExceededError{CourseName: courseName, Limit: limit, Requested: current + requested}
+	}
+	return nil
+}
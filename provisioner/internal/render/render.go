@@ -0,0 +1,111 @@
+// Package render produces the Kubernetes objects the provisioner would
+// create for a request, for review before a rollout. That is the
+// Deployment, Service and routing objects and nothing else: environments
+// have no PersistentVolumeClaims or NetworkPolicies to render.
+package render
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/routing"
+	"github.com/BradleyLewis08/HiVE/services"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+)
+
+// Request describes the environments to render, with names as requested.
+type Request struct {
+	CourseName     string
+	AssignmentName string
+	NetIDs         []string
+	Options        deployments.EnvironmentOptions
+}
+
+// Environments returns the Deployment and Service of every requested
+// environment, followed by the routing objects renderer produces for
+// routes. routes should include the requested environments.
+func Environments(request Request, renderer routing.Renderer, routes []address.Address) ([]*unstructured.Unstructured, error) {
+	var objects []runtime.Object
+	for _, netID := range request.NetIDs {
+		deployment, err := deployments.NewEnvironmentDeployment(request.AssignmentName, request.CourseName, netID, request.Options)
+		if err != nil {
+			return nil, err
+		}
+		service := services.NewEnvironmentService(request.AssignmentName, request.CourseName, netID)
+		objects = append(objects, deployment, service)
+	}
+
+	if renderer != nil {
+		routeObjects, err := renderer.RenderRoutes(routes)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, routeObjects...)
+	}
+	return ToUnstructured(objects)
+}
+
+// Addresses returns the canonical addresses of the requested environments.
+func (r Request) Addresses() []address.Address {
+	addresses := make([]address.Address, 0, len(r.NetIDs))
+	for _, netID := range r.NetIDs {
+		addresses = append(addresses, address.New(r.AssignmentName, r.CourseName, netID))
+	}
+	return addresses
+}
+
+// ToUnstructured converts typed objects to cleaned unstructured objects
+// with their apiVersion and kind filled in.
+func ToUnstructured(objects []runtime.Object) ([]*unstructured.Unstructured, error) {
+	converted := make([]*unstructured.Unstructured, 0, len(objects))
+	for _, obj := range objects {
+		if u, ok := obj.(*unstructured.Unstructured); ok {
+			converted = append(converted, Clean(u))
+			continue
+		}
+
+		kinds, _, err := scheme.Scheme.ObjectKinds(obj)
+		if err != nil {
+			return nil, err
+		}
+		content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+		if err != nil {
+			return nil, err
+		}
+		u := &unstructured.Unstructured{Object: content}
+		u.SetGroupVersionKind(kinds[0])
+		converted = append(converted, Clean(u))
+	}
+	return converted, nil
+}
+
+// Clean drops the fields that are set by the cluster rather than the
+// provisioner: status, managed fields and empty creation timestamps.
+func Clean(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	unstructured.RemoveNestedField(obj.Object, "status")
+	unstructured.RemoveNestedField(obj.Object, "metadata", "managedFields")
+	unstructured.RemoveNestedField(obj.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(obj.Object, "spec", "template", "metadata", "creationTimestamp")
+	return obj
+}
+
+// YAML writes objects as a multi-document YAML stream.
+func YAML(objects []*unstructured.Unstructured) ([]byte, error) {
+	var buffer bytes.Buffer
+	for i, obj := range objects {
+		data, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, fmt.Errorf("rendering %s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		if i > 0 {
+			buffer.WriteString("---\n")
+		}
+		buffer.Write(data)
+	}
+	return buffer.Bytes(), nil
+}
@@ -0,0 +1,63 @@
+package roster
+
+import (
+	"sort"
+
+	"github.com/BradleyLewis08/HiVE/internal/naming"
+)
+
+// Plan is the set of environments to create and delete so that an
+// assignment's environments match its roster.
+type Plan struct {
+	CourseName     string   `json:"courseName"`
+	AssignmentName string   `json:"assignmentName"`
+	Add            []string `json:"add"`
+	Remove         []string `json:"remove"`
+	Unchanged      int      `json:"unchanged"`
+}
+
+// Diff plans the changes between the students on a roster and the netIDs
+// already provisioned. Roster netIDs are compared in their sanitized form,
+// matching how environments are labeled; a netID with nothing left to
+// sanitize is skipped.
+func Diff(courseName string, assignmentName string, students []Student, provisioned []string) Plan {
+	plan := Plan{
+		CourseName:     courseName,
+		AssignmentName: assignmentName,
+		Add:            []string{},
+		Remove:         []string{},
+	}
+
+	existing := make(map[string]bool, len(provisioned))
+	for _, netID := range provisioned {
+		existing[netID] = true
+	}
+
+	onRoster := make(map[string]bool, len(students))
+	for _, student := range students {
+		netID, err := naming.Sanitize(student.NetID)
+		if err != nil || onRoster[netID] {
+			continue
+		}
+		onRoster[netID] = true
+		if existing[netID] {
+			plan.Unchanged++
+		} else {
+			plan.Add = append(plan.Add, student.NetID)
+		}
+	}
+
+	for netID := range existing {
+		if !onRoster[netID] {
+			plan.Remove = append(plan.Remove, netID)
+		}
+	}
+	sort.Strings(plan.Add)
+	sort.Strings(plan.Remove)
+	return plan
+}
+
+// Empty reports whether the plan changes nothing.
+func (p Plan) Empty() bool {
+	return len(p.Add) == 0 && len(p.Remove) == 0
+}
@@ -0,0 +1,181 @@
+// Package roster reads class lists exported by the registrar or an LMS.
+package roster
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+const (
+	// FORMAT_CSV is any CSV with a header row. The netID column is named
+	// "netID" unless mapped otherwise.
+	FORMAT_CSV = "csv"
+	// FORMAT_CANVAS is a Canvas gradebook export, which identifies students
+	// by their "SIS Login ID".
+	FORMAT_CANVAS = "canvas"
+	// FORMAT_BLACKBOARD is a Blackboard Grade Center export, which identifies
+	// students by their "Username".
+	FORMAT_BLACKBOARD = "blackboard"
+)
+
+var defaultColumns = map[string]Mapping{
+	FORMAT_CSV:        {NetID: "netID", Name: "name"},
+	FORMAT_CANVAS:     {NetID: "SIS Login ID", Name: "Student"},
+	FORMAT_BLACKBOARD: {NetID: "Username", Name: "First Name"},
+}
+
+// Formats lists the supported roster formats.
+func Formats() []string {
+	return []string{FORMAT_CSV, FORMAT_CANVAS, FORMAT_BLACKBOARD}
+}
+
+// Mapping names the columns students are read from. Empty fields fall back
+// to the format's default column.
+type Mapping struct {
+	NetID string `json:"netID,omitempty"`
+	Name  string `json:"name,omitempty"`
+}
+
+type Student struct {
+	NetID string `json:"netID"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Parse reads the students in a roster export. Column names are matched
+// case-insensitively, rows without a netID are skipped, and netIDs given as
+// email addresses are reduced to their local part.
+func Parse(r io.Reader, format string, mapping Mapping) ([]Student, error) {
+	if format == "" {
+		format = FORMAT_CSV
+	}
+	defaults, ok := defaultColumns[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown roster format %q, expected one of %s", format, strings.Join(Formats(), ", "))
+	}
+	if mapping.NetID == "" {
+		mapping.NetID = defaults.NetID
+	}
+	if mapping.Name == "" {
+		mapping.Name = defaults.Name
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = decodeText(data)
+
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = detectDelimiter(data)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("roster is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	netIDColumn := columnIndex(header, mapping.NetID)
+	if netIDColumn < 0 {
+		return nil, fmt.Errorf("roster has no %q column", mapping.NetID)
+	}
+	nameColumn := columnIndex(header, mapping.Name)
+
+	seen := make(map[string]bool)
+	students := []Student{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if format == FORMAT_CANVAS && isCanvasSummaryRow(record) {
+			continue
+		}
+
+		netID := field(record, netIDColumn)
+		if at := strings.Index(netID, "@"); at >= 0 {
+			netID = netID[:at]
+		}
+		if netID == "" || seen[strings.ToLower(netID)] {
+			continue
+		}
+		seen[strings.ToLower(netID)] = true
+		students = append(students, Student{NetID: netID, Name: field(record, nameColumn)})
+	}
+	return students, nil
+}
+
+// decodeText strips a UTF-8 byte order mark and converts UTF-16 exports, as
+// Blackboard produces, to UTF-8.
+func decodeText(data []byte) []byte {
+	if bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}) {
+		return data[3:]
+	}
+
+	var littleEndian bool
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		littleEndian = true
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		littleEndian = false
+	default:
+		return data
+	}
+
+	units := make([]uint16, 0, len(data)/2-1)
+	for i := 2; i+1 < len(data); i += 2 {
+		if littleEndian {
+			units = append(units, uint16(data[i])|uint16(data[i+1])<<8)
+		} else {
+			units = append(units, uint16(data[i])<<8|uint16(data[i+1]))
+		}
+	}
+	return []byte(string(utf16.Decode(units)))
+}
+
+// detectDelimiter picks tab for tab-separated exports and comma otherwise,
+// based on the header line.
+func detectDelimiter(data []byte) rune {
+	line, _ := bufio.NewReader(bytes.NewReader(data)).ReadString('\n')
+	if strings.Count(line, "\t") > strings.Count(line, ",") {
+		return '\t'
+	}
+	return ','
+}
+
+func columnIndex(header []string, name string) int {
+	for i, column := range header {
+		if strings.EqualFold(strings.Trim(strings.TrimSpace(column), `"`), name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func field(record []string, index int) string {
+	if index < 0 || index >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[index])
+}
+
+// Canvas exports follow the header with "Points Possible" and, for some
+// courses, a test student row.
+func isCanvasSummaryRow(record []string) bool {
+	if len(record) == 0 {
+		return true
+	}
+	first := strings.TrimSpace(record[0])
+	return first == "Points Possible" || first == "Student, Test"
+}
@@ -0,0 +1,158 @@
+package roster
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		format  string
+		mapping Mapping
+		input   string
+		want    []Student
+	}{
+		{
+			name:   "csv",
+			format: FORMAT_CSV,
+			input:  "netID,name\nalice,Alice Smith\nbob,Bob Jones\n",
+			want:   []Student{{NetID: "alice", Name: "Alice Smith"}, {NetID: "bob", Name: "Bob Jones"}},
+		},
+		{
+			name:  "default format",
+			input: "name,NETID\nAlice Smith,alice\n",
+			want:  []Student{{NetID: "alice", Name: "Alice Smith"}},
+		},
+		{
+			name:   "emails, blanks and duplicates",
+			format: FORMAT_CSV,
+			input:  "netID\nalice@yale.edu\n\nALICE\n  bob  \n,\n",
+			want:   []Student{{NetID: "alice"}, {NetID: "bob"}},
+		},
+		{
+			name:    "mapped columns",
+			format:  FORMAT_CSV,
+			mapping: Mapping{NetID: "Login", Name: "Full Name"},
+			input:   "Full Name,Login\nAlice Smith,alice\n",
+			want:    []Student{{NetID: "alice", Name: "Alice Smith"}},
+		},
+		{
+			name:   "quoted fields",
+			format: FORMAT_CSV,
+			input:  "name,netID\n\"Smith, Alice\",alice\n",
+			want:   []Student{{NetID: "alice", Name: "Smith, Alice"}},
+		},
+		{
+			name:   "canvas",
+			format: FORMAT_CANVAS,
+			input: "Student,ID,SIS User ID,SIS Login ID,Section,Homework 1\n" +
+				"    Points Possible,,,,,10\n" +
+				"\"Smith, Alice\",101,123,alice,CPSC 323,9\n" +
+				"\"Student, Test\",999,,test,CPSC 323,\n" +
+				"\"Jones, Bob\",102,456,bob,CPSC 323,10\n",
+			want: []Student{{NetID: "alice", Name: "Smith, Alice"}, {NetID: "bob", Name: "Jones, Bob"}},
+		},
+		{
+			name:   "blackboard",
+			format: FORMAT_BLACKBOARD,
+			input: "\"Last Name\"\t\"First Name\"\t\"Username\"\t\"Student ID\"\n" +
+				"\"Smith\"\t\"Alice\"\t\"alice\"\t\"123\"\n" +
+				"\"Jones\"\t\"Bob\"\t\"bob\"\t\"456\"\n",
+			want: []Student{{NetID: "alice", Name: "Alice"}, {NetID: "bob", Name: "Bob"}},
+		},
+		{
+			name:   "byte order mark",
+			format: FORMAT_CSV,
+			input:  "\xEF\xBB\xBFnetID\nalice\n",
+			want:   []Student{{NetID: "alice"}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tc.input), tc.format, tc.mapping)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Fatalf("Parse = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// Blackboard exports UTF-16 with a byte order mark, in either byte order
+func TestParseUTF16(t *testing.T) {
+	text := "Last Name\tFirst Name\tUsername\nSmith\tAlice\talice\n"
+	want := []Student{{NetID: "alice", Name: "Alice"}}
+
+	for _, littleEndian := range []bool{true, false} {
+		data := []byte{0xFE, 0xFF}
+		if littleEndian {
+			data = []byte{0xFF, 0xFE}
+		}
+		for _, unit := range utf16.Encode([]rune(text)) {
+			if littleEndian {
+				data = append(data, byte(unit), byte(unit>>8))
+			} else {
+				data = append(data, byte(unit>>8), byte(unit))
+			}
+		}
+
+		got, err := Parse(strings.NewReader(string(data)), FORMAT_BLACKBOARD, Mapping{})
+		if err != nil {
+			t.Fatalf("Parse (little endian %v): %v", littleEndian, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("Parse (little endian %v) = %+v, want %+v", littleEndian, got, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		input  string
+		want   string
+	}{
+		{"empty", FORMAT_CSV, "", "roster is empty"},
+		{"missing column", FORMAT_CSV, "name\nAlice\n", `roster has no "netID" column`},
+		{"canvas export read as blackboard", FORMAT_BLACKBOARD, "Student,SIS Login ID\nAlice,alice\n", `roster has no "Username" column`},
+		{"unknown format", "xlsx", "netID\nalice\n", `unknown roster format "xlsx"`},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tc.input), tc.format, Mapping{})
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("Parse = %v, want an error containing %q", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	students := []Student{{NetID: "alice"}, {NetID: "Bob.Jones"}, {NetID: "carol"}, {NetID: "CAROL"}}
+	plan := Diff("cpsc323", "hw1", students, []string{"alice", "dave"})
+
+	want := Plan{
+		CourseName:     "cpsc323",
+		AssignmentName: "hw1",
+		Add:            []string{"Bob.Jones", "carol"},
+		Remove:         []string{"dave"},
+		Unchanged:      1,
+	}
+	if !reflect.DeepEqual(plan, want) {
+		t.Fatalf("Diff = %+v, want %+v", plan, want)
+	}
+	if plan.Empty() {
+		t.Fatal("plan with changes reported empty")
+	}
+
+	unchanged := Diff("cpsc323", "hw1", []Student{{NetID: "Bob.Jones"}}, []string{"bob-jones"})
+	if !unchanged.Empty() || unchanged.Unchanged != 1 {
+		t.Fatalf("Diff of a provisioned roster = %+v, want no changes", unchanged)
+	}
+}
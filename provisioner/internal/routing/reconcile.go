@@ -0,0 +1,42 @@
+package routing
+
+import (
+	"context"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+)
+
+// Reconcile makes router expose exactly the desired routes. It returns the
+// routes that had to be added and the stale routes that were pruned.
+//
+// SyncRoutes is always called, even when the listed routes already match,
+// because some backends (such as the nginx master-router) only know about
+// routes they have written since the provisioner started.
+func Reconcile(ctx context.Context, router Router, desired []address.Address) (added []address.Address, removed []address.Address, err error) {
+	current, err := router.ListRoutes(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	currentSet := make(map[address.Address]bool, len(current))
+	for _, route := range current {
+		currentSet[route] = true
+	}
+	desiredSet := make(map[address.Address]bool, len(desired))
+	for _, route := range desired {
+		desiredSet[route] = true
+		if !currentSet[route] {
+			added = append(added, route)
+		}
+	}
+	for _, route := range current {
+		if !desiredSet[route] {
+			removed = append(removed, route)
+		}
+	}
+
+	if err := router.SyncRoutes(ctx, desired); err != nil {
+		return nil, nil, err
+	}
+	return added, removed, nil
+}
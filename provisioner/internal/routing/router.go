@@ -0,0 +1,59 @@
+package routing
+
+import (
+	"context"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	BACKEND_INGRESS = "ingress"
+	BACKEND_NGINX   = "nginx"
+	BACKEND_GATEWAY = "gateway"
+	// In-process proxy used with the local Docker environment backend
+	BACKEND_DOCKER = "docker"
+)
+
+// Router is implemented by every backend capable of exposing student
+// environments (Ingress, the nginx master-router and Gateway API HTTPRoutes).
+type Router interface {
+	// Provision creates any shared resources the backend needs. It must be
+	// safe to call when those resources already exist.
+	Provision(ctx context.Context) error
+	AddRoute(ctx context.Context, environment address.Address) error
+	RemoveRoute(ctx context.Context, environment address.Address) error
+	ListRoutes(ctx context.Context) ([]address.Address, error)
+	// SyncRoutes replaces the full set of environment routes with routes.
+	SyncRoutes(ctx context.Context, routes []address.Address) error
+}
+
+// Status describes whether a routing backend is able to serve traffic.
+type Status struct {
+	Backend       string `json:"backend"`
+	Ready         bool   `json:"ready"`
+	Replicas      int32  `json:"replicas"`
+	ReadyReplicas int32  `json:"readyReplicas"`
+	Address       string `json:"address,omitempty"`
+}
+
+// StatusReporter is implemented by backends that run their own proxy pods.
+type StatusReporter interface {
+	Status(ctx context.Context) (*Status, error)
+}
+
+// Renderer produces the objects a backend would write to expose routes,
+// without reading or changing the cluster. Shared objects, such as the
+// Ingress or the master-router ConfigMap, contain only the given routes.
+type Renderer interface {
+	RenderRoutes(routes []address.Address) ([]runtime.Object, error)
+}
+
+// Observer is implemented by backends whose routes live in cluster objects
+// the provisioner can watch, such as the Ingress or the master-router
+// ConfigMap. WatchRoutes calls changed with the routes those objects
+// serve whenever they change, and once the watch has synced, until ctx is
+// done. changed must be safe to call from more than one goroutine.
+type Observer interface {
+	WatchRoutes(ctx context.Context, changed func(routes []address.Address)) error
+}
@@ -0,0 +1,163 @@
+package routing_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/docker"
+	"github.com/BradleyLewis08/HiVE/internal/gateway"
+	"github.com/BradleyLewis08/HiVE/internal/ingress"
+	"github.com/BradleyLewis08/HiVE/internal/kubernetes/k8stest"
+	"github.com/BradleyLewis08/HiVE/internal/proxymanager"
+	"github.com/BradleyLewis08/HiVE/internal/routing"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+)
+
+var (
+	alice = address.New("hw1", "cpsc323", "alice")
+	bob   = address.New("hw1", "cpsc323", "bob")
+	carol = address.New("lab2", "cpsc201", "carol")
+)
+
+// TestRouterConformance runs every Router through the same sequence of
+// calls, and checks that each serves exactly the routes it was given.
+func TestRouterConformance(t *testing.T) {
+	routers := []struct {
+		name      string
+		newRouter func(t *testing.T) routing.Router
+	}{
+		{
+			name: routing.BACKEND_INGRESS,
+			newRouter: func(t *testing.T) routing.Router {
+				client, _ := k8stest.NewClient()
+				return ingress.NewIngressManager(client)
+			},
+		},
+		{
+			name: routing.BACKEND_NGINX,
+			newRouter: func(t *testing.T) routing.Router {
+				client, _ := k8stest.NewClient()
+				return proxymanager.NewProxyManager(client, deployments.NginxOptions{})
+			},
+		},
+		{
+			name:      routing.BACKEND_GATEWAY + "/" + gateway.SCOPE_ENVIRONMENT,
+			newRouter: newHTTPRouteManager(gateway.Config{GatewayName: "hive", Scope: gateway.SCOPE_ENVIRONMENT}),
+		},
+		{
+			name:      routing.BACKEND_GATEWAY + "/" + gateway.SCOPE_COURSE,
+			newRouter: newHTTPRouteManager(gateway.Config{GatewayName: "hive", Scope: gateway.SCOPE_COURSE}),
+		},
+		{
+			name: routing.BACKEND_DOCKER,
+			newRouter: func(t *testing.T) routing.Router {
+				backend := newDockerBackend(t)
+				return docker.NewProxyRouter(backend, "127.0.0.1:0")
+			},
+		},
+	}
+
+	for _, tc := range routers {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx := context.Background()
+			router := tc.newRouter(t)
+
+			for i := 0; i < 2; i++ {
+				if err := router.Provision(ctx); err != nil {
+					t.Fatalf("Provision #%d: %v", i+1, err)
+				}
+			}
+			expectRoutes(t, router, []address.Address{})
+
+			steps := []struct {
+				name string
+				call func() error
+				want []address.Address
+			}{
+				{"add", func() error { return router.AddRoute(ctx, alice) }, []address.Address{alice}},
+				{"add again", func() error { return router.AddRoute(ctx, alice) }, []address.Address{alice}},
+				{"add another", func() error { return router.AddRoute(ctx, bob) }, []address.Address{alice, bob}},
+				{"add another course", func() error { return router.AddRoute(ctx, carol) }, []address.Address{carol, alice, bob}},
+				{"remove", func() error { return router.RemoveRoute(ctx, alice) }, []address.Address{carol, bob}},
+				{"remove again", func() error { return router.RemoveRoute(ctx, alice) }, []address.Address{carol, bob}},
+				{"remove last of course", func() error { return router.RemoveRoute(ctx, carol) }, []address.Address{bob}},
+				{"sync", func() error { return router.SyncRoutes(ctx, []address.Address{carol, alice}) }, []address.Address{carol, alice}},
+				{"sync again", func() error { return router.SyncRoutes(ctx, []address.Address{alice, carol}) }, []address.Address{carol, alice}},
+				{"sync nothing", func() error { return router.SyncRoutes(ctx, nil) }, []address.Address{}},
+			}
+			for _, step := range steps {
+				if err := step.call(); err != nil {
+					t.Fatalf("%s: %v", step.name, err)
+				}
+				expectRoutes(t, router, step.want)
+			}
+		})
+	}
+}
+
+func expectRoutes(t *testing.T, router routing.Router, want []address.Address) {
+	t.Helper()
+	got, err := router.ListRoutes(context.Background())
+	if err != nil {
+		t.Fatalf("ListRoutes: %v", err)
+	}
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ListRoutes = %v, want %v", got, want)
+	}
+}
+
+func newHTTPRouteManager(config gateway.Config) func(t *testing.T) routing.Router {
+	return func(t *testing.T) routing.Router {
+		client, _ := k8stest.NewClient()
+		router, err := gateway.NewHTTPRouteManager(client, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return router
+	}
+}
+
+// newDockerBackend connects a Backend to a fake Docker daemon in which
+// every environment's container exists and publishes code-server.
+func newDockerBackend(t *testing.T) *docker.Backend {
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Path
+		switch {
+		case strings.Contains(path, "/networks/"):
+			json.NewEncoder(w).Encode(network.Inspect{Name: docker.DEFAULT_NETWORK})
+		case strings.Contains(path, "/containers/") && strings.HasSuffix(path, "/json"):
+			name := strings.TrimSuffix(path[strings.Index(path, "/containers/")+len("/containers/"):], "/json")
+			json.NewEncoder(w).Encode(types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{Name: "/" + name},
+				NetworkSettings: &types.NetworkSettings{
+					NetworkSettingsBase: types.NetworkSettingsBase{
+						Ports: nat.PortMap{docker.CODER_PORT: []nat.PortBinding{{HostIP: "127.0.0.1", HostPort: "32768"}}},
+					},
+				},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(daemon.Close)
+
+	t.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(daemon.URL, "http://"))
+	t.Setenv("DOCKER_API_VERSION", "1.45")
+	backend, err := docker.NewBackend(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return backend
+}
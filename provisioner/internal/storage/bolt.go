@@ -0,0 +1,139 @@
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Bucket holding the bolt schema version
+const BUCKET_META = "meta"
+
+var SCHEMA_VERSION_KEY = []byte("schemaVersion")
+
+// How long opening the file waits for another process to release it
+const BOLT_OPEN_TIMEOUT = 5 * time.Second
+
+// boltMigrations bring a bolt file from one schema version to the next:
+// the first from version 0, an empty file, to version 1.
+var boltMigrations = []func(tx *bolt.Tx) error{
+	func(tx *bolt.Tx) error {
+		for _, bucket := range BUCKETS {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// Audit IDs come from the bucket's sequence, which starts after the
+	// entries appended before it did
+	func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(BUCKET_AUDIT))
+		key, _ := bucket.Cursor().Last()
+		if key == nil {
+			return nil
+		}
+		last, err := strconv.ParseUint(string(key), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid audit key %q: %w", key, err)
+		}
+		return bucket.SetSequence(last)
+	},
+}
+
+// boltBuckets keeps buckets in a bbolt file.
+type boltBuckets struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens the bbolt file at path, creating it if needed, and
+// migrates it to the current schema. Only one process can have the file
+// open.
+func OpenBolt(path string) (Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: BOLT_OPEN_TIMEOUT})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage file %s: %w", path, err)
+	}
+	if err := migrateBolt(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &documents{buckets: &boltBuckets{db: db}}, nil
+}
+
+// migrateBolt applies the migrations the file has not had, in a single
+// transaction.
+func migrateBolt(db *bolt.DB) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists([]byte(BUCKET_META))
+		if err != nil {
+			return err
+		}
+		var version uint64
+		if value := meta.Get(SCHEMA_VERSION_KEY); value != nil {
+			version = binary.BigEndian.Uint64(value)
+		}
+		if version > uint64(len(boltMigrations)) {
+			return fmt.Errorf("storage schema version %d is newer than this provisioner supports (%d)", version, len(boltMigrations))
+		}
+
+		for ; version < uint64(len(boltMigrations)); version++ {
+			if err := boltMigrations[version](tx); err != nil {
+				return fmt.Errorf("failed to migrate storage to version %d: %w", version+1, err)
+			}
+		}
+		return meta.Put(SCHEMA_VERSION_KEY, binary.BigEndian.AppendUint64(nil, version))
+	})
+}
+
+func (b *boltBuckets) get(bucket string, key string) ([]byte, error) {
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		// Values are only valid during the transaction
+		if data := tx.Bucket([]byte(bucket)).Get([]byte(key)); data != nil {
+			value = append([]byte(nil), data...)
+		}
+		return nil
+	})
+	return value, err
+}
+
+func (b *boltBuckets) put(bucket string, key string, value []byte) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).Put([]byte(key), value)
+	})
+}
+
+func (b *boltBuckets) remove(bucket string, key string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).Delete([]byte(key))
+	})
+}
+
+func (b *boltBuckets) list(bucket string) ([][]byte, error) {
+	var values [][]byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(bucket)).ForEach(func(key []byte, value []byte) error {
+			values = append(values, append([]byte(nil), value...))
+			return nil
+		})
+	})
+	return values, err
+}
+
+func (b *boltBuckets) nextSequence(bucket string) (uint64, error) {
+	var sequence uint64
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		var err error
+		sequence, err = tx.Bucket([]byte(bucket)).NextSequence()
+		return err
+	})
+	return sequence, err
+}
+
+func (b *boltBuckets) close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/audit"
+	"github.com/BradleyLewis08/HiVE/internal/course"
+	"github.com/BradleyLewis08/HiVE/internal/templates"
+)
+
+// Buckets of the key-value backends, each holding JSON documents
+const (
+	BUCKET_ENVIRONMENTS = "environments"
+	BUCKET_JOBS         = "jobs"
+	BUCKET_MANIFESTS    = "manifests"
+	BUCKET_TEMPLATES    = "templates"
+	BUCKET_QUOTAS       = "quotas"
+	BUCKET_AUDIT        = "audit"
+)
+
+var BUCKETS = []string{BUCKET_ENVIRONMENTS, BUCKET_JOBS, BUCKET_MANIFESTS, BUCKET_TEMPLATES, BUCKET_QUOTAS, BUCKET_AUDIT}
+
+// buckets is a key-value store of named buckets, implemented by the memory
+// and bolt backends.
+type buckets interface {
+	// get returns nil for a missing key.
+	get(bucket string, key string) ([]byte, error)
+	put(bucket string, key string, value []byte) error
+	remove(bucket string, key string) error
+	// list returns the bucket's values in key order.
+	list(bucket string) ([][]byte, error)
+	// nextSequence returns the bucket's next number, starting at 1.
+	nextSequence(bucket string) (uint64, error)
+	close() error
+}
+
+// documents implements Store on top of buckets, one JSON document per
+// record.
+type documents struct {
+	buckets buckets
+}
+
+func (d *documents) get(bucket string, key string, value interface{}) (bool, error) {
+	data, err := d.buckets.get(bucket, key)
+	if err != nil || data == nil {
+		return false, err
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return false, fmt.Errorf("invalid %s record %s: %w", bucket, key, err)
+	}
+	return true, nil
+}
+
+func (d *documents) put(bucket string, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return d.buckets.put(bucket, key, data)
+}
+
+// list decodes every document in the bucket, in key order, with decode.
+func (d *documents) list(bucket string, decode func(data []byte) error) error {
+	values, err := d.buckets.list(bucket)
+	if err != nil {
+		return err
+	}
+	for _, data := range values {
+		if err := decode(data); err != nil {
+			return fmt.Errorf("invalid %s record: %w", bucket, err)
+		}
+	}
+	return nil
+}
+
+func (d *documents) GetEnvironment(ctx context.Context, environment address.Address) (Environment, bool, error) {
+	var record Environment
+	ok, err := d.get(BUCKET_ENVIRONMENTS, environment.String(), &record)
+	return record, ok, err
+}
+
+func (d *documents) ListEnvironments(ctx context.Context) ([]Environment, error) {
+	environments := []Environment{}
+	err := d.list(BUCKET_ENVIRONMENTS, func(data []byte) error {
+		var record Environment
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		environments = append(environments, record)
+		return nil
+	})
+	return environments, err
+}
+
+func (d *documents) PutEnvironment(ctx context.Context, environment Environment) error {
+	return d.put(BUCKET_ENVIRONMENTS, environment.Address.String(), environment)
+}
+
+func (d *documents) DeleteEnvironment(ctx context.Context, environment address.Address) error {
+	return d.buckets.remove(BUCKET_ENVIRONMENTS, environment.String())
+}
+
+func (d *documents) GetJob(ctx context.Context, id string) (Job, bool, error) {
+	var job Job
+	ok, err := d.get(BUCKET_JOBS, id, &job)
+	return job, ok, err
+}
+
+func (d *documents) ListJobs(ctx context.Context) ([]Job, error) {
+	jobs := []Job{}
+	err := d.list(BUCKET_JOBS, func(data []byte) error {
+		var job Job
+		if err := json.Unmarshal(data, &job); err != nil {
+			return err
+		}
+		jobs = append(jobs, job)
+		return nil
+	})
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].StartedAt.After(jobs[j].StartedAt) })
+	return jobs, err
+}
+
+func (d *documents) PutJob(ctx context.Context, job Job) error {
+	return d.put(BUCKET_JOBS, job.ID, job)
+}
+
+func (d *documents) GetManifest(ctx context.Context, courseName string) (course.Manifest, bool, error) {
+	var manifest course.Manifest
+	ok, err := d.get(BUCKET_MANIFESTS, courseName, &manifest)
+	return manifest, ok, err
+}
+
+func (d *documents) ListManifests(ctx context.Context) ([]course.Manifest, error) {
+	manifests := []course.Manifest{}
+	err := d.list(BUCKET_MANIFESTS, func(data []byte) error {
+		var manifest course.Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return err
+		}
+		manifests = append(manifests, manifest)
+		return nil
+	})
+	return manifests, err
+}
+
+func (d *documents) PutManifest(ctx context.Context, courseName string, manifest course.Manifest) error {
+	return d.put(BUCKET_MANIFESTS, courseName, manifest)
+}
+
+func (d *documents) LoadTemplates(ctx context.Context) ([]templates.Template, error) {
+	list := []templates.Template{}
+	err := d.list(BUCKET_TEMPLATES, func(data []byte) error {
+		var template templates.Template
+		if err := json.Unmarshal(data, &template); err != nil {
+			return err
+		}
+		list = append(list, template)
+		return nil
+	})
+	return list, err
+}
+
+func (d *documents) SaveTemplate(ctx context.Context, template templates.Template) error {
+	return d.put(BUCKET_TEMPLATES, template.Name, template)
+}
+
+func (d *documents) DeleteTemplate(ctx context.Context, name string) error {
+	return d.buckets.remove(BUCKET_TEMPLATES, name)
+}
+
+// quotaRecord is how a quota is kept, since a bare limit does not name its
+// course.
+type quotaRecord struct {
+	CourseName      string `json:"courseName"`
+	MaxEnvironments int    `json:"maxEnvironments"`
+}
+
+func (d *documents) LoadQuotas(ctx context.Context) (map[string]int, error) {
+	limits := make(map[string]int)
+	err := d.list(BUCKET_QUOTAS, func(data []byte) error {
+		var record quotaRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			return err
+		}
+		limits[record.CourseName] = record.MaxEnvironments
+		return nil
+	})
+	return limits, err
+}
+
+func (d *documents) SaveQuota(ctx context.Context, courseName string, limit int) error {
+	if limit == 0 {
+		return d.buckets.remove(BUCKET_QUOTAS, courseName)
+	}
+	return d.put(BUCKET_QUOTAS, courseName, quotaRecord{CourseName: courseName, MaxEnvironments: limit})
+}
+
+// QueryAudit reads the whole bucket, which is kept on the provisioner's
+// own disk, and selects from it.
+func (d *documents) QueryAudit(ctx context.Context, filter audit.Filter) ([]audit.Entry, error) {
+	var entries []audit.Entry
+	err := d.list(BUCKET_AUDIT, func(data []byte) error {
+		var entry audit.Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return filter.Select(entries), nil
+}
+
+func (d *documents) AppendAudit(ctx context.Context, entry audit.Entry) (int64, error) {
+	sequence, err := d.buckets.nextSequence(BUCKET_AUDIT)
+	if err != nil {
+		return 0, err
+	}
+	entry.ID = int64(sequence)
+	return entry.ID, d.put(BUCKET_AUDIT, auditKey(entry.ID), entry)
+}
+
+// auditKey pads the entry's ID so that entries sort in the order they were
+// appended.
+func auditKey(id int64) string {
+	return fmt.Sprintf("%020d", id)
+}
+
+func (d *documents) Close() error {
+	return d.buckets.close()
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"sort"
+	"sync"
+)
+
+// memoryBuckets keeps buckets in maps.
+type memoryBuckets struct {
+	mu      sync.RWMutex
+	buckets   map[string]map[string][]byte
+	sequences map[string]uint64
+}
+
+// NewMemory returns a store that keeps everything in memory, for
+// development and tests.
+func NewMemory() Store {
+	b := &memoryBuckets{buckets: make(map[string]map[string][]byte), sequences: make(map[string]uint64)}
+	for _, bucket := range BUCKETS {
+		b.buckets[bucket] = make(map[string][]byte)
+	}
+	return &documents{buckets: b}
+}
+
+func (b *memoryBuckets) get(bucket string, key string) ([]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.buckets[bucket][key], nil
+}
+
+func (b *memoryBuckets) put(bucket string, key string, value []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buckets[bucket][key] = value
+	return nil
+}
+
+func (b *memoryBuckets) remove(bucket string, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.buckets[bucket], key)
+	return nil
+}
+
+func (b *memoryBuckets) list(bucket string) ([][]byte, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	keys := make([]string, 0, len(b.buckets[bucket]))
+	for key := range b.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = b.buckets[bucket][key]
+	}
+	return values, nil
+}
+
+func (b *memoryBuckets) nextSequence(bucket string) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sequences[bucket]++
+	return b.sequences[bucket], nil
+}
+
+func (b *memoryBuckets) close() error {
+	return nil
+}
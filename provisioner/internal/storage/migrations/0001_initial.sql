@@ -0,0 +1,64 @@
+-- Tables are prefixed so that they can share a database with the
+-- user-service.
+
+CREATE TABLE hive_environments (
+    course_name      TEXT        NOT NULL,
+    assignment_name  TEXT        NOT NULL,
+    net_id           TEXT        NOT NULL,
+    image            TEXT        NOT NULL,
+    resource_profile TEXT        NOT NULL DEFAULT '',
+    job_id           TEXT        NOT NULL DEFAULT '',
+    created_at       TIMESTAMPTZ NOT NULL,
+    updated_at       TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (course_name, assignment_name, net_id)
+);
+
+CREATE TABLE hive_jobs (
+    id          TEXT PRIMARY KEY,
+    kind        TEXT        NOT NULL,
+    actor       TEXT        NOT NULL,
+    request_id  TEXT        NOT NULL DEFAULT '',
+    course_name TEXT        NOT NULL DEFAULT '',
+    status      TEXT        NOT NULL,
+    error       TEXT        NOT NULL DEFAULT '',
+    started_at  TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX hive_jobs_started_at ON hive_jobs (started_at DESC);
+
+-- Course manifests, including their assignment schedules
+CREATE TABLE hive_manifests (
+    course_name TEXT PRIMARY KEY,
+    manifest    JSONB       NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE hive_templates (
+    name             TEXT PRIMARY KEY,
+    description      TEXT NOT NULL DEFAULT '',
+    image            TEXT NOT NULL,
+    resource_profile TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE hive_quotas (
+    course_name      TEXT PRIMARY KEY,
+    max_environments INTEGER NOT NULL CHECK (max_environments > 0)
+);
+
+CREATE TABLE hive_audit (
+    id              BIGINT PRIMARY KEY,
+    time            TIMESTAMPTZ NOT NULL,
+    actor           TEXT        NOT NULL,
+    action          TEXT        NOT NULL,
+    course_name     TEXT        NOT NULL,
+    assignment_name TEXT        NOT NULL,
+    net_id          TEXT        NOT NULL,
+    parameters      JSONB,
+    outcome         TEXT        NOT NULL,
+    error           TEXT        NOT NULL DEFAULT '',
+    request_id      TEXT        NOT NULL DEFAULT '',
+    job_id          TEXT        NOT NULL DEFAULT ''
+);
+
+CREATE INDEX hive_audit_environment ON hive_audit (course_name, assignment_name, net_id);
@@ -0,0 +1,10 @@
+-- Audit IDs are assigned by the database, since replicas append
+-- concurrently. Entries numbered by the provisioner keep their IDs and the
+-- sequence goes on from the last of them.
+CREATE SEQUENCE hive_audit_id_seq OWNED BY hive_audit.id;
+SELECT setval('hive_audit_id_seq', COALESCE(MAX(id), 0) + 1, false) FROM hive_audit;
+ALTER TABLE hive_audit ALTER COLUMN id SET DEFAULT nextval('hive_audit_id_seq');
+
+ALTER TABLE hive_audit ADD COLUMN on_behalf_of TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX hive_audit_time ON hive_audit (time);
@@ -0,0 +1,456 @@
+package storage
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/audit"
+	"github.com/BradleyLewis08/HiVE/internal/course"
+	"github.com/BradleyLewis08/HiVE/internal/templates"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Migrations are named <version>_<description>.sql and applied in order of
+// version, each in its own transaction.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// Advisory lock held while migrating, so that replicas starting together
+// do not migrate at once
+const MIGRATION_LOCK_ID = 0x68697665
+
+type postgres struct {
+	pool *pgxpool.Pool
+}
+
+// OpenPostgres connects to the database at url and migrates it to the
+// current schema.
+func OpenPostgres(ctx context.Context, url string) (Store, error) {
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the database: %w", err)
+	}
+	if err := migratePostgres(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return &postgres{pool: pool}, nil
+}
+
+type migration struct {
+	version int
+	name    string
+}
+
+func migratePostgres(ctx context.Context, pool *pgxpool.Pool) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the database: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", MIGRATION_LOCK_ID); err != nil {
+		return fmt.Errorf("failed to lock the database for migration: %w", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", MIGRATION_LOCK_ID)
+
+	_, err = conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS hive_schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create the migrations table: %w", err)
+	}
+
+	var current int
+	err = conn.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM hive_schema_migrations").Scan(&current)
+	if err != nil {
+		return fmt.Errorf("failed to read the schema version: %w", err)
+	}
+
+	pending, err := pendingMigrations(current)
+	if err != nil {
+		return err
+	}
+	for _, m := range pending {
+		script, err := migrations.ReadFile("migrations/" + m.name)
+		if err != nil {
+			return err
+		}
+		err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, string(script)); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO hive_schema_migrations (version) VALUES ($1)", m.version)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to apply migration %s: %w", m.name, err)
+		}
+	}
+	return nil
+}
+
+// pendingMigrations returns the migrations after version current, in order.
+func pendingMigrations(current int) ([]migration, error) {
+	files, err := fs.Glob(migrations, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var all []migration
+	for _, file := range files {
+		name := strings.TrimPrefix(file, "migrations/")
+		prefix, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s is not named <version>_<description>.sql", name)
+		}
+		all = append(all, migration{version: version, name: name})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].version < all[j].version })
+
+	if len(all) > 0 && current > all[len(all)-1].version {
+		return nil, fmt.Errorf("database schema version %d is newer than this provisioner supports (%d)", current, all[len(all)-1].version)
+	}
+	var pending []migration
+	for _, m := range all {
+		if m.version > current {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+const environmentColumns = "course_name, assignment_name, net_id, image, resource_profile, job_id, created_at, updated_at"
+
+func scanEnvironment(row pgx.Row) (Environment, error) {
+	var e Environment
+	err := row.Scan(&e.CourseName, &e.AssignmentName, &e.NetID, &e.Options.Image, &e.Options.ResourceProfile, &e.JobID, &e.CreatedAt, &e.UpdatedAt)
+	e.CreatedAt, e.UpdatedAt = e.CreatedAt.UTC(), e.UpdatedAt.UTC()
+	return e, err
+}
+
+func (p *postgres) GetEnvironment(ctx context.Context, environment address.Address) (Environment, bool, error) {
+	record, err := scanEnvironment(p.pool.QueryRow(ctx,
+		"SELECT "+environmentColumns+" FROM hive_environments WHERE course_name = $1 AND assignment_name = $2 AND net_id = $3",
+		environment.CourseName, environment.AssignmentName, environment.NetID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Environment{}, false, nil
+	}
+	return record, err == nil, err
+}
+
+func (p *postgres) ListEnvironments(ctx context.Context) ([]Environment, error) {
+	rows, err := p.pool.Query(ctx, "SELECT "+environmentColumns+" FROM hive_environments ORDER BY course_name, assignment_name, net_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	environments := []Environment{}
+	for rows.Next() {
+		record, err := scanEnvironment(rows)
+		if err != nil {
+			return nil, err
+		}
+		environments = append(environments, record)
+	}
+	return environments, rows.Err()
+}
+
+func (p *postgres) PutEnvironment(ctx context.Context, environment Environment) error {
+	_, err := p.pool.Exec(ctx, `INSERT INTO hive_environments (`+environmentColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (course_name, assignment_name, net_id) DO UPDATE SET
+			image = EXCLUDED.image,
+			resource_profile = EXCLUDED.resource_profile,
+			job_id = EXCLUDED.job_id,
+			created_at = EXCLUDED.created_at,
+			updated_at = EXCLUDED.updated_at`,
+		environment.CourseName, environment.AssignmentName, environment.NetID,
+		environment.Options.Image, environment.Options.ResourceProfile, environment.JobID,
+		environment.CreatedAt, environment.UpdatedAt)
+	return err
+}
+
+func (p *postgres) DeleteEnvironment(ctx context.Context, environment address.Address) error {
+	_, err := p.pool.Exec(ctx, "DELETE FROM hive_environments WHERE course_name = $1 AND assignment_name = $2 AND net_id = $3",
+		environment.CourseName, environment.AssignmentName, environment.NetID)
+	return err
+}
+
+const jobColumns = "id, kind, actor, request_id, course_name, status, error, started_at, finished_at"
+
+func scanJob(row pgx.Row) (Job, error) {
+	var job Job
+	err := row.Scan(&job.ID, &job.Kind, &job.Actor, &job.RequestID, &job.CourseName, &job.Status, &job.Error, &job.StartedAt, &job.FinishedAt)
+	job.StartedAt = job.StartedAt.UTC()
+	if job.FinishedAt != nil {
+		finished := job.FinishedAt.UTC()
+		job.FinishedAt = &finished
+	}
+	return job, err
+}
+
+func (p *postgres) GetJob(ctx context.Context, id string) (Job, bool, error) {
+	job, err := scanJob(p.pool.QueryRow(ctx, "SELECT "+jobColumns+" FROM hive_jobs WHERE id = $1", id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Job{}, false, nil
+	}
+	return job, err == nil, err
+}
+
+func (p *postgres) ListJobs(ctx context.Context) ([]Job, error) {
+	rows, err := p.pool.Query(ctx, "SELECT "+jobColumns+" FROM hive_jobs ORDER BY started_at DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+func (p *postgres) PutJob(ctx context.Context, job Job) error {
+	_, err := p.pool.Exec(ctx, `INSERT INTO hive_jobs (`+jobColumns+`)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (id) DO UPDATE SET
+			status = EXCLUDED.status,
+			error = EXCLUDED.error,
+			finished_at = EXCLUDED.finished_at`,
+		job.ID, job.Kind, job.Actor, job.RequestID, job.CourseName, job.Status, job.Error, job.StartedAt, job.FinishedAt)
+	return err
+}
+
+func (p *postgres) GetManifest(ctx context.Context, courseName string) (course.Manifest, bool, error) {
+	var manifest course.Manifest
+	var data []byte
+	err := p.pool.QueryRow(ctx, "SELECT manifest FROM hive_manifests WHERE course_name = $1", courseName).Scan(&data)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return manifest, false, nil
+	}
+	if err != nil {
+		return manifest, false, err
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, false, fmt.Errorf("invalid manifest for %s: %w", courseName, err)
+	}
+	return manifest, true, nil
+}
+
+func (p *postgres) ListManifests(ctx context.Context) ([]course.Manifest, error) {
+	rows, err := p.pool.Query(ctx, "SELECT course_name, manifest FROM hive_manifests ORDER BY course_name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	manifests := []course.Manifest{}
+	for rows.Next() {
+		var courseName string
+		var data []byte
+		if err := rows.Scan(&courseName, &data); err != nil {
+			return nil, err
+		}
+		var manifest course.Manifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("invalid manifest for %s: %w", courseName, err)
+		}
+		manifests = append(manifests, manifest)
+	}
+	return manifests, rows.Err()
+}
+
+func (p *postgres) PutManifest(ctx context.Context, courseName string, manifest course.Manifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	_, err = p.pool.Exec(ctx, `INSERT INTO hive_manifests (course_name, manifest, updated_at) VALUES ($1, $2, now())
+		ON CONFLICT (course_name) DO UPDATE SET manifest = EXCLUDED.manifest, updated_at = EXCLUDED.updated_at`,
+		courseName, data)
+	return err
+}
+
+func (p *postgres) LoadTemplates(ctx context.Context) ([]templates.Template, error) {
+	rows, err := p.pool.Query(ctx, "SELECT name, description, image, resource_profile FROM hive_templates ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []templates.Template{}
+	for rows.Next() {
+		var template templates.Template
+		if err := rows.Scan(&template.Name, &template.Description, &template.Image, &template.ResourceProfile); err != nil {
+			return nil, err
+		}
+		list = append(list, template)
+	}
+	return list, rows.Err()
+}
+
+func (p *postgres) SaveTemplate(ctx context.Context, template templates.Template) error {
+	_, err := p.pool.Exec(ctx, `INSERT INTO hive_templates (name, description, image, resource_profile) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE SET
+			description = EXCLUDED.description,
+			image = EXCLUDED.image,
+			resource_profile = EXCLUDED.resource_profile`,
+		template.Name, template.Description, template.Image, template.ResourceProfile)
+	return err
+}
+
+func (p *postgres) DeleteTemplate(ctx context.Context, name string) error {
+	_, err := p.pool.Exec(ctx, "DELETE FROM hive_templates WHERE name = $1", name)
+	return err
+}
+
+func (p *postgres) LoadQuotas(ctx context.Context) (map[string]int, error) {
+	rows, err := p.pool.Query(ctx, "SELECT course_name, max_environments FROM hive_quotas")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	limits := make(map[string]int)
+	for rows.Next() {
+		var courseName string
+		var limit int
+		if err := rows.Scan(&courseName, &limit); err != nil {
+			return nil, err
+		}
+		limits[courseName] = limit
+	}
+	return limits, rows.Err()
+}
+
+func (p *postgres) SaveQuota(ctx context.Context, courseName string, limit int) error {
+	if limit == 0 {
+		_, err := p.pool.Exec(ctx, "DELETE FROM hive_quotas WHERE course_name = $1", courseName)
+		return err
+	}
+	_, err := p.pool.Exec(ctx, `INSERT INTO hive_quotas (course_name, max_environments) VALUES ($1, $2)
+		ON CONFLICT (course_name) DO UPDATE SET max_environments = EXCLUDED.max_environments`,
+		courseName, limit)
+	return err
+}
+
+// QueryAudit selects the entries in the database, reading only the most
+// recent Limit of them when a limit is set.
+func (p *postgres) QueryAudit(ctx context.Context, filter audit.Filter) ([]audit.Entry, error) {
+	var conditions []string
+	var args []interface{}
+	where := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	for _, match := range []struct{ column, value string }{
+		{"course_name", filter.Environment.CourseName},
+		{"assignment_name", filter.Environment.AssignmentName},
+		{"net_id", filter.Environment.NetID},
+		{"actor", filter.Actor},
+		{"on_behalf_of", filter.OnBehalfOf},
+		{"action", filter.Action},
+		{"outcome", filter.Outcome},
+		{"job_id", filter.JobID},
+	} {
+		if match.value != "" {
+			where(match.column+" = $%d", match.value)
+		}
+	}
+	if !filter.Since.IsZero() {
+		where("time >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where("time < $%d", filter.Until)
+	}
+
+	query := `SELECT id, time, actor, on_behalf_of, action, course_name, assignment_name, net_id,
+		parameters, outcome, error, request_id, job_id FROM hive_audit`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	// The most recent entries are read first so that the limit keeps them
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := p.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []audit.Entry{}
+	for rows.Next() {
+		var entry audit.Entry
+		var parameters []byte
+		err := rows.Scan(&entry.ID, &entry.Time, &entry.Actor, &entry.OnBehalfOf, &entry.Action,
+			&entry.Environment.CourseName, &entry.Environment.AssignmentName, &entry.Environment.NetID,
+			&parameters, &entry.Outcome, &entry.Error, &entry.RequestID, &entry.JobID)
+		if err != nil {
+			return nil, err
+		}
+		entry.Time = entry.Time.UTC()
+		if parameters != nil {
+			if err := json.Unmarshal(parameters, &entry.Parameters); err != nil {
+				return nil, fmt.Errorf("invalid parameters of audit entry %d: %w", entry.ID, err)
+			}
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+// AppendAudit lets the database assign the entry's ID, so that replicas
+// sharing it do not assign the same one.
+func (p *postgres) AppendAudit(ctx context.Context, entry audit.Entry) (int64, error) {
+	var parameters []byte
+	if entry.Parameters != nil {
+		var err error
+		if parameters, err = json.Marshal(entry.Parameters); err != nil {
+			return 0, err
+		}
+	}
+	var id int64
+	err := p.pool.QueryRow(ctx, `INSERT INTO hive_audit (time, actor, on_behalf_of, action, course_name, assignment_name, net_id,
+		parameters, outcome, error, request_id, job_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id`,
+		entry.Time, entry.Actor, entry.OnBehalfOf, entry.Action,
+		entry.Environment.CourseName, entry.Environment.AssignmentName, entry.Environment.NetID,
+		parameters, entry.Outcome, entry.Error, entry.RequestID, entry.JobID).Scan(&id)
+	return id, err
+}
+
+func (p *postgres) Close() error {
+	p.pool.Close()
+	return nil
+}
+
+var _ Store = (*postgres)(nil)
@@ -0,0 +1,130 @@
+// Package storage persists the provisioner's own state: the environments
+// that should exist, jobs, course manifests and their schedules, templates,
+// quotas and the audit log. The cluster is reconciled against the desired
+// environments it holds.
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/audit"
+	"github.com/BradleyLewis08/HiVE/internal/course"
+	"github.com/BradleyLewis08/HiVE/internal/quota"
+	"github.com/BradleyLewis08/HiVE/internal/templates"
+)
+
+const (
+	// Nothing survives a restart; for development and tests
+	BACKEND_MEMORY = "memory"
+	// A bbolt file, for a single provisioner replica
+	BACKEND_BOLT = "bolt"
+	// PostgreSQL, which can be shared with the user-service's database
+	BACKEND_POSTGRES = "postgres"
+)
+
+// Job statuses
+const (
+	JOB_RUNNING   = "running"
+	JOB_SUCCEEDED = "succeeded"
+	JOB_FAILED    = "failed"
+)
+
+// Kinds of job, after the request that started them
+const (
+	JOB_KIND_ENVIRONMENTS = "environments"
+	JOB_KIND_MANIFEST     = "manifest"
+	JOB_KIND_ROSTER       = "roster"
+	// Changes the provisioner makes to converge on the desired environments
+	JOB_KIND_RECONCILE = "reconcile"
+	// Deletions of objects whose environment is not desired
+	JOB_KIND_GC = "gc"
+)
+
+// Environment is an environment that should exist, and the options it
+// should run with.
+type Environment struct {
+	address.Address
+	Options deployments.EnvironmentOptions `json:"options"`
+	// Job that last created or changed the environment
+	JobID     string    `json:"jobID,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Job is a batch of changes made together, on behalf of a request or by
+// the reconciler.
+type Job struct {
+	ID         string `json:"id"`
+	Kind       string `json:"kind"`
+	Actor      string `json:"actor"`
+	RequestID  string `json:"requestID,omitempty"`
+	CourseName string `json:"courseName,omitempty"`
+	Status     string `json:"status"`
+	// Set when Status is failed
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Store is implemented by each backend. Lookups report whether the record
+// was found rather than failing.
+type Store interface {
+	audit.Backing
+	quota.Backing
+	templates.Backing
+
+	GetEnvironment(ctx context.Context, environment address.Address) (Environment, bool, error)
+	// ListEnvironments returns every desired environment, sorted by address.
+	ListEnvironments(ctx context.Context) ([]Environment, error)
+	PutEnvironment(ctx context.Context, environment Environment) error
+	DeleteEnvironment(ctx context.Context, environment address.Address) error
+
+	GetJob(ctx context.Context, id string) (Job, bool, error)
+	// ListJobs returns every job, most recently started first.
+	ListJobs(ctx context.Context) ([]Job, error)
+	PutJob(ctx context.Context, job Job) error
+
+	// Manifests are keyed by their sanitized course name.
+	GetManifest(ctx context.Context, courseName string) (course.Manifest, bool, error)
+	ListManifests(ctx context.Context) ([]course.Manifest, error)
+	PutManifest(ctx context.Context, courseName string, manifest course.Manifest) error
+
+	Close() error
+}
+
+type Config struct {
+	// One of the BACKEND_ constants; defaults to BACKEND_BOLT
+	Backend string
+	// File used by BACKEND_BOLT, which must be on a persistent volume. It
+	// has no default, since the working directory of a container is lost
+	// when it restarts.
+	Path string
+	// Connection string used by BACKEND_POSTGRES, e.g.
+	// postgres://hive@db:5432/hive
+	URL string
+}
+
+// Open connects to the configured backend and migrates its schema to the
+// current version.
+func Open(ctx context.Context, config Config) (Store, error) {
+	switch config.Backend {
+	case BACKEND_MEMORY:
+		return NewMemory(), nil
+	case "", BACKEND_BOLT:
+		if config.Path == "" {
+			return nil, fmt.Errorf("the %s storage backend requires a file path on a persistent volume", BACKEND_BOLT)
+		}
+		return OpenBolt(config.Path)
+	case BACKEND_POSTGRES:
+		if config.URL == "" {
+			return nil, fmt.Errorf("the %s storage backend requires a database URL", BACKEND_POSTGRES)
+		}
+		return OpenPostgres(ctx, config.URL)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", config.Backend)
+	}
+}
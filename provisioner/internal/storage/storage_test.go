@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/audit"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestAuditIDsAndQueries(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "hive.db")
+	store, err := OpenBolt(path)
+	if err != nil {
+		t.Fatalf("OpenBolt: %v", err)
+	}
+
+	start := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	alice := address.New("hw1", "cpsc323", "alice")
+	bob := address.New("hw1", "cpsc323", "bob")
+	log := audit.Open(store)
+	for i, entry := range []audit.Entry{
+		{Time: start, Actor: "api", Action: audit.ACTION_CREATE, Environment: alice},
+		{Time: start.Add(time.Minute), Actor: "api", Action: audit.ACTION_CREATE, Environment: bob},
+		{Time: start.Add(2 * time.Minute), Actor: "reconciler", Action: audit.ACTION_REPAIR, Environment: alice},
+	} {
+		appended, err := log.Append(ctx, entry)
+		if err != nil || appended.ID != int64(i+1) {
+			t.Fatalf("Append = %+v, %v, want ID %d", appended, err, i+1)
+		}
+	}
+	store.Close()
+
+	// The sequence carries on after a restart
+	store, err = OpenBolt(path)
+	if err != nil {
+		t.Fatalf("OpenBolt after a restart: %v", err)
+	}
+	defer store.Close()
+	log = audit.Open(store)
+	if appended, err := log.Append(ctx, audit.Entry{Time: start.Add(3 * time.Minute), Actor: "api", Action: audit.ACTION_DELETE, Environment: alice}); err != nil || appended.ID != 4 {
+		t.Fatalf("Append after a restart = %+v, %v, want ID 4", appended, err)
+	}
+
+	tests := []struct {
+		name   string
+		filter audit.Filter
+		want   []int64
+	}{
+		{"everything", audit.Filter{}, []int64{1, 2, 3, 4}},
+		{"environment", audit.Filter{Environment: address.Address{NetID: "alice"}}, []int64{1, 3, 4}},
+		{"actor", audit.Filter{Actor: "reconciler"}, []int64{3}},
+		{"time", audit.Filter{Since: start.Add(time.Minute), Until: start.Add(3 * time.Minute)}, []int64{2, 3}},
+		{"most recent", audit.Filter{Environment: address.Address{NetID: "alice"}, Limit: 2}, []int64{3, 4}},
+		{"nothing", audit.Filter{Action: audit.ACTION_EXEC}, []int64{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			entries, err := log.Query(ctx, tc.filter)
+			if err != nil {
+				t.Fatalf("Query: %v", err)
+			}
+			ids := []int64{}
+			for _, entry := range entries {
+				ids = append(ids, entry.ID)
+			}
+			if len(ids) != len(tc.want) {
+				t.Fatalf("Query = IDs %v, want %v", ids, tc.want)
+			}
+			for i := range ids {
+				if ids[i] != tc.want[i] {
+					t.Fatalf("Query = IDs %v, want %v", ids, tc.want)
+				}
+			}
+		})
+	}
+}
+
+// TestBoltAuditSequenceMigration checks that a file whose entries were
+// numbered by the provisioner goes on from the last of them.
+func TestBoltAuditSequenceMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hive.db")
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if err := boltMigrations[0](tx); err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucket([]byte(BUCKET_META))
+		if err != nil {
+			return err
+		}
+		if err := meta.Put(SCHEMA_VERSION_KEY, binary.BigEndian.AppendUint64(nil, 1)); err != nil {
+			return err
+		}
+		for _, id := range []int64{1, 2, 7} {
+			data, _ := json.Marshal(audit.Entry{ID: id, Actor: "api"})
+			if err := tx.Bucket([]byte(BUCKET_AUDIT)).Put([]byte(auditKey(id)), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenBolt(path)
+	if err != nil {
+		t.Fatalf("OpenBolt: %v", err)
+	}
+	defer store.Close()
+	if appended, err := audit.Open(store).Append(context.Background(), audit.Entry{Actor: "api"}); err != nil || appended.ID != 8 {
+		t.Fatalf("Append after migrating = %+v, %v, want ID 8", appended, err)
+	}
+}
+
+func TestOpenRequiresBoltPath(t *testing.T) {
+	if _, err := Open(context.Background(), Config{Backend: BACKEND_BOLT}); err == nil {
+		t.Fatal("Open of the bolt backend without a path succeeded")
+	}
+}
+
+// TestPendingMigrations checks that a database migrated by the first
+// release only runs the migrations added since.
+func TestPendingMigrations(t *testing.T) {
+	pending, err := pendingMigrations(1)
+	if err != nil {
+		t.Fatalf("pendingMigrations: %v", err)
+	}
+	if len(pending) == 0 || pending[0].name != "0002_audit_ids.sql" {
+		t.Fatalf("pendingMigrations(1) = %+v, want 0002_audit_ids.sql first", pending)
+	}
+	if all, err := pendingMigrations(0); err != nil || all[0].name != "0001_initial.sql" {
+		t.Fatalf("pendingMigrations(0) = %+v, %v, want 0001_initial.sql first", all, err)
+	}
+}
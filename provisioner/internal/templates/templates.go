@@ -0,0 +1,119 @@
+package templates
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/BradleyLewis08/HiVE/deployments"
+	"github.com/BradleyLewis08/HiVE/internal/naming"
+)
+
+// Template is a named environment image that assignments can be
+// provisioned from instead of passing an image on every request.
+type Template struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image"`
+	// ResourceProfile is used when a request does not name one
+	ResourceProfile string `json:"resourceProfile,omitempty"`
+}
+
+func (t Template) Validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("template name is required")
+	}
+	if name, err := naming.Sanitize(t.Name); err != nil || name != t.Name {
+		return fmt.Errorf("template name %q must be lowercase alphanumerics and dashes", t.Name)
+	}
+	if t.Image == "" {
+		return fmt.Errorf("template %s has no image", t.Name)
+	}
+	if _, err := deployments.ResourceProfile(t.ResourceProfile); err != nil {
+		return err
+	}
+	return nil
+}
+
+type Store struct {
+	mu        sync.RWMutex
+	templates map[string]Template
+	backing   Backing
+}
+
+// Backing persists templates for a Store, such as the provisioner's
+// storage.
+type Backing interface {
+	LoadTemplates(ctx context.Context) ([]Template, error)
+	SaveTemplate(ctx context.Context, template Template) error
+	DeleteTemplate(ctx context.Context, name string) error
+}
+
+// NewStore returns a store kept only in memory.
+func NewStore() *Store {
+	return &Store{templates: make(map[string]Template)}
+}
+
+// Open loads the templates held by backing, and saves changes to it.
+func Open(ctx context.Context, backing Backing) (*Store, error) {
+	list, err := backing.LoadTemplates(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load templates: %w", err)
+	}
+	s := &Store{templates: make(map[string]Template, len(list)), backing: backing}
+	for _, template := range list {
+		s.templates[template.Name] = template
+	}
+	return s, nil
+}
+
+func (s *Store) List() []Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]Template, 0, len(s.templates))
+	for _, template := range s.templates {
+		list = append(list, template)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func (s *Store) Get(name string) (Template, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	template, ok := s.templates[name]
+	return template, ok
+}
+
+// Apply creates the template or replaces an existing one with the same name.
+func (s *Store) Apply(ctx context.Context, template Template) error {
+	if err := template.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.backing != nil {
+		if err := s.backing.SaveTemplate(ctx, template); err != nil {
+			return fmt.Errorf("failed to save template: %w", err)
+		}
+	}
+	s.templates[template.Name] = template
+	return nil
+}
+
+// Delete removes the template, and reports whether it existed.
+func (s *Store) Delete(ctx context.Context, name string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.templates[name]; !ok {
+		return false, nil
+	}
+	if s.backing != nil {
+		if err := s.backing.DeleteTemplate(ctx, name); err != nil {
+			return false, fmt.Errorf("failed to delete template: %w", err)
+		}
+	}
+	delete(s.templates, name)
+	return true, nil
+}
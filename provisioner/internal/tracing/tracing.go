@@ -0,0 +1,130 @@
+// Package tracing configures OpenTelemetry tracing and starts the spans
+// that break a request down into provisioner, router and Kubernetes calls.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// Tracing is disabled; spans are started but never recorded
+	EXPORTER_NONE = "none"
+	// OTLP over HTTP, configured by the standard OTEL_EXPORTER_OTLP_*
+	// variables
+	EXPORTER_OTLP = "otlp"
+	// Pretty-printed JSON on stdout
+	EXPORTER_STDOUT = "stdout"
+	// JSON, one span per line, appended to Config.File
+	EXPORTER_FILE = "file"
+)
+
+const (
+	TRACER_NAME  = "github.com/BradleyLewis08/HiVE"
+	SERVICE_NAME = "hive-provisioner"
+)
+
+type Config struct {
+	// One of the EXPORTER_ constants; defaults to EXPORTER_NONE
+	Exporter string
+	// Path written by EXPORTER_FILE
+	File string
+}
+
+// Setup installs a global tracer provider exporting to the configured
+// exporter, along with W3C trace context propagation. The returned function
+// flushes and stops the exporter.
+func Setup(ctx context.Context, config Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var closer io.Closer
+	var err error
+	switch config.Exporter {
+	case "", EXPORTER_NONE:
+		return func(context.Context) error { return nil }, nil
+	case EXPORTER_OTLP:
+		exporter, err = otlptracehttp.New(ctx)
+	case EXPORTER_STDOUT:
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case EXPORTER_FILE:
+		if config.File == "" {
+			return nil, fmt.Errorf("the %s trace exporter requires a file", EXPORTER_FILE)
+		}
+		var file *os.File
+		file, err = os.OpenFile(config.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open trace file: %w", err)
+		}
+		closer = file
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", config.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s trace exporter: %w", config.Exporter, err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.Merge(
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(SERVICE_NAME)),
+		resource.Environment(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// The sampler follows OTEL_TRACES_SAMPLER, sampling everything by default
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			if closeErr := closer.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Start starts a span named after the operation, e.g. "Provisioner.DeleteEnvironment".
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TRACER_NAME).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// Environment describes the environment an operation acts on.
+func Environment(environment address.Address) attribute.KeyValue {
+	return attribute.String("hive.environment", environment.String())
+}
+
+// Handler wraps the API's handler so that each request is a server span,
+// continuing the trace of the caller if it sent one.
+func Handler(next http.Handler) http.Handler {
+	return otelhttp.NewHandler(next, SERVICE_NAME)
+}
+
+// Transport wraps an HTTP transport so that each request is a client span,
+// carrying the trace context to the server.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return otelhttp.NewTransport(next)
+}
@@ -0,0 +1,214 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Subdirectories of the queue directory, holding one JSON file per delivery
+const (
+	PENDING_DIRECTORY = "pending"
+	DEAD_DIRECTORY    = "dead"
+)
+
+// Delivery is one payload on its way to the webhook endpoint.
+type Delivery struct {
+	ID      string  `json:"id"`
+	Payload Payload `json:"payload"`
+	// Attempts made so far
+	Attempts    int       `json:"attempts"`
+	CreatedAt   time.Time `json:"createdAt"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	// Why the last attempt failed
+	LastError string `json:"lastError,omitempty"`
+}
+
+// Queue keeps pending and dead-lettered deliveries in memory and mirrors
+// each change to a file, so that deliveries survive a restart.
+type Queue struct {
+	mu        sync.Mutex
+	directory string
+	pending   map[string]Delivery
+	dead      map[string]Delivery
+}
+
+// OpenQueue opens the queue kept in directory, creating it if needed.
+func OpenQueue(directory string) (*Queue, error) {
+	q := &Queue{directory: directory}
+	var err error
+	if q.pending, err = load(filepath.Join(directory, PENDING_DIRECTORY)); err != nil {
+		return nil, err
+	}
+	if q.dead, err = load(filepath.Join(directory, DEAD_DIRECTORY)); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func load(directory string) (map[string]Delivery, error) {
+	if err := os.MkdirAll(directory, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create webhook queue: %w", err)
+	}
+	files, err := os.ReadDir(directory)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read webhook queue: %w", err)
+	}
+
+	deliveries := make(map[string]Delivery)
+	for _, file := range files {
+		// Temporary files left by an interrupted write are discarded
+		if !strings.HasSuffix(file.Name(), ".json") {
+			os.Remove(filepath.Join(directory, file.Name()))
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(directory, file.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read webhook delivery: %w", err)
+		}
+		var delivery Delivery
+		if err := json.Unmarshal(data, &delivery); err != nil {
+			return nil, fmt.Errorf("failed to parse webhook delivery %s: %w", file.Name(), err)
+		}
+		deliveries[delivery.ID] = delivery
+	}
+	return deliveries, nil
+}
+
+// Enqueue adds a pending delivery, or updates one already pending.
+func (q *Queue) Enqueue(delivery Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.write(PENDING_DIRECTORY, delivery); err != nil {
+		return err
+	}
+	q.pending[delivery.ID] = delivery
+	return nil
+}
+
+// Due returns the pending deliveries whose next attempt is at or before
+// now, oldest first.
+func (q *Queue) Due(now time.Time) []Delivery {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var due []Delivery
+	for _, delivery := range q.pending {
+		if !delivery.NextAttempt.After(now) {
+			due = append(due, delivery)
+		}
+	}
+	sortDeliveries(due)
+	return due
+}
+
+// NextAttempt returns the earliest next attempt of any pending delivery,
+// and false when none are pending.
+func (q *Queue) NextAttempt() (time.Time, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var next time.Time
+	for _, delivery := range q.pending {
+		if next.IsZero() || delivery.NextAttempt.Before(next) {
+			next = delivery.NextAttempt
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// Complete removes a delivered delivery.
+func (q *Queue) Complete(id string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := os.Remove(q.path(PENDING_DIRECTORY, id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(q.pending, id)
+	return nil
+}
+
+// Kill moves a delivery that will not be retried to the dead letters.
+func (q *Queue) Kill(delivery Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.write(DEAD_DIRECTORY, delivery); err != nil {
+		return err
+	}
+	q.dead[delivery.ID] = delivery
+	if err := os.Remove(q.path(PENDING_DIRECTORY, delivery.ID)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	delete(q.pending, delivery.ID)
+	return nil
+}
+
+// DeadLetters returns the deliveries that were given up on, oldest first.
+func (q *Queue) DeadLetters() []Delivery {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	dead := make([]Delivery, 0, len(q.dead))
+	for _, delivery := range q.dead {
+		dead = append(dead, delivery)
+	}
+	sortDeliveries(dead)
+	return dead
+}
+
+// Revive moves a dead letter back to the pending deliveries, due at now
+// and with its attempts reset. It returns false when there is no dead
+// letter with the ID.
+func (q *Queue) Revive(id string, now time.Time) (Delivery, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delivery, ok := q.dead[id]
+	if !ok {
+		return Delivery{}, false, nil
+	}
+	delivery.Attempts = 0
+	delivery.NextAttempt = now
+	if err := q.write(PENDING_DIRECTORY, delivery); err != nil {
+		return Delivery{}, false, err
+	}
+	q.pending[id] = delivery
+	if err := os.Remove(q.path(DEAD_DIRECTORY, id)); err != nil && !os.IsNotExist(err) {
+		return Delivery{}, false, err
+	}
+	delete(q.dead, id)
+	return delivery, true, nil
+}
+
+// write replaces the delivery's file in subdirectory, through a temporary
+// file so that a crash never leaves it half written. The lock must be held.
+func (q *Queue) write(subdirectory string, delivery Delivery) error {
+	data, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	path := q.path(subdirectory, delivery.ID)
+	temporary := path + ".tmp"
+	if err := os.WriteFile(temporary, data, 0600); err != nil {
+		return fmt.Errorf("failed to write webhook delivery: %w", err)
+	}
+	if err := os.Rename(temporary, path); err != nil {
+		os.Remove(temporary)
+		return fmt.Errorf("failed to write webhook delivery: %w", err)
+	}
+	return nil
+}
+
+func (q *Queue) path(subdirectory string, id string) string {
+	return filepath.Join(q.directory, subdirectory, id+".json")
+}
+
+func sortDeliveries(deliveries []Delivery) {
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+}
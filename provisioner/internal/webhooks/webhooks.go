@@ -0,0 +1,325 @@
+// Package webhooks notifies an outside service, such as the user-service,
+// of environment events by posting signed JSON payloads to it. Deliveries
+// are queued on disk and retried with backoff until they succeed or are
+// dead-lettered.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/events"
+	"github.com/BradleyLewis08/HiVE/internal/logging"
+	"github.com/BradleyLewis08/HiVE/internal/metrics"
+	"github.com/BradleyLewis08/HiVE/internal/tracing"
+)
+
+// Headers sent with every delivery
+const (
+	// "sha256=" followed by the hex HMAC-SHA256, keyed with the secret, of
+	// the timestamp, a period and the body
+	SIGNATURE_HEADER = "X-Hive-Signature"
+	// Unix seconds at which the attempt was signed, so that receivers can
+	// reject replayed requests
+	TIMESTAMP_HEADER = "X-Hive-Timestamp"
+	// The same for every attempt of a delivery, so that receivers can
+	// discard duplicates
+	DELIVERY_HEADER = "X-Hive-Delivery"
+	EVENT_HEADER    = "X-Hive-Event"
+)
+
+const SIGNATURE_PREFIX = "sha256="
+
+// Directory holding the delivery queue when none is configured, relative to
+// the working directory
+const DEFAULT_DIRECTORY = "webhooks"
+
+// Attempts made before a delivery is dead-lettered when none are configured
+const DEFAULT_MAX_ATTEMPTS = 10
+
+// Backoff after the first failed attempt, doubling after each one up to
+// MAX_BACKOFF. Ten attempts span a little over an hour.
+const (
+	INITIAL_BACKOFF = 10 * time.Second
+	MAX_BACKOFF     = 30 * time.Minute
+)
+
+// How long the endpoint has to answer an attempt
+const ATTEMPT_TIMEOUT = 10 * time.Second
+
+// Outcomes of delivery attempts, as counted by metrics.WebhookAttempts
+const (
+	OUTCOME_DELIVERED     = "delivered"
+	OUTCOME_RETRY         = "retry"
+	OUTCOME_DEAD_LETTERED = "dead-lettered"
+)
+
+// Event types delivered when Config.Events is empty: those the user-service
+// needs to keep its environments in sync
+var DEFAULT_EVENTS = []string{events.EVENT_READY, events.EVENT_FAILED, events.EVENT_DELETED}
+
+type Config struct {
+	// Endpoint deliveries are posted to
+	URL string
+	// Key the payloads are signed with
+	Secret string
+	// Event types to deliver; DEFAULT_EVENTS when empty
+	Events []string
+	// Defaults to DEFAULT_DIRECTORY
+	Directory string
+	// Defaults to DEFAULT_MAX_ATTEMPTS
+	MaxAttempts int
+}
+
+// Payload is the JSON body of a delivery: the event, along with the public
+// URL of its environment.
+type Payload struct {
+	events.Event
+	URL string `json:"url"`
+}
+
+type Dispatcher struct {
+	config Config
+	queue  *Queue
+	client *http.Client
+	// Signals the delivery loop that deliveries were queued
+	wake chan struct{}
+}
+
+func NewDispatcher(config Config) (*Dispatcher, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("a webhook URL is required")
+	}
+	if config.Secret == "" {
+		return nil, fmt.Errorf("a webhook secret is required to sign payloads")
+	}
+	if len(config.Events) == 0 {
+		config.Events = DEFAULT_EVENTS
+	}
+	if config.Directory == "" {
+		config.Directory = DEFAULT_DIRECTORY
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DEFAULT_MAX_ATTEMPTS
+	}
+
+	queue, err := OpenQueue(config.Directory)
+	if err != nil {
+		return nil, err
+	}
+	return &Dispatcher{
+		config: config,
+		queue:  queue,
+		client: &http.Client{Timeout: ATTEMPT_TIMEOUT, Transport: tracing.Transport(http.DefaultTransport)},
+		wake:   make(chan struct{}, 1),
+	}, nil
+}
+
+// Run queues a delivery for each of the broker's events of the configured
+// types, and delivers queued payloads, until ctx is done. environmentURL
+// gives the public URL of an environment.
+func (d *Dispatcher) Run(ctx context.Context, broker *events.Broker, environmentURL func(address.Address) string) {
+	go d.deliver(ctx)
+
+	filter := events.Filter{Types: make(map[string]bool)}
+	for _, eventType := range d.config.Events {
+		filter.Types[eventType] = true
+	}
+
+	var last int64
+	for {
+		subscription := broker.Subscribe(filter, last)
+		last = d.enqueue(ctx, subscription, last, environmentURL)
+		subscription.Close()
+		if ctx.Err() != nil {
+			return
+		}
+		// Fell behind; resubscribe, catching up from the broker's history
+		slog.WarnContext(ctx, "Webhook event subscription fell behind", "lastEvent", last)
+	}
+}
+
+// enqueue queues the subscription's events until it is closed or ctx is
+// done, and returns the ID of the last event queued so far. last is the one
+// queued before the subscription, and is returned as is when no event
+// arrives, so that resubscribing does not replay the history again.
+func (d *Dispatcher) enqueue(ctx context.Context, subscription *events.Subscription, last int64, environmentURL func(address.Address) string) int64 {
+	for {
+		select {
+		case <-ctx.Done():
+			return last
+		case event, ok := <-subscription.Events():
+			if !ok {
+				return last
+			}
+			last = event.ID
+			now := time.Now().UTC()
+			delivery := Delivery{
+				ID:          logging.NewID(),
+				Payload:     Payload{Event: event, URL: environmentURL(event.Environment)},
+				CreatedAt:   now,
+				NextAttempt: now,
+			}
+			if err := d.queue.Enqueue(delivery); err != nil {
+				slog.ErrorContext(ctx, "Failed to queue webhook delivery", "event", event.Type, "environment", event.Environment, "error", err)
+				continue
+			}
+			d.notify()
+		}
+	}
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver attempts due deliveries one at a time, oldest first, sleeping
+// until the next one is due or more are queued.
+func (d *Dispatcher) deliver(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-timer.C:
+		}
+
+		for _, delivery := range d.queue.Due(time.Now()) {
+			if ctx.Err() != nil {
+				return
+			}
+			d.attempt(ctx, delivery)
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		if next, ok := d.queue.NextAttempt(); ok {
+			timer.Reset(time.Until(next))
+		}
+	}
+}
+
+// attempt posts a delivery once, then completes it, schedules a retry or
+// dead-letters it.
+func (d *Dispatcher) attempt(ctx context.Context, delivery Delivery) {
+	logger := slog.With("delivery", delivery.ID, "event", delivery.Payload.Type, "environment", delivery.Payload.Environment)
+
+	err := d.post(ctx, delivery)
+	if ctx.Err() != nil {
+		// Shutting down; the attempt is made again on the next start
+		return
+	}
+	delivery.Attempts++
+	if err == nil {
+		metrics.WebhookAttempts.WithLabelValues(OUTCOME_DELIVERED).Inc()
+		if err := d.queue.Complete(delivery.ID); err != nil {
+			logger.ErrorContext(ctx, "Failed to remove delivered webhook from the queue", "error", err)
+		}
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.config.MaxAttempts {
+		metrics.WebhookAttempts.WithLabelValues(OUTCOME_DEAD_LETTERED).Inc()
+		logger.ErrorContext(ctx, "Webhook delivery dead-lettered", "attempts", delivery.Attempts, "error", err)
+		if err := d.queue.Kill(delivery); err != nil {
+			logger.ErrorContext(ctx, "Failed to dead-letter webhook delivery", "error", err)
+		}
+		return
+	}
+
+	metrics.WebhookAttempts.WithLabelValues(OUTCOME_RETRY).Inc()
+	delivery.NextAttempt = time.Now().UTC().Add(backoff(delivery.Attempts))
+	logger.WarnContext(ctx, "Webhook delivery failed, will retry", "attempts", delivery.Attempts, "nextAttempt", delivery.NextAttempt, "error", err)
+	if err := d.queue.Enqueue(delivery); err != nil {
+		logger.ErrorContext(ctx, "Failed to reschedule webhook delivery", "error", err)
+	}
+}
+
+func (d *Dispatcher) post(ctx context.Context, delivery Delivery) error {
+	body, err := json.Marshal(delivery.Payload)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, d.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(SIGNATURE_HEADER, Sign(d.config.Secret, timestamp, body))
+	request.Header.Set(TIMESTAMP_HEADER, timestamp)
+	request.Header.Set(DELIVERY_HEADER, delivery.ID)
+	request.Header.Set(EVENT_HEADER, delivery.Payload.Type)
+
+	response, err := d.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(response.Body, 64<<10))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook endpoint answered %s", response.Status)
+	}
+	return nil
+}
+
+// Sign returns the SIGNATURE_HEADER value for a body sent at timestamp.
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return SIGNATURE_PREFIX + hex.EncodeToString(mac.Sum(nil))
+}
+
+// backoff returns how long to wait after the given number of failed
+// attempts, with up to a fifth added at random so that retries spread out.
+func backoff(attempts int) time.Duration {
+	wait := INITIAL_BACKOFF
+	for i := 1; i < attempts && wait < MAX_BACKOFF; i++ {
+		wait *= 2
+	}
+	if wait > MAX_BACKOFF {
+		wait = MAX_BACKOFF
+	}
+	return wait + time.Duration(rand.Int63n(int64(wait/5)+1))
+}
+
+// DeadLetters returns the deliveries that were given up on, oldest first.
+func (d *Dispatcher) DeadLetters() []Delivery {
+	return d.queue.DeadLetters()
+}
+
+// Replay queues a dead-lettered delivery again, with a fresh set of
+// attempts. It returns false when there is no dead letter with the ID.
+func (d *Dispatcher) Replay(id string) (Delivery, bool, error) {
+	delivery, ok, err := d.queue.Revive(id, time.Now().UTC())
+	if ok {
+		d.notify()
+	}
+	return delivery, ok, err
+}
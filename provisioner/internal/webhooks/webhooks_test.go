@@ -0,0 +1,222 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/events"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		secret    string
+		timestamp string
+		body      string
+		want      string
+	}{
+		// HMAC-SHA256 of "1700000000.{"id":1}" keyed with "secret"
+		{"secret", "1700000000", `{"id":1}`, "sha256=3dd1b9aef568d75f6790a84bd2e5dfa1f44409eef3cbdbd3f10b837376100c11"},
+	}
+	for _, tc := range tests {
+		if got := Sign(tc.secret, tc.timestamp, []byte(tc.body)); got != tc.want {
+			t.Errorf("Sign(%q, %q, %q) = %q, want %q", tc.secret, tc.timestamp, tc.body, got, tc.want)
+		}
+	}
+
+	signature := Sign("secret", "1700000000", []byte(`{"id":1}`))
+	for name, other := range map[string]string{
+		"secret":    Sign("other", "1700000000", []byte(`{"id":1}`)),
+		"timestamp": Sign("secret", "1700000001", []byte(`{"id":1}`)),
+		"body":      Sign("secret", "1700000000", []byte(`{"id":2}`)),
+	} {
+		if other == signature {
+			t.Errorf("changing the %s did not change the signature", name)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, INITIAL_BACKOFF},
+		{2, 2 * INITIAL_BACKOFF},
+		{3, 4 * INITIAL_BACKOFF},
+		{8, 128 * INITIAL_BACKOFF},
+		{9, MAX_BACKOFF},
+		{100, MAX_BACKOFF},
+	}
+	for _, tc := range tests {
+		// Up to a fifth is added at random
+		for i := 0; i < 20; i++ {
+			if got := backoff(tc.attempts); got < tc.want || got > tc.want+tc.want/5 {
+				t.Fatalf("backoff(%d) = %v, want between %v and %v", tc.attempts, got, tc.want, tc.want+tc.want/5)
+			}
+		}
+	}
+}
+
+func TestQueuePersists(t *testing.T) {
+	directory := t.TempDir()
+	queue, err := OpenQueue(directory)
+	if err != nil {
+		t.Fatalf("OpenQueue: %v", err)
+	}
+
+	start := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+	due := Delivery{ID: "due", Payload: Payload{Event: events.Event{ID: 1, Type: events.EVENT_READY}}, CreatedAt: start, NextAttempt: start}
+	later := Delivery{ID: "later", Payload: Payload{Event: events.Event{ID: 2, Type: events.EVENT_READY}}, CreatedAt: start.Add(time.Second), NextAttempt: start.Add(time.Hour)}
+	delivered := Delivery{ID: "delivered", CreatedAt: start, NextAttempt: start}
+	dead := Delivery{ID: "dead", CreatedAt: start, NextAttempt: start, Attempts: DEFAULT_MAX_ATTEMPTS, LastError: "webhook endpoint answered 500"}
+	for _, delivery := range []Delivery{due, later, delivered, dead} {
+		if err := queue.Enqueue(delivery); err != nil {
+			t.Fatalf("Enqueue %s: %v", delivery.ID, err)
+		}
+	}
+	if err := queue.Complete(delivered.ID); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if err := queue.Kill(dead); err != nil {
+		t.Fatalf("Kill: %v", err)
+	}
+	// Left behind by a write interrupted by a crash
+	interrupted := filepath.Join(directory, PENDING_DIRECTORY, "interrupted.json.tmp")
+	if err := os.WriteFile(interrupted, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := OpenQueue(directory)
+	if err != nil {
+		t.Fatalf("OpenQueue after a restart: %v", err)
+	}
+	if got := reopened.Due(start); !reflect.DeepEqual(got, []Delivery{due}) {
+		t.Fatalf("Due after a restart = %+v, want %+v", got, []Delivery{due})
+	}
+	if got := reopened.Due(start.Add(time.Hour)); !reflect.DeepEqual(got, []Delivery{due, later}) {
+		t.Fatalf("Due an hour later = %+v, want both pending deliveries", got)
+	}
+	if next, ok := reopened.NextAttempt(); !ok || !next.Equal(start) {
+		t.Fatalf("NextAttempt = %v, %v, want %v", next, ok, start)
+	}
+	if got := reopened.DeadLetters(); !reflect.DeepEqual(got, []Delivery{dead}) {
+		t.Fatalf("DeadLetters after a restart = %+v, want %+v", got, []Delivery{dead})
+	}
+	if _, err := os.Stat(interrupted); !os.IsNotExist(err) {
+		t.Fatalf("temporary file was not discarded: %v", err)
+	}
+
+	revived, ok, err := reopened.Revive(dead.ID, start)
+	if err != nil || !ok || revived.Attempts != 0 {
+		t.Fatalf("Revive = %+v, %v, %v, want the dead letter with no attempts", revived, ok, err)
+	}
+	if _, ok, _ := reopened.Revive(dead.ID, start); ok {
+		t.Fatal("Revive of a revived delivery succeeded")
+	}
+	again, err := OpenQueue(directory)
+	if err != nil {
+		t.Fatalf("OpenQueue: %v", err)
+	}
+	if len(again.DeadLetters()) != 0 || len(again.Due(start)) != 2 {
+		t.Fatalf("revived delivery was not persisted as pending")
+	}
+}
+
+// TestResubscribeKeepsPosition checks that a subscription closing before
+// any event arrives does not rewind the dispatcher, which would queue the
+// broker's history again under new delivery IDs.
+func TestResubscribeKeepsPosition(t *testing.T) {
+	ctx := context.Background()
+	dispatcher, err := NewDispatcher(Config{URL: "http://127.0.0.1:0", Secret: "secret", Directory: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	environmentURL := func(address.Address) string { return "" }
+	broker := events.NewBroker()
+	environment := address.New("hw1", "cpsc323", "alice")
+
+	subscription := broker.Subscribe(events.Filter{}, 0)
+	broker.Publish(events.Event{Type: events.EVENT_READY, Environment: environment})
+	broker.Publish(events.Event{Type: events.EVENT_DELETED, Environment: environment})
+	subscription.Close()
+	last := dispatcher.enqueue(ctx, subscription, 0, environmentURL)
+	if last != 2 {
+		t.Fatalf("enqueue = %d, want the last event 2", last)
+	}
+
+	empty := broker.Subscribe(events.Filter{}, last)
+	empty.Close()
+	if got := dispatcher.enqueue(ctx, empty, last, environmentURL); got != last {
+		t.Fatalf("enqueue of a subscription with no events = %d, want %d", got, last)
+	}
+	if queued := dispatcher.queue.Due(time.Now()); len(queued) != 2 {
+		t.Fatalf("queued %d deliveries, want one per event", len(queued))
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	requests := make(chan received, 1)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		select {
+		case requests <- received{r.Header, body}:
+		default:
+		}
+	}))
+	defer endpoint.Close()
+
+	dispatcher, err := NewDispatcher(Config{URL: endpoint.URL, Secret: "secret", Directory: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewDispatcher: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := events.NewBroker()
+	environment := address.New("hw1", "cpsc323", "alice")
+	go dispatcher.Run(ctx, broker, func(a address.Address) string { return "https://hive.example.edu" + a.Path() })
+
+	// Published until the dispatcher has subscribed; only ready events are
+	// delivered by default
+	var request received
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+	for request.body == nil {
+		select {
+		case request = <-requests:
+		case <-ticker.C:
+			broker.Publish(events.Event{Type: events.EVENT_POD_SCHEDULED, Environment: environment})
+			broker.Publish(events.Event{Type: events.EVENT_READY, Environment: environment})
+		case <-timeout:
+			t.Fatal("no delivery was made")
+		}
+	}
+
+	header := request.header
+	if want := Sign("secret", header.Get(TIMESTAMP_HEADER), request.body); header.Get(SIGNATURE_HEADER) != want {
+		t.Fatalf("%s = %q, want %q", SIGNATURE_HEADER, header.Get(SIGNATURE_HEADER), want)
+	}
+	if header.Get(EVENT_HEADER) != events.EVENT_READY || header.Get(DELIVERY_HEADER) == "" {
+		t.Fatalf("delivery headers = %v", header)
+	}
+	var payload Payload
+	if err := json.Unmarshal(request.body, &payload); err != nil {
+		t.Fatalf("payload does not decode: %v", err)
+	}
+	if payload.Type != events.EVENT_READY || payload.Environment != environment || payload.URL != "https://hive.example.edu"+environment.Path() {
+		t.Fatalf("payload = %+v", payload)
+	}
+}
@@ -1 +1,16 @@
-go build -o server ./cmd/api/v1/main.go && ./server
\ No newline at end of file
+# Settings may also come from .env, which the provisioner loads itself
+if [ -f .env ]; then
+	set -a
+	. ./.env
+	set +a
+fi
+
+# The default bolt storage backend keeps its state in STORAGE_PATH, which has
+# no default: it must outlive the provisioner, so in the cluster it belongs
+# on a mounted volume, such as /var/lib/hive/hive.db.
+if [ "${STORAGE_BACKEND:-bolt}" = "bolt" ] && [ -z "$STORAGE_PATH" ]; then
+	echo "STORAGE_PATH is required with the bolt storage backend, e.g. STORAGE_PATH=/var/lib/hive/hive.db" >&2
+	exit 1
+fi
+
+go build -o server ./cmd/api/v1 && ./server
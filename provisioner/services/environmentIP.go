@@ -1,7 +1,8 @@
 package services
 
 import (
-	"github.com/BradleyLewis08/HiVE/internal/utils"
+	"github.com/BradleyLewis08/HiVE/internal/address"
+	"github.com/BradleyLewis08/HiVE/internal/naming"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -9,7 +10,6 @@ import (
 
 const (
 	CODER_PORT = 8080
-	SERVICE_PORT = 80
 )
 
 func NewEnvironmentService(
@@ -17,22 +17,20 @@ func NewEnvironmentService(
 	courseName string, 
 	netId string,
 ) *apiv1.Service {
-	labels := map[string]string {
-		"app": "hive-course",
-		"course": courseName,
-		"student": netId,
-		"assignment": assignmentName,
-	}
+	environment := address.New(assignmentName, courseName, netId)
+	labels := environment.Labels()
 	service := &apiv1.Service {
 		ObjectMeta: metav1.ObjectMeta {
-			Name: utils.ConstructLoadBalancerServiceName(assignmentName, courseName, netId),
+			Name: environment.ServiceName(),
+			Labels: labels,
+			Annotations: naming.OriginalAnnotations(assignmentName, courseName, netId),
 		},
 		Spec: apiv1.ServiceSpec {
 			Type: apiv1.ServiceTypeClusterIP,
 			Ports: []apiv1.ServicePort{
 				{
 					Name: "environmentip",
-					Port: SERVICE_PORT,
+					Port: address.SERVICE_PORT,
 					TargetPort: intstr.FromInt(CODER_PORT),
 				},
 			},